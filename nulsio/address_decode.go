@@ -80,3 +80,31 @@ func (decoder *AddressDecoder) ScriptPubKeyToBech32Address(scriptPubKey []byte)
 	return "", fmt.Errorf("ScriptPubKeyToBech32Address is not supported")
 
 }
+
+//IsAddress 是否合法的地址
+func (decoder *AddressDecoder) IsAddress(address string) bool {
+	return nulsio_addrdec.VerifyAddressWithChainID(address, decoder.wm.ChainID())
+}
+
+//ResolveAddress 解析地址或别名，别名通过节点查询对应的地址
+func (decoder *AddressDecoder) ResolveAddress(addressOrAlias string) (string, error) {
+
+	if decoder.IsAddress(addressOrAlias) {
+		return addressOrAlias, nil
+	}
+
+	if !nulsio_addrdec.IsValidAlias(addressOrAlias) {
+		return "", fmt.Errorf("[%s] is neither a valid address nor alias", addressOrAlias)
+	}
+
+	address, err := decoder.wm.Api.GetAddressByAlias(addressOrAlias)
+	if err != nil {
+		return "", err
+	}
+
+	if !decoder.IsAddress(address) {
+		return "", fmt.Errorf("alias[%s] resolved to invalid address: %s", addressOrAlias, address)
+	}
+
+	return address, nil
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	//地址交易列表每页默认数量
+	defaultHistoryPageSize = 50
+	//地址交易列表每页最大数量
+	maxHistoryPageSize = 100
+)
+
+//AddressTxHistory 地址的一页历史交易，交易已按区块扫描的逻辑提取
+type AddressTxHistory struct {
+	Address    string
+	PageNumber int
+	PageSize   int
+	Total      int
+	Pages      int
+	List       []*openwallet.TxExtractData
+}
+
+//GetAddressTxHistory 分页获取地址的历史交易，pageNumber从1开始，pageSize为0则使用默认数量
+func (wm *WalletManager) GetAddressTxHistory(address string, pageNumber, pageSize int) (*AddressTxHistory, error) {
+
+	if len(address) == 0 {
+		return nil, errors.New("address is empty")
+	}
+
+	if pageNumber <= 0 {
+		pageNumber = 1
+	}
+	if pageSize <= 0 {
+		pageSize = defaultHistoryPageSize
+	}
+	if pageSize > maxHistoryPageSize {
+		pageSize = maxHistoryPageSize
+	}
+
+	page, err := wm.Api.GetAddressTxList(address, 0, pageNumber, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &AddressTxHistory{
+		Address:    address,
+		PageNumber: page.PageNumber,
+		PageSize:   page.PageSize,
+		Total:      page.Total,
+		Pages:      page.Pages,
+		List:       make([]*openwallet.TxExtractData, 0),
+	}
+
+	for _, item := range page.List {
+		//列表只有交易摘要，获取完整交易后提取
+		tx, err := wm.Api.GetTxByTxId(item.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("can't find the txid [%s], err: %v", item.Hash, err)
+		}
+
+		list, err := wm.extractAddressTransaction(address, tx)
+		if err != nil {
+			return nil, err
+		}
+		history.List = append(history.List, list...)
+	}
+
+	return history, nil
+}
+
+//GetAllAddressTxHistory 获取地址的全部历史交易，用于账户对账
+func (wm *WalletManager) GetAllAddressTxHistory(address string) ([]*openwallet.TxExtractData, error) {
+
+	list := make([]*openwallet.TxExtractData, 0)
+	for pageNumber := 1; ; pageNumber++ {
+		history, err := wm.GetAddressTxHistory(address, pageNumber, maxHistoryPageSize)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, history.List...)
+		if pageNumber >= history.Pages {
+			break
+		}
+	}
+	return list, nil
+}
+
+//extractAddressTransaction 按区块扫描的提取逻辑提取交易中与地址相关的主币和代币数据
+func (wm *WalletManager) extractAddressTransaction(address string, tx *Tx) ([]*openwallet.TxExtractData, error) {
+
+	scanAddressFunc := func(a string) (string, bool) {
+		return address, a == address
+	}
+
+	extData, err := wm.Blockscanner.extractTransactionData(tx, scanAddressFunc)
+	if err != nil {
+		return nil, fmt.Errorf("extract transaction [%s] failed: %v", tx.Hash, err)
+	}
+
+	return extData[address], nil
+}
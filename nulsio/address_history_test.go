@@ -0,0 +1,75 @@
+package nulsio
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blocktree/openwallet/log"
+)
+
+func TestWalletManager_GetAllAddressTxHistory(t *testing.T) {
+
+	txs := map[string]*Tx{
+		"tx1": {Hash: "tx1", Type: TxTypeTransfer, BlockHeight: 10,
+			Inputs:  []*Input{{FromHash: "tx0", FromIndex: 0, Value: 300000000, Address: "addrA"}},
+			Outputs: []*Output{{Address: "addrB", Value: 100000000}, {Address: "addrA", Value: 199900000}}},
+		"tx2": {Hash: "tx2", Type: TxTypeTransfer, BlockHeight: 11, BlockHash: "h11",
+			Inputs:  []*Input{{FromHash: "tx1", FromIndex: 0, Value: 100000000, Address: "addrB"}},
+			Outputs: []*Output{{Address: "addrC", Value: 99900000}}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data interface{}
+		switch r.URL.Path {
+		case "/api/tx/list/address":
+			page := TxPage{PageSize: 1, Total: 2, Pages: 2}
+			if r.URL.Query().Get("pageNumber") == "1" {
+				page.PageNumber = 1
+				page.List = []*Tx{{Hash: "tx2"}}
+			} else {
+				page.PageNumber = 2
+				page.List = []*Tx{{Hash: "tx1"}}
+			}
+			data = page
+		case "/api/block/height/10":
+			data = &NusBlock{Height: 10, Hash: "h10"}
+		default:
+			data = txs[r.URL.Path[len("/api/tx/hash/"):]]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+	}))
+	defer server.Close()
+
+	wm := testStateWalletManager()
+	wm.Log = log.NewOWLogger(Symbol)
+	wm.Api = &Client{BaseURL: server.URL}
+	wm.Blockscanner = NewNULSBlockScanner(wm)
+
+	list, err := wm.GetAllAddressTxHistory("addrB")
+	if err != nil {
+		t.Errorf("GetAllAddressTxHistory failed, err: %v", err)
+		return
+	}
+	if len(list) != 2 {
+		t.Errorf("history length = %d, want 2", len(list))
+		return
+	}
+
+	//第一页为转出交易，第二页为转入交易
+	if list[0].Transaction.TxID != "tx2" || len(list[0].TxInputs) != 1 || len(list[0].TxOutputs) != 0 {
+		t.Errorf("history[0] = %+v", list[0])
+	}
+	if list[1].Transaction.TxID != "tx1" || len(list[1].TxInputs) != 0 || len(list[1].TxOutputs) != 1 || list[1].TxOutputs[0].Amount != "1" {
+		t.Errorf("history[1] = %+v", list[1])
+	}
+
+	//交易的区块高度和hash，未返回hash时按高度查询
+	if tx := list[0].Transaction; tx.BlockHeight != 11 || tx.BlockHash != "h11" {
+		t.Errorf("history[0] block = %d %s, want 11 h11", tx.BlockHeight, tx.BlockHash)
+	}
+	if tx := list[1].Transaction; tx.BlockHeight != 10 || tx.BlockHash != "h10" || list[1].TxOutputs[0].BlockHash != "h10" {
+		t.Errorf("history[1] block = %d %s, want 10 h10", tx.BlockHeight, tx.BlockHash)
+	}
+}
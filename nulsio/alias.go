@@ -0,0 +1,135 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/blocktree/nulsio-adapter/nulsio_addrdec"
+	"github.com/blocktree/nulsio-adapter/nulsio_trans"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+//IsAliasUsable 别名是否可以设置
+func (wm *WalletManager) IsAliasUsable(alias string) (bool, error) {
+	if !nulsio_addrdec.IsValidAlias(alias) {
+		return false, fmt.Errorf("alias[%s] format is invalid", alias)
+	}
+	return wm.Api.IsAliasUsable(alias)
+}
+
+//CreateAliasRawTransaction 创建设置别名交易
+//扩展参数address为设置别名的地址，alias为别名，设置别名需要销毁固定数量的NULS
+func (decoder *TransactionDecoder) CreateAliasRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	var (
+		usedUTXO    = make([]*UtxoDto, 0)
+		balance     = decimal.Zero
+		address     = rawTx.GetExtParam().Get("address").String()
+		alias       = rawTx.GetExtParam().Get("alias").String()
+		burnAddress = decoder.wm.Config.AliasBurnAddress
+		burnAmount  = decoder.wm.Config.AliasBurnAmount
+	)
+
+	if len(address) == 0 || len(alias) == 0 {
+		return errors.New("address and alias can not be empty!")
+	}
+
+	if len(burnAddress) == 0 {
+		return errors.New("aliasBurnAddress is not configured!")
+	}
+
+	//设置别名的地址必须属于账户
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID, "Address", address)
+	if err != nil || len(addresses) == 0 {
+		return openwallet.Errorf(openwallet.ErrAddressNotFound, "address[%s] is not in account", address)
+	}
+
+	usable, err := decoder.wm.IsAliasUsable(alias)
+	if err != nil {
+		return err
+	}
+	if !usable {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "alias[%s] is already used", alias)
+	}
+
+	feesRate, err := decoder.wm.EstimateFeeRate()
+	if err != nil {
+		return err
+	}
+
+	fees, err := decoder.wm.EstimateFee(0, 2, "", feesRate)
+	if err != nil {
+		return err
+	}
+
+	unspent, err := decoder.wm.GetAvailableUnspent(address)
+	if err != nil {
+		return err
+	}
+
+	//获取utxo，按小到大排序
+	sort.Sort(UnspentSort{unspent, func(a, b *UtxoDto) int {
+		if a.Value > b.Value {
+			return 1
+		} else {
+			return -1
+		}
+	}})
+
+	totalSend := burnAmount.Add(fees)
+	for _, u := range unspent {
+		balance = balance.Add(decimal.New(u.Value, -decoder.wm.Decimal()))
+		usedUTXO = append(usedUTXO, u)
+		if balance.GreaterThanOrEqual(totalSend) {
+			break
+		}
+	}
+
+	if balance.LessThan(totalSend) {
+		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "address[%s] balance: %s is not enough to set alias", address, balance.StringFixed(decoder.wm.Decimal()))
+	}
+
+	txData, err := nulsio_trans.NewAliasTxData(address, alias)
+	if err != nil {
+		return err
+	}
+
+	//销毁的NULS转入黑洞地址，找零退回设置别名的地址
+	vouts := []nulsio_trans.Vout{
+		{Address: burnAddress, Amount: uint64(burnAmount.Shift(decoder.wm.Decimal()).IntPart())},
+	}
+	changeAmount := balance.Sub(totalSend)
+	if changeAmount.GreaterThan(decimal.Zero) {
+		vouts = append(vouts, nulsio_trans.Vout{Address: address, Amount: uint64(changeAmount.Shift(decoder.wm.Decimal()).IntPart())})
+	}
+
+	rawTx.FeeRate = feesRate.StringFixed(decoder.wm.Decimal())
+	rawTx.Fees = fees.StringFixed(decoder.wm.Decimal())
+	rawTx.TxAmount = "-" + totalSend.StringFixed(decoder.wm.Decimal())
+
+	decoder.wm.Logger(LogSubsystemTx).Info("build alias transaction",
+		"address", address,
+		"alias", alias,
+		"burn", burnAmount.StringFixed(decoder.wm.Decimal()),
+		"fees", fees.StringFixed(decoder.wm.Decimal()),
+		"change", changeAmount.StringFixed(decoder.wm.Decimal()))
+
+	return decoder.createTypedRawTransaction(wrapper, rawTx, TxTypeAlias, usedUTXO, vouts, txData)
+}
@@ -18,16 +18,39 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/blocktree/openwallet/log"
+	"github.com/astaxie/beego/logs"
 	"github.com/imroc/req"
 	"github.com/shopspring/decimal"
 	"github.com/tidwall/gjson"
 	"strconv"
+	"time"
 )
 
+//DefaultRPCURL 默认的jsonrpc接口地址
+const DefaultRPCURL = "https://api.nuls.io"
+
 type Client struct {
 	BaseURL string
+	RPCURL  string //jsonrpc接口地址，为空则使用DefaultRPCURL
 	Debug   bool
+	Metrics Metrics //指标收集器，为nil则不收集
+	Logger  *Logger //结构化日志，为nil则使用默认日志
+}
+
+//rpcURL 获取jsonrpc接口地址
+func (this *Client) rpcURL() string {
+	if len(this.RPCURL) == 0 {
+		return DefaultRPCURL
+	}
+	return this.RPCURL
+}
+
+//logger 获取客户端日志
+func (this *Client) logger() *Logger {
+	if this.Logger == nil {
+		return &Logger{subsystem: LogSubsystemAPI, level: logs.LevelDebug, format: LogFormatText}
+	}
+	return this.Logger
 }
 
 type Response struct {
@@ -67,44 +90,57 @@ func (this *Client) GetUnSpent(address string) ([]*UtxoDto, error) {
 	//	}
 	//}
 
+	utxoDtoList, err := this.GetAllUnSpent(address)
+	if err != nil {
+		return nil, err
+	}
+	height, err := this.GetNewHeight()
+	if err != nil {
+		this.logger().Error("request failed", "method", "GetUnSpent", "err", err)
+		return nil, err
+	}
+	now := time.Now()
+	utxoDtoListResult := make([]*UtxoDto, 0)
+	for _, v := range utxoDtoList {
+		//锁定时间可能是区块高度或毫秒时间戳
+		if v.IsUnlocked(height, now) {
+			utxoDtoListResult = append(utxoDtoListResult, v)
+		}
+	}
+
+	return utxoDtoListResult, nil
+}
+
+//GetAllUnSpent 获取地址全部utxo，包括锁定中的utxo
+func (this *Client) GetAllUnSpent(address string) ([]*UtxoDto, error) {
 	params := []interface{}{
 		address,
 		10000000000000000, //最大值
 	}
 	result, err := this.Call("getUTXO", 1, params)
 	if err != nil {
-		log.Errorf("get block number faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "GetAllUnSpent", "err", err)
 		return nil, err
 	}
 
 	if result.Type != gjson.JSON {
-		log.Errorf("result of block number type error")
+		this.logger().Error("result type error", "method", "GetAllUnSpent")
 		return nil, errors.New("result of block number type error")
 	}
 
 	var utxoDtoList []*UtxoDto
 	err = json.Unmarshal([]byte(result.Raw), &utxoDtoList)
 	if err != nil {
-		log.Errorf("GetBalance decode json [%v] failed, err=%v", []byte(result.Raw), err)
-		return nil, err
-	}
-	height, err := this.GetNewHeight()
-	if err != nil {
-		log.Errorf("GetBalance  GetNewHeight failed, err=%v", []byte(result.Raw), err)
+		this.logger().Error("decode json failed", "method", "GetAllUnSpent", "result", result.Raw, "err", err)
 		return nil, err
 	}
-	utxoDtoListResult := make([]*UtxoDto, 0)
-	if utxoDtoList != nil && len(utxoDtoList) > 0 {
-		for _, v := range utxoDtoList {
-			v.Address = address
-			if v.LockTime < height {
-				utxoDtoListResult = append(utxoDtoListResult, v)
-			}
-		}
+	for _, v := range utxoDtoList {
+		v.Address = address
 	}
 
-	return utxoDtoListResult, nil
+	return utxoDtoList, nil
 }
+
 func (this *Client) GetAddressBalance(address string) (*NulsBalance, error) {
 	params := []interface{}{
 		address,
@@ -120,7 +156,7 @@ func (this *Client) GetAddressBalance(address string) (*NulsBalance, error) {
 	}
 
 	if result.Type != gjson.JSON {
-		log.Errorf("result of block number type error")
+		this.logger().Error("result type error", "method", "GetAddressBalance")
 		return nulsBalance, errors.New("result of block number type error")
 	}
 
@@ -134,16 +170,22 @@ func (this *Client) GetAddressBalance(address string) (*NulsBalance, error) {
 	return nulsBalance, nil
 }
 
+//PingRPC 检查JSON-RPC接口是否可用，查询指定地址的账户信息
+func (this *Client) PingRPC(address string) error {
+	_, err := this.Call("getAccount", 1, []interface{}{address})
+	return err
+}
+
 //获取最新高度
 func (this *Client) GetNewHeight() (int64, error) {
 	result, err := this.CallReq("/api/block/newest/height")
 	if err != nil {
-		log.Errorf("get GetNewHeight faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "GetNewHeight", "err", err)
 		return 0, err
 	}
 
 	if result.Type != gjson.JSON {
-		log.Errorf("result of GetNewHeight type error")
+		this.logger().Error("result type error", "method", "GetNewHeight")
 		return 0, errors.New("result of GetNewBlock type error")
 	}
 
@@ -156,19 +198,19 @@ func (this *Client) GetTokenBalances(contractAddress, address string) (decimal.D
 	target := "/api/contract/balance/token/" + contractAddress + "/" + address
 	result, err := this.CallReq(target)
 	if err != nil {
-		log.Errorf("get GetTokenBalances faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "GetTokenBalances", "err", err)
 		return balance, err
 	}
 
 	if result.Type != gjson.JSON {
-		log.Errorf("result of GetTokenBalances type error")
+		this.logger().Error("result type error", "method", "GetTokenBalances")
 		return balance, errors.New("result of GetNewBlock type error")
 	}
 
 	var tokenBalance *TokenBalance
 	err = json.Unmarshal([]byte(result.Raw), &tokenBalance)
 	if err != nil {
-		log.Errorf("GetBalance decode json [%v] failed, err=%v", []byte(result.Raw), err)
+		this.logger().Error("decode json failed", "method", "GetTokenBalances", "result", result.Raw, "err", err)
 		return balance, err
 	}
 
@@ -198,19 +240,19 @@ func (this *Client) GetTokenBalancesReal(contractAddress, address string) (decim
 	target := "/api/contract/balance/token/" + contractAddress + "/" + address
 	result, err := this.CallReq(target)
 	if err != nil {
-		log.Errorf("get GetTokenBalancesReal faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "GetTokenBalancesReal", "err", err)
 		return balance, err
 	}
 
 	if result.Type != gjson.JSON {
-		log.Errorf("result of GetTokenBalancesReal type error")
+		this.logger().Error("result type error", "method", "GetTokenBalancesReal")
 		return balance, errors.New("result of GetNewBlock type error")
 	}
 
 	var tokenBalance *TokenBalance
 	err = json.Unmarshal([]byte(result.Raw), &tokenBalance)
 	if err != nil {
-		log.Errorf("GetBalance decode json [%v] failed, err=%v", []byte(result.Raw), err)
+		this.logger().Error("decode json failed", "method", "GetTokenBalancesReal", "result", result.Raw, "err", err)
 		return balance, err
 	}
 
@@ -231,18 +273,18 @@ func (this *Client) GetTokenBalancesReal(contractAddress, address string) (decim
 func (this *Client) GetNewBlock() (*NusBlock, error) {
 	result, err := this.CallReq("/api/block/newest")
 	if err != nil {
-		log.Errorf("get GetNewBlock faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "GetNewBlock", "err", err)
 		return nil, err
 	}
 
 	if result.Type != gjson.JSON {
-		log.Errorf("result of GetNewBlock type error")
+		this.logger().Error("result type error", "method", "GetNewBlock")
 		return nil, errors.New("result of GetNewBlock type error")
 	}
 	var nusBlock *NusBlock
 	err = json.Unmarshal([]byte(result.Raw), &nusBlock)
 	if err != nil {
-		log.Errorf("GetNewBlock decode json [%v] failed, err=%v", []byte(result.Raw), err)
+		this.logger().Error("decode json failed", "method", "GetNewBlock", "result", result.Raw, "err", err)
 		return nil, err
 	}
 
@@ -253,19 +295,19 @@ func (this *Client) GetNewBlock() (*NusBlock, error) {
 func (this *Client) GetBlockByHeight(height int64) (*NusBlock, error) {
 	result, err := this.CallReq("/api/block/height/" + strconv.FormatInt(height, 10))
 	if err != nil {
-		log.Errorf("GetBlockByHeight  faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "GetBlockByHeight", "err", err)
 		return nil, err
 	}
 
 	if result.Type != gjson.JSON {
-		log.Errorf("result of GetBlockByHeight type error")
+		this.logger().Error("result type error", "method", "GetBlockByHeight")
 		return nil, errors.New("result of GetBlockByHeight type error")
 	}
 
 	var nusBlock *NusBlock
 	err = json.Unmarshal([]byte(result.Raw), &nusBlock)
 	if err != nil {
-		log.Errorf("GetBlockByHeight decode json [%v] failed, err=%v", []byte(result.Raw), err)
+		this.logger().Error("decode json failed", "method", "GetBlockByHeight", "result", result.Raw, "err", err)
 		return nil, err
 	}
 
@@ -276,19 +318,19 @@ func (this *Client) GetBlockByHeight(height int64) (*NusBlock, error) {
 func (this *Client) GetBlockByHash(hash string) (*NusBlock, error) {
 	result, err := this.CallReq("/api/block/hash/" + hash)
 	if err != nil {
-		log.Errorf("GetBlockByHash  faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "GetBlockByHash", "err", err)
 		return nil, err
 	}
 
 	if result.Type != gjson.JSON {
-		log.Errorf("result of GetBlockByHash type error")
+		this.logger().Error("result type error", "method", "GetBlockByHash")
 		return nil, errors.New("result of GetBlockByHeight type error")
 	}
 
 	var nusBlock *NusBlock
 	err = json.Unmarshal([]byte(result.Raw), &nusBlock)
 	if err != nil {
-		log.Errorf("GetBlockByHash decode json [%v] failed, err=%v", []byte(result.Raw), err)
+		this.logger().Error("decode json failed", "method", "GetBlockByHash", "result", result.Raw, "err", err)
 		return nil, err
 	}
 
@@ -299,35 +341,58 @@ func (this *Client) GetBlockByHash(hash string) (*NusBlock, error) {
 func (this *Client) GetTxByTxId(txId string) (*Tx, error) {
 	result, err := this.CallReq("/api/tx/hash/" + txId)
 	if err != nil {
-		log.Errorf("GetBlockByHash  faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "GetTxByTxId", "err", err)
 		return nil, err
 	}
 
 	if result.Type != gjson.JSON {
-		log.Errorf("result of GetBlockByHash type error")
+		this.logger().Error("result type error", "method", "GetTxByTxId")
 		return nil, errors.New("result of GetBlockByHeight type error")
 	}
 
 	var tx *Tx
 	err = json.Unmarshal([]byte(result.Raw), &tx)
 	if err != nil {
-		log.Errorf("GetBlockByHash decode json [%v] failed, err=%v", []byte(result.Raw), err)
+		this.logger().Error("decode json failed", "method", "GetTxByTxId", "result", result.Raw, "err", err)
 		return nil, err
 	}
 
 	return tx, nil
 }
 
+//获取地址的交易列表，txType为0则查询所有类型
+func (this *Client) GetAddressTxList(address string, txType int64, pageNumber, pageSize int) (*TxPage, error) {
+	result, err := this.CallReq(fmt.Sprintf("/api/tx/list/address?address=%s&type=%d&pageNumber=%d&pageSize=%d", address, txType, pageNumber, pageSize))
+	if err != nil {
+		this.logger().Error("request failed", "method", "GetAddressTxList", "err", err)
+		return nil, err
+	}
+
+	if result.Type != gjson.JSON {
+		this.logger().Error("result type error", "method", "GetAddressTxList")
+		return nil, errors.New("result of GetAddressTxList type error")
+	}
+
+	var page *TxPage
+	err = json.Unmarshal([]byte(result.Raw), &page)
+	if err != nil {
+		this.logger().Error("decode json failed", "method", "GetAddressTxList", "result", result.Raw, "err", err)
+		return nil, err
+	}
+
+	return page, nil
+}
+
 //通过tx获取合约
 func (this *Client) GetTokenByHash(hash string) ([]*NulsToken, error) {
 	result, err := this.CallReq("/api/contract/result/" + hash)
 	if err != nil {
-		log.Errorf("GetTokenByHash  faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "GetTokenByHash", "err", err)
 		return nil, err
 	}
 
 	if result.Type != gjson.JSON {
-		log.Errorf("result of GetTokenByHash type error")
+		this.logger().Error("result type error", "method", "GetTokenByHash")
 		return nil, errors.New("result of GetTokenByHash type error")
 	}
 
@@ -346,7 +411,7 @@ func (this *Client) GetTokenByHash(hash string) ([]*NulsToken, error) {
 	var nulsTokens []*NulsToken
 	err = json.Unmarshal([]byte(tokenTransfers), &nulsTokens)
 	if err != nil {
-		log.Errorf("GetTokenByHash decode json [%v] failed, err=%v", []byte(result.Raw), err)
+		this.logger().Error("decode json failed", "method", "GetTokenByHash", "result", result.Raw, "err", err)
 		return nil, err
 	}
 
@@ -359,6 +424,197 @@ func (this *Client) GetTokenByHash(hash string) ([]*NulsToken, error) {
 	return nulsTokens, nil
 }
 
+//调用合约只读方法
+func (this *Client) InvokeContractView(contractAddress, methodName, methodDesc string, args []string) (string, error) {
+
+	params := make(map[string]interface{})
+	params["contractAddress"] = contractAddress
+	params["methodName"] = methodName
+	params["methodDesc"] = methodDesc
+	params["args"] = args
+	result, err := this.CallPost("/api/contract/view", params)
+	if err != nil {
+		this.logger().Error("request failed", "method", "InvokeContractView", "err", err)
+		return "", err
+	}
+
+	if result.Type != gjson.JSON {
+		this.logger().Error("result type error", "method", "InvokeContractView")
+		return "", errors.New("result of InvokeContractView type error")
+	}
+
+	if !result.Get("result").Exists() {
+		return "", errors.New("contract view result is empty")
+	}
+
+	return result.Get("result").String(), nil
+}
+
+//估算合约调用消耗的gas
+func (this *Client) ImputedGasCallContract(sender, contractAddress, methodName string, value, price uint64, args []interface{}) (uint64, error) {
+
+	params := make(map[string]interface{})
+	params["sender"] = sender
+	params["value"] = value
+	params["price"] = price
+	params["contractAddress"] = contractAddress
+	params["methodName"] = methodName
+	params["methodDesc"] = ""
+	params["args"] = args
+	result, err := this.CallPost("/api/contract/imputedgas/call", params)
+	if err != nil {
+		this.logger().Error("request failed", "method", "ImputedGasCallContract", "err", err)
+		return 0, err
+	}
+
+	if result.Type != gjson.JSON {
+		this.logger().Error("result type error", "method", "ImputedGasCallContract")
+		return 0, errors.New("result of ImputedGasCallContract type error")
+	}
+
+	if !result.Get("gasLimit").Exists() {
+		return 0, errors.New("imputed gas limit is empty")
+	}
+
+	return result.Get("gasLimit").Uint(), nil
+}
+
+//验证合约调用是否可执行
+func (this *Client) ValidateCallContract(sender, contractAddress, methodName string, value, gasLimit, price uint64, args []interface{}) error {
+
+	params := make(map[string]interface{})
+	params["sender"] = sender
+	params["value"] = value
+	params["gasLimit"] = gasLimit
+	params["price"] = price
+	params["contractAddress"] = contractAddress
+	params["methodName"] = methodName
+	params["methodDesc"] = ""
+	params["args"] = args
+	_, err := this.CallPost("/api/contract/validate/call", params)
+	if err != nil {
+		this.logger().Error("request failed", "method", "ValidateCallContract", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+//通过tx获取合约执行结果
+func (this *Client) GetContractResult(hash string) (*ContractResult, error) {
+	result, err := this.CallReq("/api/contract/result/" + hash)
+	if err != nil {
+		this.logger().Error("request failed", "method", "GetContractResult", "err", err)
+		return nil, err
+	}
+
+	if result.Type != gjson.JSON {
+		this.logger().Error("result type error", "method", "GetContractResult")
+		return nil, errors.New("result of GetContractResult type error")
+	}
+
+	if !result.Get("data").Exists() {
+		return nil, errors.New("can't find the contract result")
+	}
+
+	var contractResult *ContractResult
+	err = json.Unmarshal([]byte(result.Get("data").Raw), &contractResult)
+	if err != nil {
+		this.logger().Error("decode json failed", "method", "GetContractResult", "result", result.Raw, "err", err)
+		return nil, err
+	}
+
+	contractResult.Hash = hash
+	for _, v := range contractResult.TokenTransfers {
+		v.Hash = hash
+	}
+
+	return contractResult, nil
+}
+
+//别名是否可用
+func (this *Client) IsAliasUsable(alias string) (bool, error) {
+	result, err := this.CallReq("/api/account/alias/isAliasUsable?alias=" + alias)
+	if err != nil {
+		this.logger().Error("request failed", "method", "IsAliasUsable", "err", err)
+		return false, err
+	}
+
+	if result.Type != gjson.JSON {
+		this.logger().Error("result type error", "method", "IsAliasUsable")
+		return false, errors.New("result of IsAliasUsable type error")
+	}
+
+	return result.Get("value").Bool(), nil
+}
+
+//通过别名获取地址
+func (this *Client) GetAddressByAlias(alias string) (string, error) {
+	result, err := this.CallReq("/api/account/alias/address?alias=" + alias)
+	if err != nil {
+		this.logger().Error("request failed", "method", "GetAddressByAlias", "err", err)
+		return "", err
+	}
+
+	if result.Type != gjson.JSON {
+		this.logger().Error("result type error", "method", "GetAddressByAlias")
+		return "", errors.New("result of GetAddressByAlias type error")
+	}
+
+	address := result.Get("address").String()
+	if len(address) == 0 {
+		return "", fmt.Errorf("alias[%s] is not registered", alias)
+	}
+
+	return address, nil
+}
+
+//获取地址的委托列表
+func (this *Client) GetAccountDeposits(address string, pageNumber, pageSize int) (*DepositPage, error) {
+	result, err := this.CallReq(fmt.Sprintf("/api/consensus/deposit/address/%s?pageNumber=%d&pageSize=%d", address, pageNumber, pageSize))
+	if err != nil {
+		this.logger().Error("request failed", "method", "GetAccountDeposits", "err", err)
+		return nil, err
+	}
+
+	if result.Type != gjson.JSON {
+		this.logger().Error("result type error", "method", "GetAccountDeposits")
+		return nil, errors.New("result of GetAccountDeposits type error")
+	}
+
+	var page *DepositPage
+	err = json.Unmarshal([]byte(result.Raw), &page)
+	if err != nil {
+		this.logger().Error("decode json failed", "method", "GetAccountDeposits", "result", result.Raw, "err", err)
+		return nil, err
+	}
+
+	return page, nil
+}
+
+//获取共识节点信息
+func (this *Client) GetAgent(agentHash string) (*Agent, error) {
+	result, err := this.CallReq("/api/consensus/agent/" + agentHash)
+	if err != nil {
+		this.logger().Error("request failed", "method", "GetAgent", "err", err)
+		return nil, err
+	}
+
+	if result.Type != gjson.JSON {
+		this.logger().Error("result type error", "method", "GetAgent")
+		return nil, errors.New("result of GetAgent type error")
+	}
+
+	var agent *Agent
+	err = json.Unmarshal([]byte(result.Raw), &agent)
+	if err != nil {
+		this.logger().Error("decode json failed", "method", "GetAgent", "result", result.Raw, "err", err)
+		return nil, err
+	}
+
+	return agent, nil
+}
+
 //广播交易
 func (this *Client) VaildTransaction(hex string) (bool, error) {
 
@@ -366,7 +622,7 @@ func (this *Client) VaildTransaction(hex string) (bool, error) {
 	params["txHex"] = hex
 	_, err := this.CallPost("/api/accountledger/transaction/valiTransaction", params)
 	if err != nil {
-		log.Errorf("VaildTransaction  faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "VaildTransaction", "err", err)
 		return false, err
 	}
 
@@ -380,23 +636,35 @@ func (this *Client) SendRawTransaction(hex string) (string, error) {
 	params["txHex"] = hex
 	result, err := this.CallPost("/api/accountledger/transaction/broadcast", params)
 	if err != nil {
-		log.Errorf("SendRawTransaction  faield, err = %v \n", err)
+		this.logger().Error("request failed", "method", "SendRawTransaction", "err", err)
 		return "", err
 	}
-	log.Warn("result:", result)
 	if result.Type != gjson.JSON {
-		log.Errorf("result of SendRawTransaction type error")
+		this.logger().Error("result type error", "method", "SendRawTransaction")
 		return "", errors.New("result of SendRawTransaction type error")
 	}
 
 	if result.Get("value").Exists() {
+		this.logger().Info("transaction broadcast", "txid", result.Get("value").String())
 		return result.Get("value").String(), nil
 	}
 
+	this.logger().Error("transaction broadcast failed", "result", result.Raw)
 	return "", errors.New("unknow error")
 }
 
+//Call 调用jsonrpc接口，记录请求指标
 func (c *Client) Call(method string, id int64, params []interface{}) (*gjson.Result, error) {
+	start := time.Now()
+	result, err := c.call(method, id, params)
+	observeAPI(c.Metrics, method, start, err)
+	if c.Debug {
+		c.logger().Debug("api request", "method", method, "latency", time.Since(start), "err", err)
+	}
+	return result, err
+}
+
+func (c *Client) call(method string, id int64, params []interface{}) (*gjson.Result, error) {
 	authHeader := req.Header{
 		"Accept":       "application/json",
 		"Content-Type": "application/json",
@@ -407,22 +675,13 @@ func (c *Client) Call(method string, id int64, params []interface{}) (*gjson.Res
 	body["method"] = method
 	body["params"] = params
 
-	if c.Debug {
-		log.Debug("Start Request API...")
-	}
-
-	r, err := req.Post("https://api.nuls.io", req.BodyJSON(&body), authHeader)
-
-	if c.Debug {
-		log.Debug("Request API Completed")
+	r, err := req.Post(c.rpcURL(), req.BodyJSON(&body), authHeader)
+	if err != nil {
+		return nil, err
 	}
 
 	if c.Debug {
-		log.Debugf("%+v\n", r)
-	}
-
-	if err != nil {
-		return nil, err
+		c.logger().Debug("api response", "url", r.Request().URL.Path, "status", r.Response().StatusCode, "body", r.String())
 	}
 
 	resp := gjson.ParseBytes(r.Bytes())
@@ -436,27 +695,30 @@ func (c *Client) Call(method string, id int64, params []interface{}) (*gjson.Res
 	return &result, nil
 }
 
+//CallPost 调用POST接口，记录请求指标
 func (c *Client) CallPost(url string, params map[string]interface{}) (*gjson.Result, error) {
+	start := time.Now()
+	result, err := c.callPost(url, params)
+	observeAPI(c.Metrics, apiMethodLabel(url), start, err)
+	if c.Debug {
+		c.logger().Debug("api request", "method", apiMethodLabel(url), "latency", time.Since(start), "err", err)
+	}
+	return result, err
+}
+
+func (c *Client) callPost(url string, params map[string]interface{}) (*gjson.Result, error) {
 	authHeader := req.Header{
 		"Accept":       "application/json",
 		"Content-Type": "application/json",
 	}
 
-	if c.Debug {
-		log.Debug("Start Request API...")
-	}
-
 	r, err := req.Post(c.BaseURL+url, req.BodyJSON(&params), authHeader)
 
 	if err != nil {
 		return nil, err
 	}
 	if c.Debug {
-		log.Debug("Request API Completed")
-	}
-
-	if c.Debug {
-		log.Debugf("%+v\n", r)
+		c.logger().Debug("api response", "url", r.Request().URL.Path, "status", r.Response().StatusCode, "body", r.String())
 	}
 
 	resp := gjson.ParseBytes(r.Bytes())
@@ -470,22 +732,25 @@ func (c *Client) CallPost(url string, params map[string]interface{}) (*gjson.Res
 	return &result, nil
 }
 
+//CallReq 调用GET接口，记录请求指标
 func (c *Client) CallReq(method string) (*gjson.Result, error) {
-
+	start := time.Now()
+	result, err := c.callReq(method)
+	observeAPI(c.Metrics, apiMethodLabel(method), start, err)
 	if c.Debug {
-		log.Debug("Start Request API...")
+		c.logger().Debug("api request", "method", apiMethodLabel(method), "latency", time.Since(start), "err", err)
 	}
+	return result, err
+}
+
+func (c *Client) callReq(method string) (*gjson.Result, error) {
 
 	r, err := req.Get(c.BaseURL + method)
 	if err != nil {
 		return nil, err
 	}
 	if c.Debug {
-		log.Debug("Request API Completed")
-	}
-
-	if c.Debug {
-		log.Debugf("%+v\n", r)
+		c.logger().Debug("api response", "url", r.Request().URL.Path, "status", r.Response().StatusCode, "body", r.String())
 	}
 
 	if err != nil {
@@ -0,0 +1,349 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/crypto"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	BackfillStatusRunning  = "running"
+	BackfillStatusFinished = "finished"
+	BackfillStatusFailed   = "failed"
+	BackfillStatusCanceled = "canceled"
+
+	//backfillMaxAttempts 回扫任务单个区块的最大尝试次数
+	backfillMaxAttempts = 3
+	//backfillRetryInterval 回扫任务区块失败后重试的等待时间
+	backfillRetryInterval = 5 * time.Second
+)
+
+//BackfillTask 历史区块回扫任务，只通知指定扫描对象的提取数据，不影响实时扫描
+type BackfillTask struct {
+	ID          string
+	Addresses   []string //回扫的地址，使用扫描对象回扫时为空
+	StartHeight uint64
+	EndHeight   uint64
+
+	mu            sync.RWMutex
+	scanAddress   openwallet.BlockScanAddressFunc
+	retryInterval time.Duration
+	scannedHeight uint64 //已完成扫描的高度
+	extracted     int    //已通知的提取数据数量
+	status        string
+	err           string
+	startAt       int64
+	finishAt      int64
+	quit          chan struct{}
+}
+
+//BackfillProgress 回扫任务进度
+type BackfillProgress struct {
+	ID            string   `json:"id"`
+	Addresses     []string `json:"addresses,omitempty"`
+	StartHeight   uint64   `json:"startHeight"`
+	EndHeight     uint64   `json:"endHeight"`
+	ScannedHeight uint64   `json:"scannedHeight"`
+	Scanned       uint64   `json:"scanned"`
+	Total         uint64   `json:"total"`
+	Extracted     int      `json:"extracted"`
+	Status        string   `json:"status"`
+	Error         string   `json:"error,omitempty"`
+	StartAt       int64    `json:"startAt"`
+	FinishAt      int64    `json:"finishAt,omitempty"`
+}
+
+//Progress 获取回扫任务进度
+func (task *BackfillTask) Progress() *BackfillProgress {
+	task.mu.RLock()
+	defer task.mu.RUnlock()
+
+	progress := &BackfillProgress{
+		ID:            task.ID,
+		Addresses:     task.Addresses,
+		StartHeight:   task.StartHeight,
+		EndHeight:     task.EndHeight,
+		ScannedHeight: task.scannedHeight,
+		Total:         task.EndHeight - task.StartHeight + 1,
+		Extracted:     task.extracted,
+		Status:        task.status,
+		Error:         task.err,
+		StartAt:       task.startAt,
+		FinishAt:      task.finishAt,
+	}
+	if task.scannedHeight >= task.StartHeight {
+		progress.Scanned = task.scannedHeight - task.StartHeight + 1
+	}
+	return progress
+}
+
+//finish 结束回扫任务
+func (task *BackfillTask) finish(status, reason string) {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	task.status = status
+	task.err = reason
+	task.finishAt = time.Now().Unix()
+}
+
+//scanned 记录已完成扫描的高度
+func (task *BackfillTask) scanned(height uint64, extracted int) {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	task.scannedHeight = height
+	task.extracted += extracted
+}
+
+//BackfillAddresses 回扫指定高度范围内地址的历史交易，地址对应的sourceKey由区块扫描的地址算法获取
+func (bs *NULSBlockScanner) BackfillAddresses(addresses []string, startHeight, endHeight uint64) (*BackfillTask, error) {
+
+	if len(addresses) == 0 {
+		return nil, errors.New("backfill addresses is empty")
+	}
+
+	if bs.ScanAddressFunc == nil {
+		return nil, errors.New("block scanner scan address func is not set")
+	}
+
+	addressSet := make(map[string]bool)
+	for _, a := range addresses {
+		addressSet[a] = true
+	}
+
+	scanAddressFunc := func(address string) (string, bool) {
+		if !addressSet[address] {
+			return "", false
+		}
+		return bs.ScanAddressFunc(address)
+	}
+
+	return bs.startBackfill(addresses, scanAddressFunc, startHeight, endHeight)
+}
+
+//BackfillTargets 回扫指定高度范围内扫描对象的历史交易
+func (bs *NULSBlockScanner) BackfillTargets(scanTargetFunc openwallet.BlockScanTargetFunc, startHeight, endHeight uint64) (*BackfillTask, error) {
+
+	if scanTargetFunc == nil {
+		return nil, errors.New("backfill scan target func is nil")
+	}
+
+	scanAddressFunc := func(address string) (string, bool) {
+		target := openwallet.ScanTarget{
+			Address:          address,
+			BalanceModelType: openwallet.BalanceModelTypeAddress,
+		}
+		return scanTargetFunc(target)
+	}
+
+	return bs.startBackfill(nil, scanAddressFunc, startHeight, endHeight)
+}
+
+//startBackfill 创建并启动回扫任务，endHeight为0则回扫到当前最新高度
+func (bs *NULSBlockScanner) startBackfill(addresses []string, scanAddressFunc openwallet.BlockScanAddressFunc, startHeight, endHeight uint64) (*BackfillTask, error) {
+
+	if startHeight == 0 {
+		return nil, errors.New("backfill start height must greater than 0")
+	}
+
+	maxHeight, err := bs.wm.GetBlockHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	if endHeight == 0 || endHeight > maxHeight {
+		endHeight = maxHeight
+	}
+
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("backfill start height: %d is greater than end height: %d", startHeight, endHeight)
+	}
+
+	now := time.Now()
+	task := &BackfillTask{
+		ID:          common.Bytes2Hex(crypto.SHA256([]byte(fmt.Sprintf("backfill_%d_%d_%d", startHeight, endHeight, now.UnixNano())))),
+		Addresses:   addresses,
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+		scanAddress:   scanAddressFunc,
+		retryInterval: backfillRetryInterval,
+		status:        BackfillStatusRunning,
+		startAt:     now.Unix(),
+		quit:        make(chan struct{}),
+	}
+
+	bs.backfillMu.Lock()
+	bs.backfillTasks[task.ID] = task
+	bs.backfillMu.Unlock()
+
+	bs.logger().Info("backfill task start", "task", task.ID, "start", startHeight, "end", endHeight)
+
+	go bs.runBackfill(task)
+
+	return task, nil
+}
+
+//runBackfill 按高度顺序回扫区块，与实时扫描并行执行，区块失败时在任务内使用任务的扫描对象重试
+func (bs *NULSBlockScanner) runBackfill(task *BackfillTask) {
+
+	for height := task.StartHeight; height <= task.EndHeight; height++ {
+
+		var (
+			extracted int
+			err       error
+		)
+		for attempt := 1; attempt <= backfillMaxAttempts; attempt++ {
+
+			select {
+			case <-task.quit:
+				bs.logger().Info("backfill task canceled", "task", task.ID, "height", height)
+				task.finish(BackfillStatusCanceled, "")
+				return
+			default:
+			}
+
+			extracted, err = bs.backfillBlock(task, height)
+			if err == nil {
+				break
+			}
+
+			bs.logger().Warn("backfill block failed", "task", task.ID, "height", height, "attempt", attempt, "err", err)
+			if attempt < backfillMaxAttempts {
+				select {
+				case <-task.quit:
+				case <-time.After(task.retryInterval):
+				}
+			}
+		}
+
+		if err != nil {
+			bs.logger().Error("backfill task failed", "task", task.ID, "height", height, "err", err)
+			task.finish(BackfillStatusFailed, fmt.Sprintf("height: %d, %v", height, err))
+			return
+		}
+
+		task.scanned(height, extracted)
+	}
+
+	bs.logger().Info("backfill task finished", "task", task.ID)
+	task.finish(BackfillStatusFinished, "")
+}
+
+//backfillBlock 回扫一个区块，通知扫描对象的提取数据，返回通知的数量
+//已通知记录以任务ID为范围，实时扫描已通知过的交易也会通知回扫地址的数据，任务内重试不会重复通知
+func (bs *NULSBlockScanner) backfillBlock(task *BackfillTask, height uint64) (int, error) {
+
+	hash, err := bs.wm.GetBlockHash(height)
+	if err != nil {
+		return 0, err
+	}
+
+	block, err := bs.wm.GetBlock(hash)
+	if err != nil {
+		return 0, err
+	}
+
+	extracted := 0
+	for _, tx := range block.TxList {
+		result := bs.ExtractTransaction(height, hash, tx, task.scanAddress)
+		if !result.Success {
+			return extracted, fmt.Errorf("extract transaction [%s] failed: %s", result.TxID, result.Reason)
+		}
+
+		if err = bs.notifyExtractData(task.ID, height, result.TxID, result.extractData); err != nil {
+			return extracted, fmt.Errorf("notify transaction [%s] failed: %v", result.TxID, err)
+		}
+		if err = bs.notifyExtractData(task.ID, height, result.TxID, result.extractContractData); err != nil {
+			return extracted, fmt.Errorf("notify transaction [%s] failed: %v", result.TxID, err)
+		}
+		extracted += len(result.extractData) + len(result.extractContractData)
+	}
+
+	return extracted, nil
+}
+
+//GetBackfillTask 获取回扫任务进度
+func (bs *NULSBlockScanner) GetBackfillTask(id string) (*BackfillProgress, error) {
+	bs.backfillMu.RLock()
+	defer bs.backfillMu.RUnlock()
+
+	task, ok := bs.backfillTasks[id]
+	if !ok {
+		return nil, fmt.Errorf("backfill task [%s] not found", id)
+	}
+	return task.Progress(), nil
+}
+
+//GetBackfillTasks 获取所有回扫任务进度，按开始时间排序
+func (bs *NULSBlockScanner) GetBackfillTasks() []*BackfillProgress {
+	bs.backfillMu.RLock()
+	defer bs.backfillMu.RUnlock()
+
+	list := make([]*BackfillProgress, 0, len(bs.backfillTasks))
+	for _, task := range bs.backfillTasks {
+		list = append(list, task.Progress())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartAt < list[j].StartAt
+	})
+	return list
+}
+
+//CancelBackfill 取消运行中的回扫任务
+func (bs *NULSBlockScanner) CancelBackfill(id string) error {
+	bs.backfillMu.Lock()
+	defer bs.backfillMu.Unlock()
+
+	task, ok := bs.backfillTasks[id]
+	if !ok {
+		return fmt.Errorf("backfill task [%s] not found", id)
+	}
+
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	if task.status != BackfillStatusRunning {
+		return fmt.Errorf("backfill task [%s] is %s", id, task.status)
+	}
+	select {
+	case <-task.quit:
+	default:
+		close(task.quit)
+	}
+	return nil
+}
+
+//RemoveBackfillTask 删除已结束的回扫任务
+func (bs *NULSBlockScanner) RemoveBackfillTask(id string) error {
+	bs.backfillMu.Lock()
+	defer bs.backfillMu.Unlock()
+
+	task, ok := bs.backfillTasks[id]
+	if !ok {
+		return fmt.Errorf("backfill task [%s] not found", id)
+	}
+	if task.Progress().Status == BackfillStatusRunning {
+		return fmt.Errorf("backfill task [%s] is running", id)
+	}
+	delete(bs.backfillTasks, id)
+	return nil
+}
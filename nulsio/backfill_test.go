@@ -0,0 +1,185 @@
+package nulsio
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//testFlakyObserver 第一次通知失败的观测者
+type testFlakyObserver struct {
+	testNotifyObserver
+	calls int
+}
+
+func (o *testFlakyObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.calls++
+	if o.calls == 1 {
+		return fmt.Errorf("observer is down")
+	}
+	return o.testNotifyObserver.BlockExtractDataNotify(sourceKey, data)
+}
+
+func TestNULSBlockScanner_BackfillArguments(t *testing.T) {
+
+	bs := NewNULSBlockScanner(testStateWalletManager())
+
+	if _, err := bs.BackfillAddresses(nil, 1, 10); err == nil {
+		t.Errorf("BackfillAddresses should fail with empty addresses")
+	}
+	if _, err := bs.BackfillAddresses([]string{"addr"}, 1, 10); err == nil {
+		t.Errorf("BackfillAddresses should fail without scan address func")
+	}
+	if _, err := bs.BackfillTargets(nil, 1, 10); err == nil {
+		t.Errorf("BackfillTargets should fail with nil scan target func")
+	}
+
+	bs.ScanAddressFunc = func(address string) (string, bool) {
+		return "account", true
+	}
+	if _, err := bs.BackfillAddresses([]string{"addr"}, 0, 10); err == nil {
+		t.Errorf("BackfillAddresses should fail with start height 0")
+	}
+}
+
+func TestNULSBlockScanner_BackfillTask(t *testing.T) {
+
+	bs := NewNULSBlockScanner(testStateWalletManager())
+	task := &BackfillTask{
+		ID:          "task",
+		StartHeight: 11,
+		EndHeight:   20,
+		status:      BackfillStatusRunning,
+		quit:        make(chan struct{}),
+	}
+	bs.backfillTasks[task.ID] = task
+
+	task.scanned(15, 3)
+	progress, err := bs.GetBackfillTask("task")
+	if err != nil || progress.Scanned != 5 || progress.Total != 10 || progress.Extracted != 3 {
+		t.Errorf("GetBackfillTask = %+v, err: %v", progress, err)
+	}
+
+	if err = bs.RemoveBackfillTask("task"); err == nil {
+		t.Errorf("RemoveBackfillTask should fail on running task")
+	}
+	if err = bs.CancelBackfill("task"); err != nil {
+		t.Errorf("CancelBackfill failed, err: %v", err)
+	}
+	select {
+	case <-task.quit:
+	default:
+		t.Errorf("task quit channel should be closed")
+	}
+
+	task.finish(BackfillStatusCanceled, "")
+	if err = bs.CancelBackfill("task"); err == nil {
+		t.Errorf("CancelBackfill should fail on canceled task")
+	}
+	if err = bs.RemoveBackfillTask("task"); err != nil {
+		t.Errorf("RemoveBackfillTask failed, err: %v", err)
+	}
+	if len(bs.GetBackfillTasks()) != 0 {
+		t.Errorf("backfill tasks should be empty")
+	}
+}
+
+func TestNULSBlockScanner_BackfillRetry(t *testing.T) {
+
+	wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {
+		var data interface{}
+		switch r.URL.Path {
+		case "/api/block/height/1":
+			data = &NusBlock{Height: 1, Hash: "h1"}
+		case "/api/block/hash/h1":
+			data = &NusBlock{Height: 1, Hash: "h1", TxList: []*Tx{{Hash: "tx1", Type: TxTypeTransfer, BlockHeight: 1,
+				Inputs: []*Input{{FromHash: "tx0", FromIndex: 0, Value: 300000000, Address: "other"}},
+				Outputs: []*Output{
+					{Address: "addrA", Value: 100000000},
+					{Address: "addrB", Value: 100000000},
+				}}}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+	})
+	defer server.Close()
+	bs := wm.Blockscanner
+
+	stable := &testNotifyObserver{id: "stable", notified: make(map[string]int)}
+	flaky := &testFlakyObserver{testNotifyObserver: testNotifyObserver{id: "flaky", notified: make(map[string]int)}}
+	bs.AddObserver(stable)
+	bs.AddObserver(flaky)
+
+	//实时扫描已通知过该交易的账户数据
+	storage, _ := wm.GetStorage()
+	storage.SaveNotifyRecord(NewNotifyRecord(1, "stable", "tx1", "account", ""))
+	storage.SaveNotifyRecord(NewNotifyRecord(1, "flaky", "tx1", "account", ""))
+
+	//回扫新增的地址addrB
+	task := &BackfillTask{
+		ID:          "task",
+		Addresses:   []string{"addrB"},
+		StartHeight: 1,
+		EndHeight:   1,
+		scanAddress: func(address string) (string, bool) {
+			return "account", address == "addrB"
+		},
+		retryInterval: time.Millisecond,
+		status:        BackfillStatusRunning,
+		quit:          make(chan struct{}),
+	}
+	bs.runBackfill(task)
+
+	progress := task.Progress()
+	if progress.Status != BackfillStatusFinished || progress.Extracted != 1 {
+		t.Errorf("backfill progress = %+v", progress)
+	}
+	//失败的观测者在任务内重试，已成功的观测者不重复通知
+	if stable.notified["account"] != 1 || flaky.notified["account"] != 1 || flaky.calls != 2 {
+		t.Errorf("notified = %v, %v, flaky calls = %d", stable.notified, flaky.notified, flaky.calls)
+	}
+	//回扫失败不交给实时扫描重扫
+	if records, _ := wm.GetUnscanRecords(); len(records) != 0 {
+		t.Errorf("unscan records = %+v, want none", records)
+	}
+}
+
+func TestNULSBlockScanner_BackfillNotifyFailed(t *testing.T) {
+
+	wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {
+		var data interface{}
+		switch r.URL.Path {
+		case "/api/block/height/1":
+			data = &NusBlock{Height: 1, Hash: "h1"}
+		case "/api/block/hash/h1":
+			data = &NusBlock{Height: 1, Hash: "h1", TxList: []*Tx{{Hash: "tx1", Type: TxTypeTransfer, BlockHeight: 1,
+				Inputs:  []*Input{{FromHash: "tx0", FromIndex: 0, Value: 300000000, Address: "other"}},
+				Outputs: []*Output{{Address: "addrB", Value: 100000000}}}}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+	})
+	defer server.Close()
+	bs := wm.Blockscanner
+	bs.AddObserver(&testNotifyObserver{id: "down", fail: true, notified: make(map[string]int)})
+
+	task := &BackfillTask{
+		ID:          "task",
+		StartHeight: 1,
+		EndHeight:   1,
+		scanAddress: func(address string) (string, bool) {
+			return "account", address == "addrB"
+		},
+		retryInterval: time.Millisecond,
+		status:        BackfillStatusRunning,
+		quit:          make(chan struct{}),
+	}
+	bs.runBackfill(task)
+
+	//通知失败不计入已通知数量，任务失败
+	if progress := task.Progress(); progress.Status != BackfillStatusFailed || progress.Extracted != 0 {
+		t.Errorf("backfill progress = %+v", progress)
+	}
+}
@@ -18,12 +18,11 @@ package nulsio
 import (
 	"errors"
 	"fmt"
-	"github.com/asdine/storm"
 	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
-	"path/filepath"
-	"strings"
+	"reflect"
+	"sync"
 	"time"
 )
 
@@ -37,11 +36,16 @@ const (
 type NULSBlockScanner struct {
 	*openwallet.BlockScannerBase
 
-	CurrentBlockHeight   uint64         //当前区块高度
-	extractingCH         chan struct{}  //扫描工作令牌
-	wm                   *WalletManager //钱包管理者
-	IsScanMemPool        bool           //是否扫描交易池
-	RescanLastBlockCount uint64         //重扫上N个区块数量
+	CurrentBlockHeight   uint64                   //当前区块高度
+	extractingCH         chan struct{}            //扫描工作令牌
+	wm                   *WalletManager           //钱包管理者
+	IsScanMemPool        bool                     //是否扫描交易池
+	RescanLastBlockCount uint64                   //重扫上N个区块数量
+	lastCompactTime      time.Time                //上次压缩本地数据库的时间
+	backfillTasks        map[string]*BackfillTask //历史区块回扫任务
+	backfillMu           sync.RWMutex
+	lastBlock            *ScannedBlock //最近一次成功扫描的区块
+	lastBlockMu          sync.RWMutex
 }
 
 //ExtractResult 扫描完成的提取结果
@@ -51,6 +55,7 @@ type ExtractResult struct {
 	TxID                string
 	BlockHeight         uint64
 	Success             bool
+	Reason              string //提取失败的原因
 }
 
 //SaveResult 保存结果
@@ -70,6 +75,7 @@ func NewNULSBlockScanner(wm *WalletManager) *NULSBlockScanner {
 	bs.wm = wm
 	bs.IsScanMemPool = false
 	bs.RescanLastBlockCount = 5
+	bs.backfillTasks = make(map[string]*BackfillTask)
 
 	//设置扫描任务
 	bs.SetTask(bs.ScanBlockTask)
@@ -77,6 +83,11 @@ func NewNULSBlockScanner(wm *WalletManager) *NULSBlockScanner {
 	return &bs
 }
 
+//logger 区块扫描器的结构化日志
+func (bs *NULSBlockScanner) logger() *Logger {
+	return bs.wm.Logger(LogSubsystemScanner)
+}
+
 //SetRescanBlockHeight 重置区块链扫描高度
 func (bs *NULSBlockScanner) SetRescanBlockHeight(height uint64) error {
 	height = height - 1
@@ -100,13 +111,17 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 	//获取本地区块高度
 	blockHeader, err := bs.GetScannedBlockHeader()
 	if err != nil {
-		bs.wm.Log.Std.Info("block scanner can not get new block height; unexpected error: %v", err)
+		bs.logger().Error("get scanned block header failed", "err", err)
 		return
 	}
 
 	currentHeight := blockHeader.Height
 	currentHash := blockHeader.Hash
 
+	metrics := bs.wm.GetMetrics()
+	taskStart := time.Now()
+	scannedCount := 0
+
 	for {
 
 		if !bs.Scanning {
@@ -118,36 +133,47 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 		maxHeight, err := bs.wm.GetBlockHeight()
 		if err != nil {
 			//下一个高度找不到会报异常
-			bs.wm.Log.Std.Info("block scanner can not get rpc-server block height; unexpected error: %v", err)
+			bs.logger().Error("get chain block height failed", "err", err)
 			break
 		}
+		metrics.SetGauge(MetricChainHeight, float64(maxHeight))
+		if maxHeight > currentHeight {
+			metrics.SetGauge(MetricScanLag, float64(maxHeight-currentHeight))
+		} else {
+			metrics.SetGauge(MetricScanLag, 0)
+		}
 
 		//是否已到最新高度
 		if currentHeight >= maxHeight {
-			bs.wm.Log.Std.Info("block scanner has scanned full chain data. Current height: %d", maxHeight)
+			bs.logger().Info("scanned full chain data", "height", maxHeight)
 			break
 		}
 
 		//继续扫描下一个区块
 		currentHeight = currentHeight + 1
 
-		bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
+		bs.logger().Info("scanning block", "height", currentHeight)
 
 		hash, err := bs.wm.GetBlockHash(currentHeight)
 		if err != nil {
 			//下一个高度找不到会报异常
-			bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
+			bs.logger().Info("get block hash failed", "height", currentHeight, "err", err)
+			break
+		}
+
+		//区块hash与检查点不一致，节点可能不在可信的链上，停止扫描
+		if err = bs.wm.VerifyCheckpoint(currentHeight, hash); err != nil {
+			bs.logger().Error("block scanner stopped", "height", currentHeight, "hash", hash, "err", err)
 			break
 		}
 
 		block, err := bs.wm.GetBlock(hash)
 		if err != nil {
-			bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
+			bs.logger().Error("get block failed", "height", currentHeight, "hash", hash, "err", err)
 
 			//记录未扫区块
 			unscanRecord := NewUnscanRecord(currentHeight, "", err.Error())
 			bs.SaveUnscanRecord(unscanRecord)
-			bs.wm.Log.Std.Info("block height: %d extract failed.", currentHeight)
 			continue
 		}
 
@@ -156,11 +182,8 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 		//判断hash是否上一区块的hash
 		if currentHash != block.PreHash {
 
-			bs.wm.Log.Std.Info("block has been fork on height: %d.", currentHeight)
-			bs.wm.Log.Std.Info("block height: %d local hash = %s ", currentHeight-1, currentHash)
-			bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", currentHeight-1, block.PreHash)
-
-			bs.wm.Log.Std.Info("delete recharge records on block height: %d.", currentHeight-1)
+			bs.logger().Warn("block forked", "height", currentHeight, "localHash", currentHash, "mainnetHash", block.PreHash)
+			metrics.AddCounter(MetricForks, 1)
 
 			//查询本地分叉的区块
 			forkBlock, _ := bs.wm.GetLocalBlock(currentHeight - 1)
@@ -169,6 +192,8 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 			//bs.DeleteRechargesByHeight(currentHeight - 1)
 			//删除上一区块链的未扫记录
 			bs.wm.DeleteUnscanRecord(currentHeight - 1)
+			//删除上一区块链的已通知记录，重扫时重新通知
+			bs.wm.DeleteNotifyRecords(currentHeight - 1)
 			currentHeight = currentHeight - 2 //倒退2个区块重新扫描
 			if currentHeight <= 0 {
 				currentHeight = 1
@@ -176,14 +201,13 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 
 			localBlock, err := bs.wm.GetLocalBlock(currentHeight)
 			if err != nil {
-				bs.wm.Log.Std.Error("block scanner can not get local block; unexpected error: %v", err)
+				bs.logger().Error("get local block failed", "height", currentHeight, "err", err)
 
 				//查找core钱包的RPC
-				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
 
 				_, err := bs.wm.GetBlockHash(currentHeight)
 				if err != nil {
-					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
+					bs.logger().Error("get prev block failed", "height", currentHeight, "err", err)
 					break
 				}
 
@@ -192,7 +216,7 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 			//重置当前区块的hash
 			currentHash = localBlock.Hash
 
-			bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", currentHeight, currentHash)
+			bs.logger().Info("rescan from block", "height", currentHeight, "hash", currentHash)
 
 			//重新记录一个新扫描起点
 			bs.wm.SaveLocalNewBlock(uint64(localBlock.Height), localBlock.Hash)
@@ -209,15 +233,23 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 
 			err = bs.BatchExtractTransaction(uint64(block.Height), block.Hash, block.TxList)
 			if err != nil {
-				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+				bs.logger().Error("extract block failed", "height", currentHeight, "hash", hash, "err", err)
 			}
 
 			//重置当前区块的hash
 			currentHash = hash
 
-			//保存本地新高度
-			bs.wm.SaveLocalNewBlock(currentHeight, currentHash)
-			bs.wm.SaveLocalBlock(block)
+			//保存本地新高度和区块，在同一事务中写入
+			if err = bs.wm.SaveLocalBlockWithCursor(block); err != nil {
+				bs.logger().Error("save local block failed", "height", currentHeight, "err", err)
+				break
+			}
+
+			scannedCount++
+			bs.setLastBlock(block)
+			metrics.AddCounter(MetricBlocksScanned, 1)
+			metrics.SetGauge(MetricScannedHeight, float64(currentHeight))
+			metrics.SetGauge(MetricScanLag, float64(maxHeight-currentHeight))
 
 			isFork = false
 
@@ -227,6 +259,10 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 
 	}
 
+	if elapsed := time.Since(taskStart).Seconds(); scannedCount > 0 && elapsed > 0 {
+		metrics.SetGauge(MetricBlocksPerSecond, float64(scannedCount)/elapsed)
+	}
+
 	//重扫前N个块，为保证记录找到
 	for i := currentHeight - bs.RescanLastBlockCount; i < currentHeight; i++ {
 		bs.scanBlock(i)
@@ -240,6 +276,26 @@ func (bs *NULSBlockScanner) ScanBlockTask() {
 	//重扫失败区块
 	bs.RescanFailedRecord()
 
+	//清理本地区块数据
+	bs.maintainLocalStorage(currentHeight)
+}
+
+//maintainLocalStorage 按保存策略清理本地区块，并定期压缩本地数据库
+func (bs *NULSBlockScanner) maintainLocalStorage(height uint64) {
+
+	if err := bs.wm.PruneLocalBlocks(height); err != nil {
+		bs.logger().Error("prune local blocks failed", "height", height, "err", err)
+		return
+	}
+
+	if time.Since(bs.lastCompactTime) < bs.wm.Config.DBCompactInterval {
+		return
+	}
+	bs.lastCompactTime = time.Now()
+
+	if err := bs.wm.CompactLocalStorage(height); err != nil {
+		bs.logger().Error("compact local storage failed", "height", height, "err", err)
+	}
 }
 
 //ScanBlock 扫描指定高度区块
@@ -261,93 +317,208 @@ func (bs *NULSBlockScanner) scanBlock(height uint64) (*NusBlock, error) {
 	hash, err := bs.wm.GetBlockHash(height)
 	if err != nil {
 		//下一个高度找不到会报异常
-		bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
+		bs.logger().Info("get block hash failed", "height", height, "err", err)
 		return nil, err
 	}
 
 	block, err := bs.wm.GetBlock(hash)
 	if err != nil {
-		bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
+		bs.logger().Error("get block failed", "height", height, "hash", hash, "err", err)
 
 		//记录未扫区块
 		unscanRecord := NewUnscanRecord(height, "", err.Error())
 		bs.SaveUnscanRecord(unscanRecord)
-		bs.wm.Log.Std.Info("block height: %d extract failed.", height)
 		return nil, err
 	}
 
-	bs.wm.Log.Std.Info("block scanner scanning height: %d ...", block.Height)
+	bs.logger().Info("scanning block", "height", block.Height)
 
 	err = bs.BatchExtractTransaction(uint64(block.Height), block.Hash, block.TxList)
 	if err != nil {
-		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+		bs.logger().Error("extract block failed", "height", height, "hash", hash, "err", err)
 	}
 
 	return block, nil
 }
 
-//rescanFailedRecord 重扫失败记录
+//rescanFailedRecord 重扫失败记录，只重扫到了重扫时间的记录，失败则按指数退避推迟下次重扫
+//没有交易的记录重扫整个区块，否则只重新提取和通知失败的交易
 func (bs *NULSBlockScanner) RescanFailedRecord() {
 
 	var (
-		blockMap = make(map[uint64][]string)
+		blockMap = make(map[uint64][]*UnscanRecord)
+		now      = time.Now().Unix()
 	)
 
 	list, err := bs.wm.GetUnscanRecords()
 	if err != nil {
-		bs.wm.Log.Std.Info("block scanner can not get rescan data; unexpected error: %v", err)
+		bs.logger().Error("get unscan records failed", "err", err)
 	}
 
 	//组合成批处理
 	for _, r := range list {
+		blockMap[r.BlockHeight] = append(blockMap[r.BlockHeight], r)
+	}
+
+	for height, records := range blockMap {
 
-		if _, exist := blockMap[r.BlockHeight]; !exist {
-			blockMap[r.BlockHeight] = make([]string, 0)
+		if height == 0 {
+			continue
 		}
 
-		if len(r.TxID) > 0 {
-			arr := blockMap[r.BlockHeight]
-			arr = append(arr, r.TxID)
+		//区块获取失败，重扫整个区块
+		if blockRecord := findBlockUnscanRecord(records); blockRecord != nil {
+			if blockRecord.IsRetryable(now) {
+				bs.rescanFailedBlock(height)
+			}
+			continue
+		}
 
-			blockMap[r.BlockHeight] = arr
+		for _, r := range records {
+			if !r.IsRetryable(now) {
+				continue
+			}
+
+			bs.logger().Info("rescanning transaction", "height", height, "txid", r.TxID, "attempts", r.Attempts)
+
+			err = bs.rescanFailedTransaction(height, r.TxID)
+			if err != nil {
+				bs.logger().Warn("rescan transaction failed", "height", height, "txid", r.TxID, "err", err)
+				bs.retryFailedRecord(r, err.Error())
+				continue
+			}
+
+			//删除未扫记录
+			bs.wm.DeleteUnscanRecordByID(r.ID)
 		}
 	}
 
-	for height, _ := range blockMap {
+	bs.updateUnscanRecordMetrics()
+}
 
-		if height == 0 {
-			continue
-		}
+//updateUnscanRecordMetrics 统计等待重扫和不再自动重扫的未扫记录数
+func (bs *NULSBlockScanner) updateUnscanRecordMetrics() {
 
-		var hash string
+	list, err := bs.wm.GetUnscanRecords()
+	if err != nil {
+		return
+	}
 
-		bs.wm.Log.Std.Info("block scanner rescanning height: %d ...", height)
+	pending, dead := countUnscanRecords(list)
 
-		hash, err := bs.wm.GetBlockHash(height)
-		if err != nil {
-			//下一个高度找不到会报异常
-			bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
-			continue
-		}
+	metrics := bs.wm.GetMetrics()
+	metrics.SetGauge(MetricUnscanRecords, float64(pending), "state", "pending")
+	metrics.SetGauge(MetricUnscanRecords, float64(dead), "state", "dead")
+}
 
-		block, err := bs.wm.GetBlock(hash)
-		if err != nil {
-			bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
-			continue
+//findBlockUnscanRecord 查找没有交易的未扫记录，即整个区块扫描失败的记录
+func findBlockUnscanRecord(records []*UnscanRecord) *UnscanRecord {
+	for _, r := range records {
+		if len(r.TxID) == 0 {
+			return r
 		}
+	}
+	return nil
+}
 
-		err = bs.BatchExtractTransaction(height, hash, block.TxList)
-		if err != nil {
-			bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+//rescanFailedBlock 重扫整个区块，已通知的交易不会重复通知
+func (bs *NULSBlockScanner) rescanFailedBlock(height uint64) {
+
+	bs.logger().Info("rescanning block", "height", height)
+
+	hash, err := bs.wm.GetBlockHash(height)
+	if err != nil {
+		//下一个高度找不到会报异常
+		bs.logger().Warn("get block hash failed", "height", height, "err", err)
+		bs.retryFailedHeight(height, err.Error())
+		return
+	}
+
+	block, err := bs.wm.GetBlock(hash)
+	if err != nil {
+		bs.logger().Warn("get block failed", "height", height, "hash", hash, "err", err)
+		bs.retryFailedHeight(height, err.Error())
+		return
+	}
+
+	err = bs.BatchExtractTransaction(height, hash, block.TxList)
+	if err != nil {
+		bs.logger().Warn("rescan block failed", "height", height, "hash", hash, "err", err)
+		bs.retryFailedHeight(height, err.Error())
+		return
+	}
+
+	//删除未扫记录
+	bs.wm.DeleteUnscanRecord(height)
+}
+
+//rescanFailedTransaction 重新提取和通知指定交易，已通知的数据不会重复通知
+func (bs *NULSBlockScanner) rescanFailedTransaction(height uint64, txid string) error {
+
+	tx, err := bs.wm.Api.GetTxByTxId(txid)
+	if err != nil {
+		return err
+	}
+
+	if tx.BlockHeight > 0 && uint64(tx.BlockHeight) != height {
+		return fmt.Errorf("transaction [%s] is at height %d, not %d", txid, tx.BlockHeight, height)
+	}
+
+	hash, err := bs.wm.GetBlockHash(height)
+	if err != nil {
+		return err
+	}
+
+	result := bs.ExtractTransaction(height, hash, tx, bs.ScanAddressFunc)
+	if !result.Success {
+		return fmt.Errorf("extract transaction [%s] failed: %s", txid, result.Reason)
+	}
+
+	if err = bs.newExtractDataNotify(height, txid, result.extractData); err != nil {
+		return err
+	}
+
+	return bs.newExtractDataNotify(height, txid, result.extractContractData)
+}
+
+//retryFailedHeight 区块重扫失败，累计该高度所有记录的重扫次数，并推迟下次重扫时间
+func (bs *NULSBlockScanner) retryFailedHeight(height uint64, reason string) {
+
+	list, err := bs.wm.GetUnscanRecords()
+	if err != nil {
+		bs.logger().Error("get unscan records failed", "height", height, "err", err)
+		return
+	}
+
+	//重扫期间可能新增了记录，统一使用该高度最大的重扫次数
+	records := make([]*UnscanRecord, 0)
+	attempts := 0
+	for _, r := range list {
+		if r.BlockHeight != height {
 			continue
 		}
+		records = append(records, r)
+		if r.Attempts > attempts {
+			attempts = r.Attempts
+		}
+	}
 
-		//删除未扫记录
-		bs.wm.DeleteUnscanRecord(height)
+	for _, r := range records {
+		r.Attempts = attempts
+		bs.retryFailedRecord(r, reason)
 	}
+}
 
-	//删除未没有找到交易记录的重扫记录
-	bs.wm.DeleteUnscanRecordNotFindTX()
+//retryFailedRecord 记录重扫失败，推迟下次重扫时间，超过最大次数则不再自动重扫
+func (bs *NULSBlockScanner) retryFailedRecord(r *UnscanRecord, reason string) {
+
+	r.RetryFailed(reason, time.Now().Unix(), bs.wm.Config.UnscanRetryInterval, bs.wm.Config.UnscanRetryMaxInterval, bs.wm.Config.UnscanMaxAttempts)
+	if r.Dead {
+		bs.logger().Error("rescan failed too many times, moved to dead letter", "height", r.BlockHeight, "txid", r.TxID, "attempts", r.Attempts)
+	}
+	if err := bs.wm.saveUnscanRecord(r); err != nil {
+		bs.logger().Error("save unscan record failed", "height", r.BlockHeight, "txid", r.TxID, "err", err)
+	}
 }
 
 //newBlockNotify 获得新区块后，通知给观测者
@@ -388,25 +559,26 @@ func (bs *NULSBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHas
 
 			if gets.Success {
 
-				notifyErr := bs.newExtractDataNotify(height, gets.extractData)
+				notifyErr := bs.newExtractDataNotify(height, gets.TxID, gets.extractData)
 				//saveErr := bs.SaveRechargeToWalletDB(height, gets.Recharges)
 				if notifyErr != nil {
 					failed++ //标记保存失败数
-					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
+					bs.logger().Error("notify extract data failed", "height", height, "txid", gets.TxID, "err", notifyErr)
 				}
 
 				notifyErr = nil
-				notifyErr = bs.newExtractDataNotify(height, gets.extractContractData)
+				notifyErr = bs.newExtractDataNotify(height, gets.TxID, gets.extractContractData)
 				if notifyErr != nil {
 					failed++ //标记保存失败数
-					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
+					bs.logger().Error("notify extract data failed", "height", height, "txid", gets.TxID, "err", notifyErr)
 				}
 
 			} else {
 				//记录未扫区块
-				unscanRecord := NewUnscanRecord(height, "", "")
+				unscanRecord := NewUnscanRecord(height, gets.TxID, gets.Reason)
 				bs.SaveUnscanRecord(unscanRecord)
-				bs.wm.Log.Std.Info("block height: %d extract failed.", height)
+				bs.wm.GetMetrics().AddCounter(MetricExtractFailures, 1, "stage", "extract")
+				bs.logger().Error("extract transaction failed", "height", height, "txid", gets.TxID, "reason", gets.Reason)
 				failed++ //标记保存失败数
 			}
 			//累计完成的线程数
@@ -501,6 +673,10 @@ func (bs *NULSBlockScanner) ExtractTransaction(blockHeight uint64, blockHash str
 		}
 	)
 
+	if tx != nil {
+		result.TxID = tx.Hash
+	}
+
 	////优先使用传入的高度
 	//if blockHeight > 0 && tx.BlockHeight == 0 {
 	//	tx.BlockHeight = int64(blockHeight)
@@ -510,7 +686,9 @@ func (bs *NULSBlockScanner) ExtractTransaction(blockHeight uint64, blockHash str
 
 	bs.extractTransaction(tx, blockHash, &result, scanAddressFunc)
 
-	bs.extractTokenTransaction(tx, blockHash, &result, scanAddressFunc)
+	if result.Success {
+		bs.extractTokenTransaction(tx, blockHash, &result, scanAddressFunc)
+	}
 	//bs.wm.Log.Debug("end extractTransaction")
 
 	return result
@@ -527,31 +705,59 @@ func (bs *NULSBlockScanner) extractTransaction(trx *Tx, blockHash string, result
 	if trx == nil {
 		//记录哪个区块哪个交易单没有完成扫描
 		success = false
+		result.Reason = "transaction is nil"
 	} else {
 
 		blocktime := trx.Time
 
-		if trx.Type == 2 || trx.Type == 101 {
+		if isExtractTxType(trx.Type) {
 
 			txType := 1
-			if trx.Type == 2 {
+			if trx.Type != TxTypeCallContract && trx.Type != TxTypeContractTransfer {
 				txType = 0
-			} else if trx.Type == 101 {
-				txType = 1
 			}
 			//提取出账部分记录
 			from, totalSpent := bs.extractTxInput(trx, blockHash, result, scanAddressFunc, uint64(txType))
 			//bs.wm.Log.Debug("from:", from, "totalSpent:", totalSpent)
 
+			//共识奖励中已作为合约调用退回gas记录的地址
+			refunded, err := bs.coinbaseRefundAddresses(trx, blockHash, scanAddressFunc)
+			if err != nil {
+				bs.logger().Warn("get coinbase refund addresses failed", "height", trx.BlockHeight, "txid", trx.Hash, "err", err)
+				bs.wm.GetMetrics().AddCounter(MetricExtractFailures, 1, "stage", "refund")
+				result.Success = false
+				result.Reason = fmt.Sprintf("get coinbase refund addresses failed: %v", err)
+				return
+			}
+
 			//提取入账部分记录
-			to, totalReceived := bs.extractTxOutput(trx, blockHash, result, scanAddressFunc, uint64(txType))
+			to, totalReceived := bs.extractTxOutput(trx, blockHash, result, scanAddressFunc, uint64(txType), refunded)
 			//bs.wm.Log.Debug("to:", to, "totalReceived:", totalReceived)
 
+			//合约调用退回的gas，查询失败则记录未扫交易，重扫时再提取
+			if trx.Type == TxTypeCallContract {
+				refund, err := bs.extractContractRefund(trx, blockHash, result, scanAddressFunc)
+				if err != nil {
+					bs.logger().Warn("extract contract refund failed", "height", trx.BlockHeight, "txid", trx.Hash, "err", err)
+					bs.wm.GetMetrics().AddCounter(MetricExtractFailures, 1, "stage", "refund")
+					result.Success = false
+					result.Reason = fmt.Sprintf("extract contract refund failed: %v", err)
+					return
+				}
+				totalReceived = totalReceived.Add(refund)
+			}
+
+			//共识奖励没有输入，不计手续费
+			fees := totalSpent.Sub(totalReceived)
+			if trx.Type == TxTypeCoinbase {
+				fees = decimal.Zero
+			}
+
 			for _, extractData := range result.extractData {
 				tx := &openwallet.Transaction{
 					From: from,
 					To:   to,
-					Fees: totalSpent.Sub(totalReceived).StringFixed(8),
+					Fees: fees.StringFixed(8),
 					Coin: openwallet.Coin{
 						Symbol:     bs.wm.Symbol(),
 						IsContract: false,
@@ -564,6 +770,14 @@ func (bs *NULSBlockScanner) extractTransaction(trx *Tx, blockHash string, result
 					Status:      openwallet.TxStatusSuccess,
 					TxType:      uint64(txType),
 				}
+				//合约转账交易关联发起的合约调用交易
+				if trx.Type == TxTypeContractTransfer && trx.TxData != nil {
+					tx.SetExtParam("originTxID", trx.TxData.OrginTxHash)
+				}
+				//共识相关交易标记类型
+				if consensus := consensusTxName(trx.Type); len(consensus) > 0 {
+					tx.SetExtParam("consensus", consensus)
+				}
 				wxID := openwallet.GenTransactionWxID(tx)
 				tx.WxID = wxID
 				extractData.Transaction = tx
@@ -578,6 +792,144 @@ func (bs *NULSBlockScanner) extractTransaction(trx *Tx, blockHash string, result
 	result.Success = success
 }
 
+//isExtractTxType 是否需要提取的交易类型
+func isExtractTxType(txType int32) bool {
+	switch txType {
+	case TxTypeCoinbase, TxTypeTransfer, TxTypeAlias, TxTypeJoinConsensus, TxTypeCancelDeposit, TxTypeStopAgent,
+		TxTypeCallContract, TxTypeContractTransfer:
+		return true
+	}
+	return false
+}
+
+//consensusTxName 共识相关交易的标记
+func consensusTxName(txType int32) string {
+	switch txType {
+	case TxTypeCoinbase:
+		return "reward"
+	case TxTypeJoinConsensus:
+		return "deposit"
+	case TxTypeCancelDeposit:
+		return "withdraw"
+	case TxTypeStopAgent:
+		return "stopAgent"
+	}
+	return ""
+}
+
+//coinbaseRefundAddresses 共识奖励未锁定的输出是区块内合约调用退回的gas，
+//返回已在合约调用交易中生成退回gas输出的关注地址，这些地址的未锁定输出不再重复提取
+func (bs *NULSBlockScanner) coinbaseRefundAddresses(trx *Tx, blockHash string, scanAddressFunc openwallet.BlockScanAddressFunc) (map[string]bool, error) {
+
+	refunded := make(map[string]bool)
+	if trx.Type != TxTypeCoinbase {
+		return refunded, nil
+	}
+
+	candidates := make(map[string]bool)
+	for _, output := range trx.Outputs {
+		if output.LockTime != 0 {
+			continue
+		}
+		if _, ok := scanAddressFunc(output.Address); ok {
+			candidates[output.Address] = true
+		}
+	}
+	if len(candidates) == 0 {
+		return refunded, nil
+	}
+
+	var (
+		block *NusBlock
+		err   error
+	)
+	if len(blockHash) > 0 {
+		block, err = bs.wm.Api.GetBlockByHash(blockHash)
+	} else {
+		block, err = bs.wm.Api.GetBlockByHeight(trx.BlockHeight)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//与extractContractRefund的条件一致：调用者为关注地址且有退回的gas
+	for _, tx := range block.TxList {
+		if tx.Type != TxTypeCallContract || len(tx.Inputs) == 0 {
+			continue
+		}
+		sender := tx.Inputs[0].Address
+		if !candidates[sender] || refunded[sender] {
+			continue
+		}
+		contractResult, err := bs.wm.Api.GetContractResult(tx.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if contractResult.RefundFee > 0 {
+			refunded[sender] = true
+		}
+	}
+
+	return refunded, nil
+}
+
+//extractContractRefund 提取合约调用退回给调用者的gas，只查询关注的调用者，避免每个合约调用都请求节点
+//链上退回的gas在共识奖励交易的未锁定输出中，这里生成的输出不在链上，扩展字段synthetic标记
+func (bs *NULSBlockScanner) extractContractRefund(trx *Tx, blockHash string, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc) (decimal.Decimal, error) {
+
+	//合约调用者是交易的输入地址
+	if len(trx.Inputs) == 0 {
+		return decimal.Zero, nil
+	}
+	sender := trx.Inputs[0].Address
+	sourceKey, ok := scanAddressFunc(sender)
+	if !ok {
+		return decimal.Zero, nil
+	}
+
+	contractResult, err := bs.wm.Api.GetContractResult(trx.Hash)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	if contractResult.RefundFee <= 0 {
+		return decimal.Zero, nil
+	}
+
+	refund := common.IntToDecimals(contractResult.RefundFee, bs.wm.Decimal())
+
+	//退回的gas记录在交易输出之后
+	n := uint64(len(trx.Outputs))
+	outPut := openwallet.TxOutPut{}
+	outPut.TxID = trx.Hash
+	outPut.Address = sender
+	outPut.Amount = refund.String()
+	outPut.Coin = openwallet.Coin{
+		Symbol:     bs.wm.Symbol(),
+		IsContract: false,
+	}
+	outPut.Index = n
+	outPut.Sid = openwallet.GenTxOutPutSID(trx.Hash, bs.wm.Symbol(), "", n)
+	outPut.CreateAt = time.Now().Unix()
+	outPut.BlockHeight = uint64(trx.BlockHeight)
+	outPut.BlockHash = blockHash
+	outPut.Confirm = int64(trx.ConfirmCount)
+	outPut.TxType = 1
+	outPut.SetExtParam("refund", true)
+	outPut.SetExtParam("synthetic", true)
+	outPut.SetExtParam("originTxID", trx.Hash)
+
+	ed := result.extractData[sourceKey]
+	if ed == nil {
+		ed = openwallet.NewBlockExtractData()
+		result.extractData[sourceKey] = ed
+	}
+
+	ed.TxOutputs = append(ed.TxOutputs, &outPut)
+
+	return refund, nil
+}
+
 //ExtractTransactionData 提取交易单
 func (bs *NULSBlockScanner) extractTokenTransaction(trx *Tx, blockHash string, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc) {
 
@@ -588,6 +940,7 @@ func (bs *NULSBlockScanner) extractTokenTransaction(trx *Tx, blockHash string, r
 	if trx == nil {
 		//记录哪个区块哪个交易单没有完成扫描
 		success = false
+		result.Reason = "transaction is nil"
 	} else {
 
 		blocktime := trx.Time
@@ -598,11 +951,11 @@ func (bs *NULSBlockScanner) extractTokenTransaction(trx *Tx, blockHash string, r
 			case 101:
 				tokenTrans, err := bs.wm.Api.GetTokenByHash(trx.Hash)
 				if err != nil {
-					bs.wm.Log.Error("Token tokenTrans is nil,hash:", trx.Hash, " ,err:", err.Error())
+					bs.logger().Error("get token transfers failed", "height", trx.BlockHeight, "txid", trx.Hash, "err", err)
 					break
 				}
 				if tokenTrans == nil || len(tokenTrans) != 1 {
-					bs.wm.Log.Error("Token tokenTrans is nil or len is't 1")
+					bs.logger().Error("token transfers is not single", "height", trx.BlockHeight, "txid", trx.Hash, "count", len(tokenTrans))
 					break
 				}
 				//提取出账部分记录
@@ -741,13 +1094,14 @@ func (bs *NULSBlockScanner) extractTokenTxInput(nulsTokens []*NulsToken, blockHa
 		txid := tokenIn.Hash
 		amount, err := decimal.NewFromString(tokenIn.Value)
 		if err != nil {
-			bs.wm.Log.Error("nulsTokens value can't be int,err:", err.Error())
+			bs.logger().Error("token value is invalid", "height", blockHeight, "txid", txid, "value", tokenIn.Value, "err", err)
 			continue
 		}
 		//amount = amount.Shift(int32(-uint64(tokenIn.Decimals)))
 		addr := tokenIn.From
 		sourceKey, ok := scanAddressFunc(addr)
 		if ok {
+			bs.wm.markTokenActive(tokenIn.ContractAddress, addr, uint64(blockHeight))
 			input := openwallet.TxInput{}
 			input.SourceTxID = txid
 			//input.SourceIndex = uint64(tokenIn.FromIndex)
@@ -799,7 +1153,7 @@ func (bs *NULSBlockScanner) extractTokenTxInput(nulsTokens []*NulsToken, blockHa
 }
 
 //ExtractTxInput 提取交易单输入部分
-func (bs *NULSBlockScanner) extractTxOutput(trx *Tx, blockHash string, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc,txType uint64) ([]string, decimal.Decimal) {
+func (bs *NULSBlockScanner) extractTxOutput(trx *Tx, blockHash string, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc,txType uint64, refunded map[string]bool) ([]string, decimal.Decimal) {
 
 	var (
 		to          = make([]string, 0)
@@ -813,11 +1167,14 @@ func (bs *NULSBlockScanner) extractTxOutput(trx *Tx, blockHash string, result *E
 	createAt := time.Now().Unix()
 	for n, output := range vout {
 
-		if output.LockTime > trx.BlockHeight {
-			bs.wm.Log.Error("nuls lockTime over Than now,height:", trx.BlockHeight)
+		//共识奖励锁定一定高度，未锁定的输出是合约调用退回的gas，已在合约调用交易中记录的不再提取
+		if trx.Type == TxTypeCoinbase && output.LockTime == 0 && refunded[output.Address] {
 			continue
 		}
 
+		//锁定中的输出也要提取，如分期解锁的转账，扩展字段记录锁定状态
+		locked := !IsLockTimeUnlocked(output.LockTime, trx.BlockHeight+1, time.Unix(0, trx.Time*int64(time.Millisecond)))
+
 		amount := common.IntToDecimals(int64(output.Value), bs.wm.Decimal()).String()
 		addr := output.Address
 		sourceKey, ok := scanAddressFunc(addr)
@@ -848,6 +1205,17 @@ func (bs *NULSBlockScanner) extractTxOutput(trx *Tx, blockHash string, result *E
 			outPut.BlockHash = blockHash
 			outPut.Confirm = int64(confirmations)
 			outPut.TxType = txType
+			if trx.Type == TxTypeContractTransfer && trx.TxData != nil {
+				outPut.SetExtParam("originTxID", trx.TxData.OrginTxHash)
+			}
+			//锁定的输出记录锁定时间，-1为共识锁定，locked为区块时是否仍锁定
+			if output.LockTime != 0 {
+				outPut.SetExtParam("lockTime", output.LockTime)
+				outPut.SetExtParam("locked", locked)
+			}
+			if consensus := consensusTxName(trx.Type); len(consensus) > 0 {
+				outPut.SetExtParam("consensus", consensus)
+			}
 			//transactions = append(transactions, &transaction)
 
 			ed := result.extractData[sourceKey]
@@ -885,13 +1253,14 @@ func (bs *NULSBlockScanner) extractTokenTxOutput(nulsTokens []*NulsToken, blockH
 		txid := tokenIn.Hash
 		amount, err := decimal.NewFromString(tokenIn.Value)
 		if err != nil {
-			bs.wm.Log.Error("nulsTokens value can't be int,err:", err.Error())
+			bs.logger().Error("token value is invalid", "height", blockHeight, "txid", txid, "value", tokenIn.Value, "err", err)
 			continue
 		}
 		//amount = amount.Shift(int32(-uint64(tokenIn.Decimals)))
 		addr := tokenIn.To
 		sourceKey, ok := scanAddressFunc(addr)
 		if ok {
+			bs.wm.markTokenActive(tokenIn.ContractAddress, addr, uint64(blockHeight))
 
 			//a := wallet.GetAddress(addr)
 			//if a == nil {
@@ -950,57 +1319,82 @@ func (bs *NULSBlockScanner) extractTokenTxOutput(nulsTokens []*NulsToken, blockH
 	return to, totalAmount
 }
 
-//newExtractDataNotify 发送通知
-func (bs *NULSBlockScanner) newExtractDataNotify(height uint64, extractData map[string]*openwallet.TxExtractData) error {
+//NotifyObserverID 观测者可以实现此接口提供固定的标识，重启后已通知记录仍然有效
+type NotifyObserverID interface {
+	NotifyObserverID() string
+}
 
-	for o, _ := range bs.Observers {
-		for key, data := range extractData {
-			err := o.BlockExtractDataNotify(key, data)
-			if err != nil {
-				bs.wm.Log.Error("BlockExtractDataNotify unexpected error:", err)
-				//记录未扫区块
-				unscanRecord := NewUnscanRecord(height, "", "ExtractData Notify failed.")
-				err = bs.SaveUnscanRecord(unscanRecord)
-				if err != nil {
-					bs.wm.Log.Std.Error("block height: %d, save unscan record failed. unexpected error: %v", height, err.Error())
-				}
+//notifyObserverID 观测者的标识，未实现NotifyObserverID时使用观测者的指针地址，同一类型的多个观测者不会冲突，
+//但重启后标识改变，已通知过的数据可能再次通知
+func notifyObserverID(o openwallet.BlockScanNotificationObject) string {
+	if id, ok := o.(NotifyObserverID); ok {
+		return id.NotifyObserverID()
+	}
+	if reflect.ValueOf(o).Kind() == reflect.Ptr {
+		return fmt.Sprintf("%T@%p", o, o)
+	}
+	return fmt.Sprintf("%T:%+v", o, o)
+}
 
-			}
+//newExtractDataNotify 发送通知，每个观测者已通知过的数据不再重复通知，通知失败的交易记录为未扫记录
+func (bs *NULSBlockScanner) newExtractDataNotify(height uint64, txid string, extractData map[string]*openwallet.TxExtractData) error {
+
+	notifyErr := bs.notifyExtractData("", height, txid, extractData)
+	if notifyErr != nil {
+		bs.wm.GetMetrics().AddCounter(MetricExtractFailures, 1, "stage", "notify")
+		//记录未扫交易
+		unscanRecord := NewUnscanRecord(height, txid, fmt.Sprintf("ExtractData Notify failed: %v", notifyErr))
+		if err := bs.SaveUnscanRecord(unscanRecord); err != nil {
+			bs.logger().Error("save unscan record failed", "height", height, "txid", txid, "err", err)
 		}
 	}
 
-	return nil
+	return notifyErr
 }
 
-//DeleteUnscanRecordNotFindTX 删除未没有找到交易记录的重扫记录
-func (wm *WalletManager) DeleteUnscanRecordNotFindTX() error {
+//notifyExtractData 通知提取数据，scope为已通知记录的范围，回扫任务使用任务ID，与实时扫描的记录分开
+func (bs *NULSBlockScanner) notifyExtractData(scope string, height uint64, txid string, extractData map[string]*openwallet.TxExtractData) error {
 
-	//删除找不到交易单
-	reason := "[-5]No information available about transaction"
+	var notifyErr error
 
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+	storage, err := bs.wm.GetStorage()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	var list []*UnscanRecord
-	err = db.All(&list)
-	if err != nil {
-		return err
-	}
+	for key, data := range extractData {
 
-	tx, err := db.Begin(true)
-	if err != nil {
-		return err
-	}
-	for _, r := range list {
-		if strings.HasPrefix(r.Reason, reason) {
-			tx.DeleteStruct(r)
+		contractID := ""
+		if data.Transaction != nil && data.Transaction.Coin.IsContract {
+			contractID = data.Transaction.Coin.ContractID
+		}
+
+		for o, _ := range bs.Observers {
+
+			observer := notifyObserverID(o)
+			if len(scope) > 0 {
+				observer = scope + ":" + observer
+			}
+
+			record := NewNotifyRecord(height, observer, txid, key, contractID)
+			if _, err := storage.GetNotifyRecord(record.Key); err == nil {
+				continue
+			}
+
+			err := o.BlockExtractDataNotify(key, data)
+			if err != nil {
+				bs.logger().Error("notify extract data failed", "height", height, "txid", txid, "sourceKey", key, "observer", observer, "err", err)
+				notifyErr = err
+				continue
+			}
+
+			if err = storage.SaveNotifyRecord(record); err != nil {
+				bs.logger().Error("save notify record failed", "height", height, "txid", txid, "err", err)
+			}
 		}
 	}
-	return tx.Commit()
+
+	return notifyErr
 }
 
 //SaveRechargeToWalletDB 保存交易单内的充值记录到钱包数据库
@@ -1068,6 +1462,11 @@ func (bs *NULSBlockScanner) GetScannedBlockHeader() (*openwallet.BlockHeader, er
 		if err != nil {
 			return nil, err
 		}
+
+		//首次扫描，确认节点与可信检查点在同一条链上
+		if err = bs.wm.VerifyCheckpointsWithNode(blockHeight); err != nil {
+			return nil, err
+		}
 	}
 
 	return &openwallet.BlockHeader{Height: blockHeight, Hash: hash}, nil
@@ -1099,7 +1498,7 @@ func (bs *NULSBlockScanner) GetCurrentBlockHeader() (*openwallet.BlockHeader, er
 func (bs *NULSBlockScanner) GetGlobalMaxBlockHeight() uint64 {
 	maxHeight, err := bs.wm.GetBlockHeight()
 	if err != nil {
-		bs.wm.Log.Std.Info("get global max block height error;unexpected error:%v", err)
+		bs.logger().Error("get chain block height failed", "err", err)
 		return 0
 	}
 	return maxHeight
@@ -1125,7 +1524,29 @@ func (bs *NULSBlockScanner) ExtractTransactionData(txid string, scanTargetFunc o
 		return nil, fmt.Errorf("can't find the txid,err:" + err.Error())
 	}
 
-	result := bs.ExtractTransaction(0, "", tx, scanAddressFunc)
+	return bs.extractTransactionData(tx, scanAddressFunc)
+}
+
+//extractTransactionData 提取交易单，按sourceKey汇总主币和代币的提取数据
+//交易未返回区块hash时按交易的区块高度查询
+func (bs *NULSBlockScanner) extractTransactionData(tx *Tx, scanAddressFunc openwallet.BlockScanAddressFunc) (map[string][]*openwallet.TxExtractData, error) {
+
+	var (
+		blockHeight uint64
+		blockHash   = tx.BlockHash
+	)
+	if tx.BlockHeight > 0 {
+		blockHeight = uint64(tx.BlockHeight)
+		if len(blockHash) == 0 {
+			hash, err := bs.wm.GetBlockHash(blockHeight)
+			if err != nil {
+				return nil, fmt.Errorf("get block [%d] hash failed: %v", blockHeight, err)
+			}
+			blockHash = hash
+		}
+	}
+
+	result := bs.ExtractTransaction(blockHeight, blockHash, tx, scanAddressFunc)
 	if !result.Success {
 		return nil, fmt.Errorf("extract transaction failed")
 	}
@@ -1209,18 +1630,24 @@ func (bs *NULSBlockScanner) SaveUnscanRecord(record *UnscanRecord) error {
 	}
 
 	if record.BlockHeight == 0 {
-		bs.wm.Log.Warn("unconfirmed transaction do not rescan")
+		bs.logger().Warn("unconfirmed transaction do not rescan", "txid", record.TxID)
 		return nil
 	}
 
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(bs.wm.Config.dbPath, bs.wm.Config.BlockchainFile))
+	storage, err := bs.wm.GetStorage()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	return db.Save(record)
+	//已有记录则保留重扫进度，避免重复失败时重置退避时间
+	if exist, err := storage.GetUnscanRecord(record.ID); err == nil {
+		record.Attempts = exist.Attempts
+		record.NextRetryAt = exist.NextRetryAt
+		record.Dead = exist.Dead
+		record.CreateAt = exist.CreateAt
+	}
+
+	return storage.SaveUnscanRecord(record)
 }
 
 //GetWalletByAddress 获取地址对应的钱包
@@ -1252,20 +1679,15 @@ func (wm *WalletManager) GetBlockHeight() (uint64, error) {
 //GetLocalNewBlock 获取本地记录的区块高度和hash
 func (wm *WalletManager) GetLocalNewBlock() (uint64, string) {
 
-	var (
-		blockHeight uint64 = 0
-		blockHash   string = ""
-	)
-
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+	storage, err := wm.GetStorage()
 	if err != nil {
 		return 0, ""
 	}
-	defer db.Close()
 
-	db.Get(blockchainBucket, "blockHeight", &blockHeight)
-	db.Get(blockchainBucket, "blockHash", &blockHash)
+	blockHeight, blockHash, err := storage.GetLocalNewBlock()
+	if err != nil {
+		return 0, ""
+	}
 
 	return blockHeight, blockHash
 }
@@ -1273,27 +1695,34 @@ func (wm *WalletManager) GetLocalNewBlock() (uint64, string) {
 //SaveLocalNewBlock 记录区块高度和hash到本地
 func (wm *WalletManager) SaveLocalNewBlock(blockHeight uint64, blockHash string) {
 
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+	storage, err := wm.GetStorage()
 	if err != nil {
 		return
 	}
-	defer db.Close()
 
-	db.Set(blockchainBucket, "blockHeight", &blockHeight)
-	db.Set(blockchainBucket, "blockHash", &blockHash)
+	storage.SaveLocalNewBlock(blockHeight, blockHash)
 }
 
 //SaveLocalBlock 记录本地新区块
 func (wm *WalletManager) SaveLocalBlock(block *NusBlock) {
 
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+	storage, err := wm.GetStorage()
 	if err != nil {
 		return
 	}
-	defer db.Close()
 
-	db.Save(block)
+	storage.SaveLocalBlock(block)
+}
+
+//SaveLocalBlockWithCursor 记录本地新区块，并同时更新本地区块高度和hash
+func (wm *WalletManager) SaveLocalBlockWithCursor(block *NusBlock) error {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	return storage.SaveLocalBlockWithCursor(block)
 }
 
 //GetBlockHash 根据区块高度获得区块hash
@@ -1310,22 +1739,12 @@ func (wm *WalletManager) GetBlockHash(height uint64) (string, error) {
 //GetLocalBlock 获取本地区块数据
 func (wm *WalletManager) GetLocalBlock(height uint64) (*NusBlock, error) {
 
-	var (
-		block NusBlock
-	)
-
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+	storage, err := wm.GetStorage()
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
 
-	err = db.One("Height", height, &block)
-	if err != nil {
-		return nil, err
-	}
-
-	return &block, nil
+	return storage.GetLocalBlock(height)
 }
 
 //GetBlock 获取区块数据
@@ -1359,41 +1778,84 @@ func (wm *WalletManager) GetBlock(hash string) (*NusBlock, error) {
 
 //获取未扫记录
 func (wm *WalletManager) GetUnscanRecords() ([]*UnscanRecord, error) {
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
 
-	var list []*UnscanRecord
-	err = db.All(&list)
+	storage, err := wm.GetStorage()
 	if err != nil {
 		return nil, err
 	}
-	return list, nil
+
+	return storage.GetUnscanRecords()
 }
 
 //DeleteUnscanRecord 删除指定高度的未扫记录
 func (wm *WalletManager) DeleteUnscanRecord(height uint64) error {
-	//获取本地区块高度
-	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+
+	storage, err := wm.GetStorage()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	var list []*UnscanRecord
-	err = db.Find("BlockHeight", height, &list)
+	return storage.DeleteUnscanRecord(height)
+}
+
+//DeleteNotifyRecords 删除指定高度的已通知记录
+func (wm *WalletManager) DeleteNotifyRecords(height uint64) error {
+
+	storage, err := wm.GetStorage()
 	if err != nil {
 		return err
 	}
 
-	for _, r := range list {
-		db.DeleteStruct(r)
+	return storage.DeleteNotifyRecords(height)
+}
+
+//SaveFeesSupportRecord 保存手续费充值记录
+func (wm *WalletManager) SaveFeesSupportRecord(record *FeesSupportRecord) error {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return storage.SaveFeesSupportRecord(record)
+}
+
+//saveFeesSupportRecords 记录已广播的手续费充值交易的接收地址，不是手续费充值交易则忽略
+func (wm *WalletManager) saveFeesSupportRecords(rawTx *openwallet.RawTransaction) {
+
+	contractAddress := rawTx.GetExtParam().Get(feesSupportContractKey).String()
+	if len(contractAddress) == 0 {
+		return
+	}
+
+	for addr, amount := range rawTx.To {
+		record := NewFeesSupportRecord(addr, contractAddress, amount)
+		if err := wm.SaveFeesSupportRecord(record); err != nil {
+			wm.Logger(LogSubsystemTx).Error("save fees support record failed", "address", addr, "err", err)
+		}
+	}
+}
+
+//GetFeesSupportRecord 获取地址的手续费充值记录
+func (wm *WalletManager) GetFeesSupportRecord(address string) (*FeesSupportRecord, error) {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.GetFeesSupportRecord(address)
+}
+
+//DeleteFeesSupportRecord 删除地址的手续费充值记录
+func (wm *WalletManager) DeleteFeesSupportRecord(address string) error {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	return storage.DeleteFeesSupportRecord(address)
 }
 
 //GetAssetsAccountBalanceByAddress 查询账户相关地址的交易记录
@@ -1407,29 +1869,100 @@ func (bs *NULSBlockScanner) GetBalanceByAddress(address ...string) ([]*openwalle
 func (wm *WalletManager) getBalanceCalUnspent(address ...string) ([]*openwallet.Balance, error) {
 
 	addrBalanceArr := make([]*openwallet.Balance, 0)
+
+	detailArr, err := wm.GetAddressBalanceDetail(address...)
+	if err != nil {
+		return nil, errors.New("cant get balances:" + err.Error())
+	}
+
+	for _, detail := range detailArr {
+		obj := &openwallet.Balance{
+			Symbol:           wm.Symbol(),
+			Address:          detail.Address,
+			Balance:          detail.Total().String(),
+			UnconfirmBalance: detail.Pending.String(),
+			ConfirmBalance:   detail.Spendable.String(),
+		}
+
+		addrBalanceArr = append(addrBalanceArr, obj)
+	}
+
+	return addrBalanceArr, nil
+}
+
+//GetAddressBalanceDetail 获取地址余额明细，通过utxo的锁定时间区分可使用和锁定的余额
+func (wm *WalletManager) GetAddressBalanceDetail(address ...string) ([]*AddressBalance, error) {
+
+	height, err := wm.Api.GetNewHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	detailArr := make([]*AddressBalance, 0)
 	for _, a := range address {
 
-		var obj *openwallet.Balance
+		unspent, err := wm.Api.GetAllUnSpent(a)
+		if err != nil {
+			return nil, err
+		}
 
-		nulsBalance, err := wm.Api.GetAddressBalance(a)
+		detail, err := wm.addressBalanceDetail(a, unspent, height, now)
 		if err != nil {
-			return nil, errors.New("cant get balances:" + err.Error())
+			return nil, err
 		}
-		confirmBalance := nulsBalance.UnLockBalance
-		balance := nulsBalance.Balance
-		unconfirmBalance := nulsBalance.Balance
 
-		obj = &openwallet.Balance{
-			Symbol:           wm.Symbol(),
-			Address:          a,
-			Balance:          common.IntToDecimals(balance.IntPart(), wm.Decimal()).String(),
-			UnconfirmBalance: common.IntToDecimals(unconfirmBalance.IntPart(), wm.Decimal()).String(),
-			ConfirmBalance:   common.IntToDecimals(confirmBalance.IntPart(), wm.Decimal()).String(),
+		detailArr = append(detailArr, detail)
+	}
+
+	return detailArr, nil
+}
+
+//addressBalanceDetail 根据节点返回的utxo计算地址余额明细
+//未广播交易单使用的utxo计入预留余额，已广播交易单花费的utxo不再计入，交易的找零计入pending
+func (wm *WalletManager) addressBalanceDetail(address string, unspent []*UtxoDto, height int64, now time.Time) (*AddressBalance, error) {
+
+	reserved, spent, err := wm.GetUnspentLockKeys(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		spendable       int64
+		reservedValue   int64
+		consensusLocked int64
+		timeLocked      int64
+		exist           = make(map[string]bool)
+	)
+
+	for _, u := range unspent {
+		exist[u.Key()] = true
+		if spent[u.Key()] {
+			continue
+		}
+		if u.LockTime < 0 {
+			consensusLocked += u.Value
+		} else if !u.IsUnlocked(height, now) {
+			timeLocked += u.Value
+		} else if reserved[u.Key()] {
+			reservedValue += u.Value
+		} else {
+			spendable += u.Value
 		}
+	}
 
-		addrBalanceArr = append(addrBalanceArr, obj)
+	pending, err := wm.GetPendingChangeValue(address, exist)
+	if err != nil {
+		wm.Log.Warningf("get pending change of address[%s] failed, err=%v", address, err)
 	}
 
-	return addrBalanceArr, nil
+	return &AddressBalance{
+		Address:         address,
+		Spendable:       common.IntToDecimals(spendable, wm.Decimal()),
+		Reserved:        common.IntToDecimals(reservedValue, wm.Decimal()),
+		ConsensusLocked: common.IntToDecimals(consensusLocked, wm.Decimal()),
+		TimeLocked:      common.IntToDecimals(timeLocked, wm.Decimal()),
+		Pending:         common.IntToDecimals(pending, wm.Decimal()),
+	}, nil
 }
 
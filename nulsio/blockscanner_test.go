@@ -0,0 +1,174 @@
+package nulsio
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blocktree/openwallet/log"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//testScannerWalletManager 创建连接模拟节点的钱包管理者
+func testScannerWalletManager(handler http.HandlerFunc) (*WalletManager, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	wm := testStateWalletManager()
+	wm.Log = log.NewOWLogger(Symbol)
+	wm.Api = &Client{BaseURL: server.URL}
+	wm.Blockscanner = NewNULSBlockScanner(wm)
+	return wm, server
+}
+
+//testExtractResult 创建空的提取结果
+func testExtractResult(height uint64) *ExtractResult {
+	return &ExtractResult{
+		BlockHeight:         height,
+		extractData:         make(map[string]*openwallet.TxExtractData),
+		extractContractData: make(map[string]*openwallet.TxExtractData),
+	}
+}
+
+func TestNULSBlockScanner_ExtractContractRefund(t *testing.T) {
+
+	requests := 0
+	fail := false
+	wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if fail {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "msg": "unavailable"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{
+			"data": &ContractResult{Success: true, Sender: "sender", RefundFee: 300000},
+		}})
+	})
+	defer server.Close()
+
+	trx := &Tx{Hash: "tx101", Type: TxTypeCallContract, BlockHeight: 10,
+		Inputs:  []*Input{{FromHash: "tx0", FromIndex: 0, Value: 100000000, Address: "sender"}},
+		Outputs: []*Output{{Address: "sender", Value: 98000000}}}
+
+	//调用者不是关注的地址，不请求节点
+	result := testExtractResult(10)
+	wm.Blockscanner.extractTransaction(trx, "bh", result, func(address string) (string, bool) { return "", false })
+	if !result.Success || requests != 0 {
+		t.Errorf("unwatched sender: success = %v, requests = %d, want true, 0", result.Success, requests)
+	}
+
+	scanAddressFunc := func(address string) (string, bool) { return "account", address == "sender" }
+
+	result = testExtractResult(10)
+	wm.Blockscanner.extractTransaction(trx, "bh", result, scanAddressFunc)
+	if !result.Success || requests != 1 {
+		t.Fatalf("watched sender: success = %v, requests = %d, want true, 1", result.Success, requests)
+	}
+	outputs := result.extractData["account"].TxOutputs
+	if len(outputs) != 2 {
+		t.Fatalf("outputs length = %d, want 2", len(outputs))
+	}
+	refund := outputs[1]
+	if refund.Amount != "0.003" || refund.Index != 1 || !refund.GetExtParam().Get("synthetic").Bool() || refund.GetExtParam().Get("originTxID").String() != "tx101" {
+		t.Errorf("refund output = %+v, ext: %v", refund, refund.GetExtParam())
+	}
+	if fees := result.extractData["account"].Transaction.Fees; fees != "0.01700000" {
+		t.Errorf("fees = %s, want 0.01700000", fees)
+	}
+
+	//查询失败则提取失败，记录未扫交易后重扫
+	fail = true
+	result = testExtractResult(10)
+	wm.Blockscanner.extractTransaction(trx, "bh", result, scanAddressFunc)
+	if result.Success || !strings.Contains(result.Reason, "refund") {
+		t.Errorf("refund lookup failure: success = %v, reason = %s", result.Success, result.Reason)
+	}
+}
+
+func TestNULSBlockScanner_ExtractCoinbaseRefund(t *testing.T) {
+
+	var (
+		calls []*Tx
+		fail  bool
+	)
+	wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "msg": "unavailable"})
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/block/hash/"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": &NusBlock{Height: 10, Hash: "bh", TxList: calls}})
+		case strings.HasPrefix(r.URL.Path, "/api/contract/result/"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{
+				"data": &ContractResult{Success: true, Sender: "sender", RefundFee: 300000},
+			}})
+		}
+	})
+	defer server.Close()
+
+	//共识奖励：锁定的出块奖励和未锁定的退回gas
+	coinbase := &Tx{Hash: "tx1", Type: TxTypeCoinbase, BlockHeight: 10,
+		Outputs: []*Output{
+			{Address: "sender", Value: 300000, LockTime: 0},
+			{Address: "sender", Value: 500000000, LockTime: 1010},
+		}}
+	scanAddressFunc := func(address string) (string, bool) { return "account", address == "sender" }
+
+	//区块内有关注地址的合约调用，退回的gas已在合约调用中提取
+	calls = []*Tx{coinbase, {Hash: "tx101", Type: TxTypeCallContract, Inputs: []*Input{{Address: "sender"}}}}
+	result := testExtractResult(10)
+	wm.Blockscanner.extractTransaction(coinbase, "bh", result, scanAddressFunc)
+	if outputs := result.extractData["account"].TxOutputs; !result.Success || len(outputs) != 1 || outputs[0].Index != 1 {
+		t.Errorf("refunded coinbase: success = %v, reason = %s", result.Success, result.Reason)
+	}
+
+	//没有生成退回gas的地址，未锁定的输出照常提取
+	calls = []*Tx{coinbase, {Hash: "tx101", Type: TxTypeCallContract, Inputs: []*Input{{Address: "other"}}}}
+	result = testExtractResult(10)
+	wm.Blockscanner.extractTransaction(coinbase, "bh", result, scanAddressFunc)
+	if outputs := result.extractData["account"].TxOutputs; !result.Success || len(outputs) != 2 {
+		t.Errorf("coinbase without refund: success = %v, reason = %s", result.Success, result.Reason)
+	}
+
+	//查询区块失败则提取失败
+	fail = true
+	result = testExtractResult(10)
+	wm.Blockscanner.extractTransaction(coinbase, "bh", result, scanAddressFunc)
+	if result.Success {
+		t.Errorf("coinbase refund lookup failure should fail the extraction")
+	}
+}
+
+func TestNULSBlockScanner_ExtractLockedOutput(t *testing.T) {
+
+	wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+
+	//区块时间2019-10-18，第一个输出锁定到2029年，第二个输出锁定到已过的高度
+	trx := &Tx{Hash: "tx2", Type: TxTypeTransfer, BlockHeight: 10, Time: 1571400000000,
+		Inputs: []*Input{{FromHash: "tx0", FromIndex: 0, Value: 300000000, Address: "other"}},
+		Outputs: []*Output{
+			{Address: "vesting", Value: 100000000, LockTime: 1886000000000},
+			{Address: "vesting", Value: 100000000, LockTime: 5},
+		}}
+
+	result := testExtractResult(10)
+	wm.Blockscanner.extractTransaction(trx, "bh", result, func(address string) (string, bool) {
+		return "account", address == "vesting"
+	})
+	if !result.Success {
+		t.Fatalf("extract failed: %s", result.Reason)
+	}
+
+	outputs := result.extractData["account"].TxOutputs
+	if len(outputs) != 2 {
+		t.Fatalf("outputs length = %d, want 2", len(outputs))
+	}
+	if ext := outputs[0].GetExtParam(); !ext.Get("locked").Bool() || ext.Get("lockTime").Int() != 1886000000000 {
+		t.Errorf("time locked output ext = %v", ext)
+	}
+	if ext := outputs[1].GetExtParam(); ext.Get("locked").Bool() || ext.Get("lockTime").Int() != 5 {
+		t.Errorf("unlocked output ext = %v", ext)
+	}
+}
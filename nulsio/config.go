@@ -16,10 +16,16 @@
 package nulsio
 
 import (
-	"github.com/blocktree/go-owcrypt"
-	"github.com/blocktree/openwallet/common/file"
+	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/nulsio-adapter/nulsio_addrdec"
+	"github.com/blocktree/openwallet/common/file"
+	"github.com/shopspring/decimal"
 )
 
 const (
@@ -32,6 +38,61 @@ const (
 
 # RPC api url
 serverAPI = ""
+# JSON-RPC api url, used to query utxo and account, empty means https://api.nuls.io
+rpcAPI = ""
+# chain id of addresses, 8964 is the NULS mainnet
+chainId = 8964
+# contract call default gas limit
+contractGasLimit = 20000
+# contract call gas price, unit: Na
+contractGasPrice = 25
+# safety margin multiplied on the imputed gas of a contract call
+contractGasMargin = 1.2
+# max gas limit of a contract call
+contractMaxGasLimit = 10000000
+# transaction fee of a contract call, exclude gas
+contractTxFee = 0.002
+# source of token balance: explorer or contract
+tokenBalanceSource = "explorer"
+# blocks after a token transfer during which the balance of the address is read from contract view, as the explorer index may lag, 0 means disabled
+tokenBalanceViewBlocks = 30
+# seconds to wait for the fees supported to an address before supporting it again
+feesSupportWaitTime = 600
+# seconds to keep unspent locked by a built transaction, and unconfirmed change available
+unspentLockExpireTime = 1800
+# black hole address receiving the NULS burned by alias registration
+aliasBurnAddress = "Nse5FeeiYk1opxdc5RqYpEWkiUDGNuLs"
+# amount of NULS burned by alias registration
+aliasBurnAmount = "1"
+# batch transfer method of token contract, args: (String[] tos, String[] values)
+# empty means CreateRawTransaction rejects token transfers with multiple receivers, use CreateNrc20BatchRawTransaction to create one transaction per receiver
+batchTransferMethod = ""
+# max receivers accepted by the batch transfer method of token contract in one call
+batchTransferMaxReceivers = 100
+# number of latest blocks stored locally with full transactions, older blocks keep header only
+blockRetainCount = 100
+# number of latest block headers stored locally, 0 means keep all
+blockHeaderRetainCount = 100000
+# seconds between local database pruning and compaction
+dbCompactInterval = 3600
+# max size of local database in MB, headers beyond full blocks are dropped when exceeded, 0 means unlimited
+maxDBSize = 1024
+# trusted checkpoints verified when the scanner starts fresh or imports state, format: height:hash,height:hash
+checkpoints = ""
+# seconds to wait before the first retry of a failed block, doubled on each failure
+unscanRetryInterval = 60
+# max seconds between retries of a failed block
+unscanRetryMaxInterval = 3600
+# max retries of a failed block before it is moved to dead letter, 0 means retry forever
+unscanMaxAttempts = 10
+# collect scanner and api metrics in an in-process registry
+enableMetrics = false
+# log level of subsystems: scanner, api, tx, contract; levels: error, warn, info, debug. format: scanner:info,api:warn
+logLevels = ""
+# structured log format: text or json
+logFormat = "text"
+# max blocks the scanner can fall behind the node before the status check reports unhealthy
+statusMaxScanLag = 10
 
 `
 )
@@ -49,6 +110,8 @@ type WalletConfig struct {
 	dbPath string
 	//钱包服务API
 	ServerAPI string
+	//JSON-RPC接口地址，为空使用DefaultRPCURL
+	RPCAPI string
 	//默认配置内容
 	DefaultConfig string
 	//曲线类型
@@ -60,6 +123,57 @@ type WalletConfig struct {
 	MaxTxInputs int
 
 	DataDir string
+
+	//合约调用默认gas上限
+	ContractGasLimit uint64
+	//合约调用gas单价，单位Na
+	ContractGasPrice uint64
+	//合约调用预估gas的安全系数
+	ContractGasMargin decimal.Decimal
+	//合约调用最大gas上限
+	ContractMaxGasLimit uint64
+	//合约调用交易手续费，不包含gas
+	ContractTxFee decimal.Decimal
+	//代币余额查询来源：explorer，contract
+	TokenBalanceSource string
+	//地址有代币交易后，在多少个区块内从合约查询余额，0则不切换
+	TokenBalanceViewBlocks uint64
+	//代币汇总时，等待手续费到账的时间
+	FeesSupportWaitTime time.Duration
+	//代币合约的批量转账方法，为空则CreateRawTransaction不支持多个接收地址的代币转账，需使用CreateNrc20BatchRawTransaction逐个创建
+	BatchTransferMethod string
+	//代币合约批量转账方法单次最多的接收地址数量
+	BatchTransferMaxReceivers int
+	//交易单锁定utxo的有效时间
+	UnspentLockExpireTime time.Duration
+	//设置别名销毁NULS的黑洞地址
+	AliasBurnAddress string
+	//设置别名销毁的NULS数量
+	AliasBurnAmount decimal.Decimal
+	//本地保存完整交易的最新区块数量，更早的区块只保存区块头
+	BlockRetainCount uint64
+	//本地保存区块头的最新区块数量，0则全部保存
+	BlockHeaderRetainCount uint64
+	//本地数据库清理和压缩的间隔
+	DBCompactInterval time.Duration
+	//本地数据库文件大小上限，单位字节，0则不限制
+	MaxDBSize int64
+	//可信的区块检查点，高度对应的区块hash
+	Checkpoints map[uint64]string
+	//扫描失败区块的首次重扫间隔，每次失败后加倍
+	UnscanRetryInterval time.Duration
+	//扫描失败区块的最大重扫间隔
+	UnscanRetryMaxInterval time.Duration
+	//扫描失败区块的最大重扫次数，超过后不再自动重扫，0则一直重扫
+	UnscanMaxAttempts int
+	//是否启用进程内指标收集
+	EnableMetrics bool
+	//子系统的日志级别
+	LogLevels map[string]int
+	//结构化日志格式：text，json
+	LogFormat string
+	//健康检查允许落后节点的最大区块数，超过则不健康
+	StatusMaxScanLag uint64
 }
 
 func NewConfig(symbol string) *WalletConfig {
@@ -69,7 +183,31 @@ func NewConfig(symbol string) *WalletConfig {
 	//币种
 	c.Symbol = symbol
 	c.CurveType = CurveType
+	c.ChainId = strconv.Itoa(nulsio_addrdec.MainnetChainID)
 	c.MaxTxInputs = 50
+	c.ContractGasLimit = DEFAULT_GAS_LIMIT
+	c.ContractGasPrice = DEFAULT_GAS_PRICE
+	c.ContractGasMargin = decimal.New(12, -1)
+	c.ContractMaxGasLimit = 10000000
+	c.ContractTxFee = decimal.New(2, -3)
+	c.TokenBalanceSource = TokenBalanceSourceExplorer
+	c.TokenBalanceViewBlocks = 30
+	c.FeesSupportWaitTime = 10 * time.Minute
+	c.UnspentLockExpireTime = 30 * time.Minute
+	c.AliasBurnAddress = "Nse5FeeiYk1opxdc5RqYpEWkiUDGNuLs"
+	c.AliasBurnAmount = decimal.New(1, 0)
+	c.BatchTransferMaxReceivers = 100
+	c.BlockRetainCount = 100
+	c.BlockHeaderRetainCount = 100000
+	c.DBCompactInterval = time.Hour
+	c.MaxDBSize = 1024 * 1024 * 1024
+	c.Checkpoints = make(map[uint64]string)
+	c.UnscanRetryInterval = time.Minute
+	c.UnscanRetryMaxInterval = time.Hour
+	c.UnscanMaxAttempts = 10
+	c.LogLevels = make(map[string]int)
+	c.LogFormat = LogFormatText
+	c.StatusMaxScanLag = 10
 	//区块链数据
 	//blockchainDir = filepath.Join("data", strings.ToLower(Symbol), "blockchain")
 	//配置文件路径
@@ -102,3 +240,24 @@ func (wc *WalletConfig) makeDataDir() {
 	//创建目录
 	file.MkdirAll(wc.dbPath)
 }
+
+//parseCheckpoints 解析检查点配置，格式：height:hash,height:hash
+func parseCheckpoints(value string) (map[uint64]string, error) {
+	checkpoints := make(map[uint64]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("checkpoint [%s] format is invalid", item)
+		}
+		height, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 64)
+		if err != nil || height == 0 {
+			return nil, fmt.Errorf("checkpoint [%s] height is invalid", item)
+		}
+		checkpoints[height] = strings.TrimSpace(parts[1])
+	}
+	return checkpoints, nil
+}
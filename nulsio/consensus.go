@@ -0,0 +1,331 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/blocktree/nulsio-adapter/nulsio_trans"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	//depositPageSize 分页查询委托列表的每页数量
+	depositPageSize = 100
+)
+
+//GetAccountDeposits 获取地址未取消的委托列表
+func (wm *WalletManager) GetAccountDeposits(address ...string) ([]*Deposit, error) {
+	deposits := make([]*Deposit, 0)
+	for _, a := range address {
+		for pageNumber := 1; ; pageNumber++ {
+			page, err := wm.Api.GetAccountDeposits(a, pageNumber, depositPageSize)
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range page.List {
+				if d.IsActive() {
+					deposits = append(deposits, d)
+				}
+			}
+			if pageNumber >= page.Pages {
+				break
+			}
+		}
+	}
+	return deposits, nil
+}
+
+//getDepositOutputIndex 查找委托交易中锁定的委托金额输出
+func (wm *WalletManager) getDepositOutputIndex(deposit *Deposit) (int32, error) {
+	tx, err := wm.Api.GetTxByTxId(deposit.TxHash)
+	if err != nil {
+		return 0, err
+	}
+	for i, out := range tx.Outputs {
+		if out.Address == deposit.Address && out.LockTime == nulsio_trans.ConsensusLockTime && out.Value == deposit.Deposit {
+			return int32(i), nil
+		}
+	}
+	return 0, fmt.Errorf("can not find the locked deposit output in tx[%s]", deposit.TxHash)
+}
+
+//GetAgent 获取共识节点信息
+func (wm *WalletManager) GetAgent(agentHash string) (*Agent, error) {
+	return wm.Api.GetAgent(agentHash)
+}
+
+//CreateJoinConsensusRawTransaction 创建委托共识交易
+//rawTx.To为委托地址和委托数量，扩展参数agentHash为共识节点hash
+func (decoder *TransactionDecoder) CreateJoinConsensusRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	var (
+		usedUTXO  = make([]*UtxoDto, 0)
+		balance   = decimal.Zero
+		agentHash = rawTx.GetExtParam().Get("agentHash").String()
+		address   string
+		amount    decimal.Decimal
+	)
+
+	if len(agentHash) == 0 {
+		return errors.New("agentHash is empty!")
+	}
+
+	if len(rawTx.To) != 1 {
+		return errors.New("join consensus transaction must have only one deposit address!")
+	}
+
+	for addr, a := range rawTx.To {
+		address = addr
+		amount, _ = decimal.NewFromString(a)
+	}
+
+	if amount.LessThan(MinDepositAmount) {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "deposit amount must be greater than %s", MinDepositAmount.String())
+	}
+
+	//委托地址必须属于账户
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID, "Address", address)
+	if err != nil || len(addresses) == 0 {
+		return openwallet.Errorf(openwallet.ErrAddressNotFound, "deposit address[%s] is not in account", address)
+	}
+
+	agent, err := decoder.wm.GetAgent(agentHash)
+	if err != nil {
+		return err
+	}
+	if agent.DelHeight > 0 {
+		return fmt.Errorf("agent[%s] has been stopped", agentHash)
+	}
+
+	feesRate, err := decoder.wm.EstimateFeeRate()
+	if err != nil {
+		return err
+	}
+
+	fees, err := decoder.wm.EstimateFee(0, 2, "", feesRate)
+	if err != nil {
+		return err
+	}
+
+	unspent, err := decoder.wm.GetAvailableUnspent(address)
+	if err != nil {
+		return err
+	}
+
+	//获取utxo，按小到大排序
+	sort.Sort(UnspentSort{unspent, func(a, b *UtxoDto) int {
+		if a.Value > b.Value {
+			return 1
+		} else {
+			return -1
+		}
+	}})
+
+	totalSend := amount.Add(fees)
+	for _, u := range unspent {
+		balance = balance.Add(decimal.New(u.Value, -decoder.wm.Decimal()))
+		usedUTXO = append(usedUTXO, u)
+		if balance.GreaterThanOrEqual(totalSend) {
+			break
+		}
+	}
+
+	if balance.LessThan(totalSend) {
+		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "address[%s] balance: %s is not enough to deposit", address, balance.StringFixed(decoder.wm.Decimal()))
+	}
+
+	depositNa := amount.Shift(decoder.wm.Decimal()).IntPart()
+	txData, err := nulsio_trans.NewDepositTxData(uint64(depositNa), address, agentHash)
+	if err != nil {
+		return err
+	}
+
+	//委托金额锁定在委托地址，找零退回委托地址
+	lockTime := nulsio_trans.ConsensusLockTime
+	vouts := []nulsio_trans.Vout{
+		{Address: address, Amount: uint64(depositNa), LockTime: uint64(lockTime)},
+	}
+	changeAmount := balance.Sub(totalSend)
+	if changeAmount.GreaterThan(decimal.Zero) {
+		vouts = append(vouts, nulsio_trans.Vout{Address: address, Amount: uint64(changeAmount.Shift(decoder.wm.Decimal()).IntPart())})
+	}
+
+	rawTx.FeeRate = feesRate.StringFixed(decoder.wm.Decimal())
+	rawTx.Fees = fees.StringFixed(decoder.wm.Decimal())
+	rawTx.TxAmount = "-" + fees.StringFixed(decoder.wm.Decimal())
+
+	decoder.wm.Logger(LogSubsystemTx).Info("build join consensus transaction",
+		"address", address,
+		"agentHash", agentHash,
+		"deposit", amount.StringFixed(decoder.wm.Decimal()),
+		"fees", fees.StringFixed(decoder.wm.Decimal()),
+		"change", changeAmount.StringFixed(decoder.wm.Decimal()))
+
+	return decoder.createTypedRawTransaction(wrapper, rawTx, TxTypeJoinConsensus, usedUTXO, vouts, txData)
+}
+
+//CreateCancelDepositRawTransaction 创建取消委托交易
+//扩展参数joinTxHash为委托交易hash，委托金额扣除手续费后退回委托地址
+func (decoder *TransactionDecoder) CreateCancelDepositRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	var (
+		joinTxHash = rawTx.GetExtParam().Get("joinTxHash").String()
+		deposit    *Deposit
+	)
+
+	if len(joinTxHash) == 0 {
+		return errors.New("joinTxHash is empty!")
+	}
+
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID)
+	if err != nil {
+		return err
+	}
+
+	searchAddrs := make([]string, 0)
+	for _, a := range addresses {
+		searchAddrs = append(searchAddrs, a.Address)
+	}
+
+	deposits, err := decoder.wm.GetAccountDeposits(searchAddrs...)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deposits {
+		if d.TxHash == joinTxHash {
+			deposit = d
+			break
+		}
+	}
+
+	if deposit == nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "can not find deposit[%s] in account", joinTxHash)
+	}
+
+	feesRate, err := decoder.wm.EstimateFeeRate()
+	if err != nil {
+		return err
+	}
+
+	fees, err := decoder.wm.EstimateFee(1, 1, "", feesRate)
+	if err != nil {
+		return err
+	}
+
+	depositAmount := decimal.New(deposit.Deposit, -decoder.wm.Decimal())
+	if depositAmount.LessThanOrEqual(fees) {
+		return openwallet.Errorf(openwallet.ErrInsufficientFees, "deposit: %s is not enough to pay fees: %s", depositAmount.String(), fees.String())
+	}
+
+	txData, err := nulsio_trans.NewCancelDepositTxData(joinTxHash)
+	if err != nil {
+		return err
+	}
+
+	//委托交易中锁定的委托金额
+	depositIndex, err := decoder.wm.getDepositOutputIndex(deposit)
+	if err != nil {
+		return err
+	}
+	usedUTXO := []*UtxoDto{
+		{TxHash: joinTxHash, TxIndex: depositIndex, Value: deposit.Deposit, LockTime: nulsio_trans.ConsensusLockTime, Address: deposit.Address},
+	}
+	vouts := []nulsio_trans.Vout{
+		{Address: deposit.Address, Amount: uint64(depositAmount.Sub(fees).Shift(decoder.wm.Decimal()).IntPart())},
+	}
+
+	rawTx.FeeRate = feesRate.StringFixed(decoder.wm.Decimal())
+	rawTx.Fees = fees.StringFixed(decoder.wm.Decimal())
+	rawTx.TxAmount = "-" + fees.StringFixed(decoder.wm.Decimal())
+
+	decoder.wm.Logger(LogSubsystemTx).Info("build cancel deposit transaction",
+		"address", deposit.Address,
+		"joinTxHash", joinTxHash,
+		"deposit", depositAmount.StringFixed(decoder.wm.Decimal()),
+		"fees", fees.StringFixed(decoder.wm.Decimal()))
+
+	return decoder.createTypedRawTransaction(wrapper, rawTx, TxTypeCancelDeposit, usedUTXO, vouts, txData)
+}
+
+//createTypedRawTransaction 创建带交易业务数据的原始交易单
+func (decoder *TransactionDecoder) createTypedRawTransaction(
+	wrapper openwallet.WalletDAI,
+	rawTx *openwallet.RawTransaction,
+	txType int64,
+	usedUTXO []*UtxoDto,
+	vouts []nulsio_trans.Vout,
+	txData []byte,
+) error {
+
+	var (
+		vins       = make([]nulsio_trans.Vin, 0)
+		txFrom     = make([]string, 0)
+		txTo       = make([]string, 0)
+		changes    = make([]*PendingChange, 0)
+		addressMap = make(map[string]string)
+	)
+
+	if len(usedUTXO) == 0 {
+		return fmt.Errorf("utxo is empty")
+	}
+
+	for _, utxo := range usedUTXO {
+		vins = append(vins, nulsio_trans.Vin{TxID: utxo.TxHash, Vout: uint32(utxo.TxIndex), Amount: uint64(utxo.Value), LockTime: uint64(utxo.LockTime)})
+		addressMap[utxo.Address] = utxo.Address
+		txFrom = append(txFrom, fmt.Sprintf("%s:%s", utxo.Address, decimal.New(utxo.Value, -decoder.wm.Decimal()).String()))
+	}
+
+	for i, out := range vouts {
+		//输入地址未锁定的输出为找零
+		if _, ok := addressMap[out.Address]; ok && out.LockTime == 0 {
+			changes = append(changes, &PendingChange{TxIndex: int32(i), Value: int64(out.Amount), Address: out.Address})
+		}
+		txTo = append(txTo, fmt.Sprintf("%s:%s", out.Address, decimal.New(int64(out.Amount), -decoder.wm.Decimal()).String()))
+	}
+
+	signTrans, err := nulsio_trans.CreateEmptyTypedRawTransaction(txType, vins, vouts, "", txData)
+	if err != nil {
+		return fmt.Errorf("create transaction failed, unexpected error: %v", err)
+	}
+
+	rawTx.RawHex = signTrans
+
+	//装配签名，签名顺序与输入地址一致
+	if err = decoder.setKeySignatures(wrapper, rawTx, signerAddresses(usedUTXO)); err != nil {
+		return err
+	}
+	rawTx.IsBuilt = true
+	rawTx.TxFrom = txFrom
+	rawTx.TxTo = txTo
+
+	//记录交易输入，用于导出离线签名包
+	if err = setRawTxInputs(rawTx, usedUTXO); err != nil {
+		return err
+	}
+
+	//锁定已使用的utxo，避免后续交易单重复使用
+	err = decoder.wm.LockUnspent(rawTx, usedUTXO, changes)
+	if err != nil {
+		return fmt.Errorf("lock unspent failed, unexpected error: %v", err)
+	}
+
+	return nil
+}
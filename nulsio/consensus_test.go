@@ -0,0 +1,54 @@
+package nulsio
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestWalletManager_GetAccountDeposits(t *testing.T) {
+
+	wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {
+		var data interface{}
+		switch r.URL.Path {
+		case "/api/consensus/deposit/address/addrA":
+			page := DepositPage{PageSize: 100, Total: 3, Pages: 2}
+			if r.URL.Query().Get("pageNumber") == "1" {
+				page.PageNumber = 1
+				page.List = []*Deposit{
+					{TxHash: "join1", Address: "addrA", Deposit: 200000000000},
+					{TxHash: "join0", Address: "addrA", Deposit: 200000000000, DeleteHeight: 50},
+				}
+			} else {
+				page.PageNumber = 2
+				page.List = []*Deposit{{TxHash: "join2", Address: "addrA", Deposit: 300000000000}}
+			}
+			data = page
+		case "/api/tx/hash/join2":
+			//找零在前，委托金额不是第一个输出
+			data = &Tx{Hash: "join2", Type: TxTypeJoinConsensus, Outputs: []*Output{
+				{Address: "addrA", Value: 100000000},
+				{Address: "addrA", Value: 300000000000, LockTime: -1},
+			}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+	})
+	defer server.Close()
+
+	deposits, err := wm.GetAccountDeposits("addrA")
+	if err != nil {
+		t.Fatalf("GetAccountDeposits failed, err: %v", err)
+	}
+	if len(deposits) != 2 || deposits[0].TxHash != "join1" || deposits[1].TxHash != "join2" {
+		t.Errorf("deposits = %+v, want join1, join2", deposits)
+	}
+
+	index, err := wm.getDepositOutputIndex(deposits[1])
+	if err != nil || index != 1 {
+		t.Errorf("deposit output index = %d, want 1, err: %v", index, err)
+	}
+
+	if _, err := wm.getDepositOutputIndex(&Deposit{TxHash: "join2", Address: "addrA", Deposit: 1}); err == nil {
+		t.Errorf("deposit output with different amount should not be found")
+	}
+}
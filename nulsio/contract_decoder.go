@@ -2,14 +2,25 @@ package nulsio
 
 import (
 	"errors"
-	"github.com/blocktree/openwallet/log"
+	"fmt"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
+	"math/big"
+	"strconv"
+	"sync"
+)
+
+const (
+	TokenBalanceSourceExplorer = "explorer" //代币余额从浏览器接口查询
+	TokenBalanceSourceContract = "contract" //代币余额从合约只读方法查询
 )
 
 type NulsContractDecoder struct {
 	*openwallet.SmartContractDecoderBase
 	wm *WalletManager
+
+	activeHeights map[string]uint64 //地址最近一次代币交易的区块高度，key为合约地址:地址
+	activeMu      sync.RWMutex
 }
 
 
@@ -17,6 +28,7 @@ type NulsContractDecoder struct {
 func NewContractDecoder(wm *WalletManager) *NulsContractDecoder {
 	decoder := NulsContractDecoder{}
 	decoder.wm = wm
+	decoder.activeHeights = make(map[string]uint64)
 	return &decoder
 }
 
@@ -59,7 +71,6 @@ func (this *WalletManager) GetTokenBalanceByAddress(contractAddr string, addrs .
 	var err error
 
 	go func() {
-		log.Debugf("in save thread.")
 		for i := 0; i < count; i++ {
 			addr := <-resultChan
 			if !addr.ValidTokenBalance() {
@@ -79,7 +90,7 @@ func (this *WalletManager) GetTokenBalanceByAddress(contractAddr string, addrs .
 
 		balance, err := this.Api.GetTokenBalances(contractAddr,addr.GetAddress())
 		if err != nil {
-			log.Errorf("get address[%v] nrc20 token balance failed, err=%v", addr.GetAddress(), err)
+			this.Logger(LogSubsystemContract).Error("get nrc20 token balance failed", "contract", contractAddr, "address", addr.GetAddress(), "err", err)
 			return
 		}
 
@@ -124,9 +135,9 @@ func (this *NulsContractDecoder) GetTokenBalanceByAddress(contract openwallet.Sm
 			<-threadControl
 		}()
 
-		balanceTemp, err := this.wm.Api.GetTokenBalancesReal(contract.Address,address)
+		balanceTemp, err := this.getTokenBalanceReal(contract.Address, address)
 		if err != nil {
-			log.Errorf("get address[%v] nrc20 token balance failed, err=%v",address, err)
+			this.wm.Logger(LogSubsystemContract).Error("get nrc20 token balance failed", "contract", contract.Address, "address", address, "err", err)
 			return
 		}
 		//log.Error(balanceTemp.String())
@@ -153,8 +164,211 @@ func (this *NulsContractDecoder) GetTokenBalanceByAddress(contract openwallet.Sm
 	<-done
 
 	if len(tokenBalanceList) != count {
-		log.Error("unknown errors occurred .")
+		this.wm.Logger(LogSubsystemContract).Error("get nrc20 token balances incomplete", "contract", contract.Address, "expected", count, "got", len(tokenBalanceList))
 		return nil, errors.New("unknown errors occurred ")
 	}
 	return tokenBalanceList, nil
 }
+
+//ContractViewResult 合约只读方法的返回结果
+type ContractViewResult struct {
+	ContractAddress string
+	MethodName      string
+	Raw             string
+}
+
+//String 返回原始结果
+func (r *ContractViewResult) String() string {
+	return r.Raw
+}
+
+//BigInt 结果转为整数
+func (r *ContractViewResult) BigInt() (*big.Int, error) {
+	value, ok := new(big.Int).SetString(r.Raw, 10)
+	if !ok {
+		return nil, fmt.Errorf("contract method [%s] result: %s is not integer", r.MethodName, r.Raw)
+	}
+	return value, nil
+}
+
+//Uint64 结果转为uint64
+func (r *ContractViewResult) Uint64() (uint64, error) {
+	return strconv.ParseUint(r.Raw, 10, 64)
+}
+
+//Bool 结果转为bool
+func (r *ContractViewResult) Bool() (bool, error) {
+	return strconv.ParseBool(r.Raw)
+}
+
+//Decimal 结果按精度转为小数
+func (r *ContractViewResult) Decimal(decimals int32) (decimal.Decimal, error) {
+	value, err := decimal.NewFromString(r.Raw)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("contract method [%s] result: %s is not number", r.MethodName, r.Raw)
+	}
+	return value.Shift(-decimals), nil
+}
+
+//contractArgToString 合约参数转为节点接口需要的字符串
+func contractArgToString(arg interface{}) (string, error) {
+	switch v := arg.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case *big.Int:
+		return v.String(), nil
+	case decimal.Decimal:
+		return v.String(), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported contract arg type: %T", arg)
+	}
+}
+
+//InvokeViewMethod 调用合约只读方法
+func (this *NulsContractDecoder) InvokeViewMethod(contractAddress, methodName string, args ...interface{}) (*ContractViewResult, error) {
+
+	strArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		str, err := contractArgToString(arg)
+		if err != nil {
+			return nil, err
+		}
+		strArgs = append(strArgs, str)
+	}
+
+	raw, err := this.wm.Api.InvokeContractView(contractAddress, methodName, "", strArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContractViewResult{
+		ContractAddress: contractAddress,
+		MethodName:      methodName,
+		Raw:             raw,
+	}, nil
+}
+
+//BalanceOf 查询地址代币余额，未按精度换算
+func (this *NulsContractDecoder) BalanceOf(contractAddress, address string) (*big.Int, error) {
+	result, err := this.InvokeViewMethod(contractAddress, "balanceOf", address)
+	if err != nil {
+		return nil, err
+	}
+	return result.BigInt()
+}
+
+//TotalSupply 查询代币总发行量，未按精度换算
+func (this *NulsContractDecoder) TotalSupply(contractAddress string) (*big.Int, error) {
+	result, err := this.InvokeViewMethod(contractAddress, "totalSupply")
+	if err != nil {
+		return nil, err
+	}
+	return result.BigInt()
+}
+
+//Allowance 查询owner授权给spender的代币额度，未按精度换算
+func (this *NulsContractDecoder) Allowance(contractAddress, owner, spender string) (*big.Int, error) {
+	result, err := this.InvokeViewMethod(contractAddress, "allowance", owner, spender)
+	if err != nil {
+		return nil, err
+	}
+	return result.BigInt()
+}
+
+//Decimals 查询代币精度
+func (this *NulsContractDecoder) Decimals(contractAddress string) (uint64, error) {
+	result, err := this.InvokeViewMethod(contractAddress, "decimals")
+	if err != nil {
+		return 0, err
+	}
+	return result.Uint64()
+}
+
+//markActive 记录地址在区块高度上有代币交易
+func (this *NulsContractDecoder) markActive(contractAddress, address string, height uint64) {
+	this.activeMu.Lock()
+	defer this.activeMu.Unlock()
+	if this.activeHeights == nil {
+		this.activeHeights = make(map[string]uint64)
+	}
+	key := contractAddress + ":" + address
+	if height > this.activeHeights[key] {
+		this.activeHeights[key] = height
+	}
+}
+
+//recentlyActive 地址在最近TokenBalanceViewBlocks个已扫描区块内是否有代币交易，浏览器索引可能还未更新
+func (this *NulsContractDecoder) recentlyActive(contractAddress, address string) bool {
+	if this.wm.Config.TokenBalanceViewBlocks == 0 {
+		return false
+	}
+
+	this.activeMu.RLock()
+	height, ok := this.activeHeights[contractAddress+":"+address]
+	this.activeMu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	scannedHeight, _ := this.wm.GetLocalNewBlock()
+	return height+this.wm.Config.TokenBalanceViewBlocks > scannedHeight
+}
+
+//markTokenActive 记录地址的代币交易，之后一段区块内余额从合约查询
+func (wm *WalletManager) markTokenActive(contractAddress, address string, height uint64) {
+	if decoder, ok := wm.ContractDecoder.(*NulsContractDecoder); ok {
+		decoder.markActive(contractAddress, address, height)
+	}
+}
+
+//getTokenBalanceReal 查询地址代币余额，未按精度换算
+//最近有代币交易的地址从合约查询，避免浏览器索引滞后，浏览器接口失败时也从合约查询
+func (this *NulsContractDecoder) getTokenBalanceReal(contractAddress, address string) (decimal.Decimal, error) {
+
+	if this.wm.Config.TokenBalanceSource != TokenBalanceSourceContract && !this.recentlyActive(contractAddress, address) {
+		balance, err := this.wm.Api.GetTokenBalancesReal(contractAddress, address)
+		if err == nil {
+			return balance, nil
+		}
+		this.wm.Logger(LogSubsystemContract).Warn("get nrc20 token balance from explorer failed, try contract view", "contract", contractAddress, "address", address, "err", err)
+	}
+
+	balance, err := this.BalanceOf(contractAddress, address)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return decimal.NewFromBigInt(balance, 0), nil
+}
+
+//GetTokenBalance 查询地址代币余额，按合约精度换算
+func (wm *WalletManager) GetTokenBalance(contractAddress string, decimals uint64, address string) (decimal.Decimal, error) {
+
+	decoder, ok := wm.ContractDecoder.(*NulsContractDecoder)
+	if !ok {
+		return wm.Api.GetTokenBalances(contractAddress, address)
+	}
+
+	balance, err := decoder.getTokenBalanceReal(contractAddress, address)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return balance.Shift(-int32(decimals)), nil
+}
@@ -0,0 +1,115 @@
+package nulsio
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/blocktree/openwallet/log"
+	"github.com/shopspring/decimal"
+)
+
+//testContractServer 模拟浏览器代币余额接口和合约只读方法接口
+func testContractServer(t *testing.T, explorerBalance, viewResult string, gotArgs *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data interface{}
+		switch r.URL.Path {
+		case "/api/contract/view":
+			var params struct {
+				ContractAddress string   `json:"contractAddress"`
+				MethodName      string   `json:"methodName"`
+				Args            []string `json:"args"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+				t.Errorf("decode contract view params failed, err: %v", err)
+			}
+			if gotArgs != nil {
+				*gotArgs = params.Args
+			}
+			data = map[string]interface{}{"result": viewResult}
+		default:
+			data = map[string]interface{}{"contractAddress": "contract", "amount": explorerBalance, "decimals": 2}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+	}))
+}
+
+func TestNulsContractDecoder_InvokeViewMethod(t *testing.T) {
+
+	var args []string
+	server := testContractServer(t, "0", "123456", &args)
+	defer server.Close()
+
+	wm := testStateWalletManager()
+	wm.Log = log.NewOWLogger(Symbol)
+	wm.Api = &Client{BaseURL: server.URL}
+	decoder := NewContractDecoder(wm)
+
+	result, err := decoder.InvokeViewMethod("contract", "custom", "owner", 5, uint64(7), big.NewInt(123), true, decimal.New(15, -1))
+	if err != nil {
+		t.Fatalf("InvokeViewMethod failed, err: %v", err)
+	}
+	if want := []string{"owner", "5", "7", "123", "true", "1.5"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+
+	if v, err := result.BigInt(); err != nil || v.String() != "123456" {
+		t.Errorf("BigInt = %v, err: %v", v, err)
+	}
+	if v, err := result.Uint64(); err != nil || v != 123456 {
+		t.Errorf("Uint64 = %v, err: %v", v, err)
+	}
+	if v, err := result.Decimal(2); err != nil || v.String() != "1234.56" {
+		t.Errorf("Decimal = %v, err: %v", v, err)
+	}
+	if _, err := result.Bool(); err == nil {
+		t.Errorf("Bool of integer result should fail")
+	}
+
+	if _, err := decoder.InvokeViewMethod("contract", "custom", []string{"a"}); err == nil {
+		t.Errorf("unsupported arg type should fail")
+	}
+
+	if _, err := (&ContractViewResult{MethodName: "name", Raw: "token"}).BigInt(); err == nil {
+		t.Errorf("BigInt of non-integer result should fail")
+	}
+}
+
+func TestNulsContractDecoder_BalanceOfRecentlyActive(t *testing.T) {
+
+	server := testContractServer(t, "100", "150", nil)
+	defer server.Close()
+
+	wm := testStateWalletManager()
+	wm.Log = log.NewOWLogger(Symbol)
+	wm.Config.TokenBalanceSource = TokenBalanceSourceExplorer
+	wm.Config.TokenBalanceViewBlocks = 10
+	wm.Api = &Client{BaseURL: server.URL}
+	decoder := NewContractDecoder(wm)
+	wm.ContractDecoder = decoder
+
+	storage, _ := wm.GetStorage()
+	storage.SaveLocalBlockWithCursor(&NusBlock{Height: 100, Hash: "h100"})
+
+	balance, err := decoder.getTokenBalanceReal("contract", "addr")
+	if err != nil || balance.String() != "100" {
+		t.Errorf("balance = %v, want explorer balance 100, err: %v", balance, err)
+	}
+
+	//最近有代币交易，浏览器可能未更新，从合约查询
+	wm.markTokenActive("contract", "addr", 95)
+	balance, err = decoder.getTokenBalanceReal("contract", "addr")
+	if err != nil || balance.String() != "150" {
+		t.Errorf("balance = %v, want contract balance 150, err: %v", balance, err)
+	}
+
+	//超过切换的区块数，恢复从浏览器查询
+	storage.SaveLocalBlockWithCursor(&NusBlock{Height: 110, Hash: "h110", PreHash: "h100"})
+	balance, err = decoder.getTokenBalanceReal("contract", "addr")
+	if err != nil || balance.String() != "100" {
+		t.Errorf("balance = %v, want explorer balance 100, err: %v", balance, err)
+	}
+}
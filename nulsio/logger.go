@@ -0,0 +1,281 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/blocktree/openwallet/log"
+)
+
+const (
+	//日志子系统
+	LogSubsystemScanner  = "scanner"
+	LogSubsystemAPI      = "api"
+	LogSubsystemTx       = "tx"
+	LogSubsystemContract = "contract"
+
+	//日志格式
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	//日志字段值的最大长度，超出部分截断
+	maxLogValueLength = 512
+)
+
+var (
+	//敏感字段，值不输出到日志
+	sensitiveLogKeys = map[string]bool{
+		"rawhex":              true,
+		"hex":                 true,
+		"txhex":               true,
+		"signature":           true,
+		"signatures":          true,
+		"sig":                 true,
+		"key":                 true,
+		"prv":                 true,
+		"priv":                true,
+		"prikey":              true,
+		"privkey":             true,
+		"privatekey":          true,
+		"encryptedprivatekey": true,
+		"wif":                 true,
+		"seed":                true,
+		"password":            true,
+	}
+
+	//原始交易等长hex串，交易hash和公钥不会超过这个长度
+	longHexPattern = regexp.MustCompile(`[0-9a-fA-F]{128,}`)
+	//64位以上的hex串可能是私钥，只在交易hash等字段中保留
+	hexKeyPattern = regexp.MustCompile(`[0-9a-fA-F]{64,}`)
+	//WIF格式的私钥
+	wifPattern = regexp.MustCompile(`\b[5KL][1-9A-HJ-NP-Za-km-z]{50,51}\b`)
+
+	//交易hash、区块hash等字段，值中的64位hex串不隐藏
+	hashLogKeys = map[string]bool{
+		"txid":        true,
+		"hash":        true,
+		"txhash":      true,
+		"blockhash":   true,
+		"prehash":     true,
+		"localhash":   true,
+		"mainnethash": true,
+		"jointxhash":  true,
+		"agenthash":   true,
+		"origintxid":  true,
+		"task":        true,
+		"observer":    true,
+	}
+
+	//未设置WalletManager日志时使用
+	defaultLog = log.NewOWLogger(Symbol)
+)
+
+//Logger 结构化日志，按子系统控制日志级别，输出前自动隐藏原始交易、签名和私钥
+type Logger struct {
+	base      *log.OWLogger
+	subsystem string
+	level     int
+	format    string
+	fields    []interface{}
+}
+
+//Logger 获取子系统的结构化日志，通过WalletManager.Log输出
+func (wm *WalletManager) Logger(subsystem string) *Logger {
+
+	l := &Logger{
+		base:      wm.Log,
+		subsystem: subsystem,
+		level:     logs.LevelDebug,
+		format:    LogFormatText,
+	}
+
+	if wm.Config != nil {
+		if level, ok := wm.Config.LogLevels[subsystem]; ok {
+			l.level = level
+		}
+		if len(wm.Config.LogFormat) > 0 {
+			l.format = wm.Config.LogFormat
+		}
+	}
+
+	return l
+}
+
+//With 创建带有固定字段的子日志
+func (l *Logger) With(fields ...interface{}) *Logger {
+	child := *l
+	child.fields = append(append([]interface{}{}, l.fields...), fields...)
+	return &child
+}
+
+//Debug 调试日志，fields为键值对
+func (l *Logger) Debug(msg string, fields ...interface{}) {
+	l.output(logs.LevelDebug, msg, fields)
+}
+
+//Info 信息日志，fields为键值对
+func (l *Logger) Info(msg string, fields ...interface{}) {
+	l.output(logs.LevelInformational, msg, fields)
+}
+
+//Warn 警告日志，fields为键值对
+func (l *Logger) Warn(msg string, fields ...interface{}) {
+	l.output(logs.LevelWarning, msg, fields)
+}
+
+//Error 错误日志，fields为键值对
+func (l *Logger) Error(msg string, fields ...interface{}) {
+	l.output(logs.LevelError, msg, fields)
+}
+
+//output 按级别过滤后格式化输出
+func (l *Logger) output(level int, msg string, fields []interface{}) {
+
+	if l == nil || level > l.level {
+		return
+	}
+
+	line := l.Format(msg, fields...)
+
+	base := l.base
+	if base == nil {
+		base = defaultLog
+	}
+
+	switch level {
+	case logs.LevelError:
+		base.Std.Error("%s", line)
+	case logs.LevelWarning:
+		base.Std.Warning("%s", line)
+	case logs.LevelInformational:
+		base.Std.Info("%s", line)
+	default:
+		base.Std.Debug("%s", line)
+	}
+}
+
+//Format 格式化日志内容，text格式为logfmt，json格式为单行json
+func (l *Logger) Format(msg string, fields ...interface{}) string {
+
+	all := make([]interface{}, 0, len(l.fields)+len(fields)+2)
+	all = append(all, "subsystem", l.subsystem)
+	all = append(all, l.fields...)
+	all = append(all, fields...)
+	msg = RedactSensitive(msg)
+
+	if l.format == LogFormatJSON {
+		obj := map[string]interface{}{"msg": msg}
+		for i := 0; i+1 < len(all); i += 2 {
+			key := fmt.Sprint(all[i])
+			obj[key] = redactLogValue(key, all[i+1])
+		}
+		data, _ := json.Marshal(obj)
+		return string(data)
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(all); i += 2 {
+		key := fmt.Sprint(all[i])
+		value := fmt.Sprint(redactLogValue(key, all[i+1]))
+		if strings.ContainsAny(value, " =\"") || len(value) == 0 {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(" ")
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+//redactLogValue 隐藏敏感字段的值，其他字段隐藏其中的原始交易和私钥，交易hash等字段之外的64位hex串按私钥隐藏
+func redactLogValue(key string, value interface{}) interface{} {
+
+	key = strings.ToLower(key)
+	if sensitiveLogKeys[key] {
+		return "[REDACTED]"
+	}
+
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case error:
+		s = v.Error()
+	case time.Duration:
+		return v.String()
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case int, int32, int64, uint, uint32, uint64, float64, bool:
+		return v
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	s = RedactSensitive(s)
+	if !hashLogKeys[key] {
+		s = hexKeyPattern.ReplaceAllString(s, "[REDACTED key]")
+	}
+	return s
+}
+
+//RedactSensitive 隐藏字符串中的原始交易hex、WIF私钥，并截断过长的内容
+func RedactSensitive(s string) string {
+	s = longHexPattern.ReplaceAllStringFunc(s, func(hex string) string {
+		return fmt.Sprintf("[REDACTED hex len=%d]", len(hex))
+	})
+	s = wifPattern.ReplaceAllString(s, "[REDACTED wif]")
+	if len(s) > maxLogValueLength {
+		s = s[:maxLogValueLength] + "...(truncated)"
+	}
+	return s
+}
+
+//parseLogLevels 解析子系统日志级别配置，格式：scanner:info,api:warn
+func parseLogLevels(value string) (map[string]int, error) {
+	levels := make(map[string]int)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("log level [%s] format is invalid", item)
+		}
+		level, ok := map[string]int{
+			"error": logs.LevelError,
+			"warn":  logs.LevelWarning,
+			"info":  logs.LevelInformational,
+			"debug": logs.LevelDebug,
+		}[strings.ToLower(strings.TrimSpace(parts[1]))]
+		if !ok {
+			return nil, fmt.Errorf("log level [%s] is unknown", item)
+		}
+		levels[strings.TrimSpace(parts[0])] = level
+	}
+	return levels, nil
+}
@@ -0,0 +1,98 @@
+package nulsio
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego/logs"
+)
+
+func TestLogger_Format(t *testing.T) {
+
+	wm := testStateWalletManager()
+	rawHex := strings.Repeat("0a1b", 64)
+
+	l := wm.Logger(LogSubsystemAPI).With("method", "SendRawTransaction")
+	line := l.Format("request failed", "txid", "0020ab", "rawHex", rawHex, "err", errors.New("tx "+rawHex+" rejected"))
+
+	want := `request failed subsystem=api method=SendRawTransaction txid=0020ab rawHex=[REDACTED] err="tx [REDACTED hex len=256] rejected"`
+	if line != want {
+		t.Errorf("text format = %s, want %s", line, want)
+	}
+
+	wm.Config.LogFormat = LogFormatJSON
+	line = wm.Logger(LogSubsystemScanner).Format("scanning block", "height", 100, "signature", "3045")
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		t.Fatalf("json format is invalid: %s, err: %v", line, err)
+	}
+	if obj["msg"] != "scanning block" || obj["subsystem"] != LogSubsystemScanner || obj["height"] != float64(100) || obj["signature"] != "[REDACTED]" {
+		t.Errorf("json format = %s", line)
+	}
+}
+
+func TestLogger_FormatPrivateKey(t *testing.T) {
+
+	wm := testStateWalletManager()
+	prikey := "0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab"
+	txid := "0020b4c8e2a1f6b9a1d1e9a2a06d13ce2f5e1e7e0a8d3e9b14a2b2c0f1a1e2d3c4"
+
+	line := wm.Logger(LogSubsystemTx).Format("sign transaction",
+		"key", prikey,
+		"prv", "00"+prikey,
+		"data", prikey,
+		"err", errors.New("invalid private key "+prikey),
+		"txid", txid,
+		"hash", txid)
+
+	want := `sign transaction subsystem=tx key=[REDACTED] prv=[REDACTED] data="[REDACTED key]" err="invalid private key [REDACTED key]" txid=` + txid + ` hash=` + txid
+	if line != want {
+		t.Errorf("text format = %s, want %s", line, want)
+	}
+}
+
+func TestRedactSensitive(t *testing.T) {
+
+	wif := "L1aW4aubDFB7yfras2S1mN3bqg9nwySY8nkoLmJebSLD5BWv3ENZ"
+	if got := RedactSensitive("import key " + wif); got != "import key [REDACTED wif]" {
+		t.Errorf("wif is not redacted: %s", got)
+	}
+
+	txid := "0020b4c8e2a1f6b9a1d1e9a2a06d13ce2f5e1e7e0a8d3e9b14a2b2c0f1a1e2d3c4"
+	if got := RedactSensitive("txid " + txid); got != "txid "+txid {
+		t.Errorf("txid should not be redacted: %s", got)
+	}
+
+	if got := RedactSensitive(strings.Repeat("x", maxLogValueLength+10)); len(got) != maxLogValueLength+len("...(truncated)") {
+		t.Errorf("long value is not truncated, length: %d", len(got))
+	}
+}
+
+func TestParseLogLevels(t *testing.T) {
+
+	levels, err := parseLogLevels("scanner:info, api:warn,tx:ERROR")
+	if err != nil {
+		t.Fatalf("parseLogLevels failed, err: %v", err)
+	}
+	if levels[LogSubsystemScanner] != logs.LevelInformational || levels[LogSubsystemAPI] != logs.LevelWarning || levels[LogSubsystemTx] != logs.LevelError {
+		t.Errorf("levels = %v", levels)
+	}
+
+	for _, value := range []string{"scanner", "scanner:verbose"} {
+		if _, err := parseLogLevels(value); err == nil {
+			t.Errorf("parseLogLevels(%s) should fail", value)
+		}
+	}
+
+	wm := testStateWalletManager()
+	wm.Config.LogLevels = levels
+	if l := wm.Logger(LogSubsystemAPI); l.level != logs.LevelWarning {
+		t.Errorf("api level = %d, want %d", l.level, logs.LevelWarning)
+	}
+	if l := wm.Logger(LogSubsystemContract); l.level != logs.LevelDebug {
+		t.Errorf("contract level = %d, want %d", l.level, logs.LevelDebug)
+	}
+}
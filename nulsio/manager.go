@@ -16,9 +16,12 @@
 package nulsio
 
 import (
+	"fmt"
+	"github.com/blocktree/nulsio-adapter/nulsio_trans"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
+	"sync"
 )
 
 type WalletManager struct {
@@ -32,6 +35,11 @@ type WalletManager struct {
 	ContractDecoder openwallet.SmartContractDecoder //智能合约解析器
 	Blockscanner    *NULSBlockScanner               //区块扫描器
 	CacheManager    openwallet.ICacheManager        //缓存管理器
+
+	storage   BlockchainStorage //本地数据存储
+	storageMu sync.Mutex
+	metrics   Metrics       //指标收集器
+	endpoints endpointCache //节点接口检查结果缓存
 }
 
 func NewWalletManager() *WalletManager {
@@ -42,6 +50,7 @@ func NewWalletManager() *WalletManager {
 	wm.Decoder = NewAddressDecoder(&wm)
 	wm.TxDecoder = NewTransactionDecoder(&wm)
 	wm.Log = log.NewOWLogger(wm.Symbol())
+	wm.Api.Logger = wm.Logger(LogSubsystemAPI)
 	wm.ContractDecoder = NewContractDecoder(&wm)
 	return &wm
 }
@@ -66,9 +75,53 @@ func (wm *WalletManager) EstimateFeeRate() (decimal.Decimal, error) {
 	return rate, nil
 }
 
-//EstimateFeeRate 预估的没KB手续费率
+//EstimateTokenFeeRate 预估的代币交易手续费，按默认gas上限计算
 func (wm *WalletManager) EstimateTokenFeeRate() (decimal.Decimal, error) {
 
-	rate, _ := decimal.NewFromString("0.007")
-	return rate, nil
+	return wm.EstimateContractFee(wm.Config.ContractGasLimit, wm.Config.ContractGasPrice)
+}
+
+//EstimateContractFee 合约调用手续费 = 交易手续费 + 最大gas消耗
+func (wm *WalletManager) EstimateContractFee(gasLimit, gasPrice uint64) (decimal.Decimal, error) {
+
+	gasFee := decimal.New(int64(gasLimit*gasPrice), 0).Shift(-wm.Decimal())
+	return wm.Config.ContractTxFee.Add(gasFee), nil
+}
+
+//EstimateContractGas 通过节点预估合约调用的gas，并加上安全系数
+func (wm *WalletManager) EstimateContractGas(token *nulsio_trans.TxToken) (uint64, error) {
+
+	if token == nil {
+		return 0, fmt.Errorf("contract call is nil")
+	}
+
+	gasPrice := token.Price
+	if gasPrice == 0 {
+		gasPrice = wm.Config.ContractGasPrice
+	}
+
+	imputedGas, err := wm.Api.ImputedGasCallContract(token.Sender, token.ContractAddress, token.MethodName, token.Value, gasPrice, token.ContractArgs())
+	if err != nil {
+		return 0, err
+	}
+
+	gasLimit := uint64(decimal.New(int64(imputedGas), 0).Mul(wm.Config.ContractGasMargin).Ceil().IntPart())
+	if gasLimit < imputedGas {
+		gasLimit = imputedGas
+	}
+
+	if wm.Config.ContractMaxGasLimit > 0 && gasLimit > wm.Config.ContractMaxGasLimit {
+		if imputedGas > wm.Config.ContractMaxGasLimit {
+			return 0, fmt.Errorf("imputed gas: %d is over max gas limit: %d", imputedGas, wm.Config.ContractMaxGasLimit)
+		}
+		gasLimit = wm.Config.ContractMaxGasLimit
+	}
+
+	//验证合约调用是否能成功执行
+	err = wm.Api.ValidateCallContract(token.Sender, token.ContractAddress, token.MethodName, token.Value, gasLimit, gasPrice, token.ContractArgs())
+	if err != nil {
+		return 0, err
+	}
+
+	return gasLimit, nil
 }
@@ -0,0 +1,84 @@
+package nulsio
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/blocktree/nulsio-adapter/nulsio_trans"
+	"github.com/shopspring/decimal"
+)
+
+func TestWalletManager_EstimateContractGas(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		imputed  string
+		validate bool
+		want     uint64
+		wantErr  bool
+	}{
+		{name: "margin", imputed: `{"success":true,"data":{"gasLimit":100000}}`, validate: true, want: 120000},
+		{name: "clamp to max", imputed: `{"success":true,"data":{"gasLimit":140000}}`, validate: true, want: 150000},
+		{name: "over max", imputed: `{"success":true,"data":{"gasLimit":160000}}`, wantErr: true},
+		{name: "imputed failed", imputed: `{"success":false,"msg":"contract error"}`, wantErr: true},
+		{name: "gas limit empty", imputed: `{"success":true,"data":{}}`, wantErr: true},
+		{name: "validate failed", imputed: `{"success":true,"data":{"gasLimit":100000}}`, validate: false, wantErr: true},
+	}
+
+	for _, test := range tests {
+
+		var validated uint64
+		wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {
+			var params map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&params)
+			switch r.URL.Path {
+			case "/api/contract/imputedgas/call":
+				w.Write([]byte(test.imputed))
+			case "/api/contract/validate/call":
+				validated = uint64(params["gasLimit"].(float64))
+				if test.validate {
+					w.Write([]byte(`{"success":true,"data":{"value":true}}`))
+				} else {
+					w.Write([]byte(`{"success":false,"msg":"out of gas"}`))
+				}
+			}
+		})
+		wm.Config = NewConfig(Symbol)
+		wm.Config.ContractGasMargin = decimal.New(12, -1)
+		wm.Config.ContractMaxGasLimit = 150000
+
+		token := &nulsio_trans.TxToken{Sender: "sender", ContractAddress: "contract", MethodName: "transfer"}
+		gasLimit, err := wm.EstimateContractGas(token)
+		server.Close()
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: EstimateContractGas should fail, gas limit: %d", test.name, gasLimit)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: EstimateContractGas failed, err: %v", test.name, err)
+			continue
+		}
+		if gasLimit != test.want || validated != test.want {
+			t.Errorf("%s: gas limit = %d, validated = %d, want %d", test.name, gasLimit, validated, test.want)
+		}
+	}
+}
+
+func TestWalletManager_EstimateContractFee(t *testing.T) {
+
+	wm := testStateWalletManager()
+	wm.Config.ContractTxFee = decimal.New(2, -3)
+
+	//0.002 + 120000 * 25 / 10^8
+	fee, err := wm.EstimateContractFee(120000, 25)
+	if err != nil {
+		t.Fatalf("EstimateContractFee failed, err: %v", err)
+	}
+	if !fee.Equal(decimal.RequireFromString("0.032")) {
+		t.Errorf("contract fee = %s, want 0.032", fee.String())
+	}
+}
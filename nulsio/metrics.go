@@ -0,0 +1,299 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	MetricScannedHeight   = "nuls_scanner_scanned_height"         //已扫描高度
+	MetricChainHeight     = "nuls_scanner_chain_height"           //节点最新高度
+	MetricScanLag         = "nuls_scanner_lag_blocks"             //落后节点的区块数
+	MetricBlocksPerSecond = "nuls_scanner_blocks_per_second"      //最近一次扫描任务的扫描速度
+	MetricBlocksScanned   = "nuls_scanner_blocks_scanned_total"   //已扫描区块数
+	MetricExtractFailures = "nuls_scanner_extract_failures_total" //提取或通知失败次数，标签stage
+	MetricUnscanRecords   = "nuls_scanner_unscan_records"         //未扫记录数，标签state
+	MetricForks           = "nuls_scanner_forks_total"            //分叉次数
+	MetricAPILatency      = "nuls_api_request_duration_seconds"   //API请求耗时，标签method
+	MetricAPIErrors       = "nuls_api_request_errors_total"       //API请求失败次数，标签method
+	MetricBroadcast       = "nuls_broadcast_total"                //广播交易次数，标签result
+)
+
+//MetricsBuckets 直方图默认分桶，单位秒
+var MetricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+//Metrics 指标收集接口，labels为键值对，可接入其他指标系统的导出实现
+type Metrics interface {
+	//SetGauge 设置当前值
+	SetGauge(name string, value float64, labels ...string)
+	//AddCounter 累加计数
+	AddCounter(name string, delta float64, labels ...string)
+	//ObserveHistogram 记录一个观测值
+	ObserveHistogram(name string, value float64, labels ...string)
+}
+
+//noopMetrics 未启用指标时使用，不做任何记录
+type noopMetrics struct{}
+
+func (noopMetrics) SetGauge(name string, value float64, labels ...string)         {}
+func (noopMetrics) AddCounter(name string, delta float64, labels ...string)       {}
+func (noopMetrics) ObserveHistogram(name string, value float64, labels ...string) {}
+
+//metricsHistogram 直方图数据
+type metricsHistogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+//MetricsRegistry 进程内指标注册表，可直接查询指标值，并以Prometheus文本格式导出
+type MetricsRegistry struct {
+	mu         sync.RWMutex
+	buckets    []float64
+	gauges     map[string]float64
+	counters   map[string]float64
+	histograms map[string]*metricsHistogram
+}
+
+//NewMetricsRegistry 创建指标注册表
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		buckets:    MetricsBuckets,
+		gauges:     make(map[string]float64),
+		counters:   make(map[string]float64),
+		histograms: make(map[string]*metricsHistogram),
+	}
+}
+
+//metricKey 指标名称和标签组成的唯一键，格式与Prometheus一致
+func metricKey(name string, labels ...string) string {
+	if len(labels) < 2 {
+		return name
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", labels[i], strconv.Quote(labels[i+1])))
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+//SetGauge 设置当前值
+func (r *MetricsRegistry) SetGauge(name string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[metricKey(name, labels...)] = value
+}
+
+//AddCounter 累加计数
+func (r *MetricsRegistry) AddCounter(name string, delta float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[metricKey(name, labels...)] += delta
+}
+
+//ObserveHistogram 记录一个观测值
+func (r *MetricsRegistry) ObserveHistogram(name string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := metricKey(name, labels...)
+	h, ok := r.histograms[key]
+	if !ok {
+		h = &metricsHistogram{buckets: make([]uint64, len(r.buckets))}
+		r.histograms[key] = h
+	}
+	for i, le := range r.buckets {
+		if value <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+//Gauge 查询当前值
+func (r *MetricsRegistry) Gauge(name string, labels ...string) float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.gauges[metricKey(name, labels...)]
+}
+
+//Counter 查询累计值
+func (r *MetricsRegistry) Counter(name string, labels ...string) float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.counters[metricKey(name, labels...)]
+}
+
+//Histogram 查询观测次数和总和
+func (r *MetricsRegistry) Histogram(name string, labels ...string) (uint64, float64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.histograms[metricKey(name, labels...)]
+	if !ok {
+		return 0, 0
+	}
+	return h.count, h.sum
+}
+
+//WritePrometheus 以Prometheus文本格式导出所有指标
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var buf bytes.Buffer
+	writeSamples(&buf, "gauge", r.gauges)
+	writeSamples(&buf, "counter", r.counters)
+
+	keys := make([]string, 0, len(r.histograms))
+	for key := range r.histograms {
+		keys = append(keys, key)
+	}
+	sortMetricKeys(keys)
+	lastName := ""
+	for _, key := range keys {
+		name, labels := splitMetricKey(key)
+		if name != lastName {
+			fmt.Fprintf(&buf, "# TYPE %s histogram\n", name)
+			lastName = name
+		}
+		h := r.histograms[key]
+		for i, le := range r.buckets {
+			fmt.Fprintf(&buf, "%s_bucket{%s} %d\n", name, joinLabels(labels, "le="+strconv.Quote(formatMetricValue(le))), h.buckets[i])
+		}
+		fmt.Fprintf(&buf, "%s_bucket{%s} %d\n", name, joinLabels(labels, `le="+Inf"`), h.count)
+		fmt.Fprintf(&buf, "%s_sum%s %s\n", name, wrapLabels(labels), formatMetricValue(h.sum))
+		fmt.Fprintf(&buf, "%s_count%s %d\n", name, wrapLabels(labels), h.count)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+//ServeHTTP 提供Prometheus拉取指标的接口
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WritePrometheus(w)
+}
+
+//writeSamples 导出gauge或counter类型的指标
+func writeSamples(buf *bytes.Buffer, metricType string, samples map[string]float64) {
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sortMetricKeys(keys)
+	lastName := ""
+	for _, key := range keys {
+		name, _ := splitMetricKey(key)
+		if name != lastName {
+			fmt.Fprintf(buf, "# TYPE %s %s\n", name, metricType)
+			lastName = name
+		}
+		fmt.Fprintf(buf, "%s %s\n", key, formatMetricValue(samples[key]))
+	}
+}
+
+//sortMetricKeys 按指标名称和标签排序，同名指标相邻
+func sortMetricKeys(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		ni, li := splitMetricKey(keys[i])
+		nj, lj := splitMetricKey(keys[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return li < lj
+	})
+}
+
+//splitMetricKey 拆分指标名称和标签
+func splitMetricKey(key string) (string, string) {
+	i := strings.Index(key, "{")
+	if i < 0 {
+		return key, ""
+	}
+	return key[:i], key[i+1 : len(key)-1]
+}
+
+func joinLabels(labels, extra string) string {
+	if len(labels) == 0 {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrapLabels(labels string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+//apiMethodLabel 去掉请求路径中的参数、hash和地址，作为API指标的method标签
+func apiMethodLabel(path string) string {
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	segments := make([]string, 0)
+	for _, s := range strings.Split(path, "/") {
+		if len(s) == 0 || len(s) >= 20 || strings.IndexFunc(s, func(c rune) bool { return !unicode.IsDigit(c) }) < 0 {
+			continue
+		}
+		segments = append(segments, s)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+//observeAPI 记录API请求的耗时和失败次数
+func observeAPI(metrics Metrics, method string, start time.Time, err error) {
+	if metrics == nil {
+		return
+	}
+	metrics.ObserveHistogram(MetricAPILatency, time.Since(start).Seconds(), "method", method)
+	if err != nil {
+		metrics.AddCounter(MetricAPIErrors, 1, "method", method)
+	}
+}
+
+//SetMetrics 设置指标收集器，同时用于区块扫描器和节点客户端，nil则关闭指标
+func (wm *WalletManager) SetMetrics(metrics Metrics) {
+	wm.metrics = metrics
+	if wm.Api != nil {
+		wm.Api.Metrics = metrics
+	}
+}
+
+//GetMetrics 获取指标收集器，未设置时返回不做记录的实现
+func (wm *WalletManager) GetMetrics() Metrics {
+	if wm.metrics == nil {
+		return noopMetrics{}
+	}
+	return wm.metrics
+}
@@ -0,0 +1,90 @@
+package nulsio
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+
+	r := NewMetricsRegistry()
+	r.SetGauge(MetricScannedHeight, 100)
+	r.AddCounter(MetricBroadcast, 1, "result", "success")
+	r.AddCounter(MetricBroadcast, 2, "result", "success")
+	r.ObserveHistogram(MetricAPILatency, 0.02, "method", "/api/tx/hash")
+	r.ObserveHistogram(MetricAPILatency, 3, "method", "/api/tx/hash")
+
+	if v := r.Gauge(MetricScannedHeight); v != 100 {
+		t.Errorf("gauge = %v, want 100", v)
+	}
+	if v := r.Counter(MetricBroadcast, "result", "success"); v != 3 {
+		t.Errorf("counter = %v, want 3", v)
+	}
+	if count, sum := r.Histogram(MetricAPILatency, "method", "/api/tx/hash"); count != 2 || sum != 3.02 {
+		t.Errorf("histogram = %d %v, want 2 3.02", count, sum)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WritePrometheus(&buf); err != nil {
+		t.Errorf("WritePrometheus failed, err: %v", err)
+	}
+	for _, line := range []string{
+		"# TYPE nuls_scanner_scanned_height gauge",
+		"nuls_scanner_scanned_height 100",
+		`nuls_broadcast_total{result="success"} 3`,
+		`nuls_api_request_duration_seconds_bucket{method="/api/tx/hash",le="0.025"} 1`,
+		`nuls_api_request_duration_seconds_bucket{method="/api/tx/hash",le="+Inf"} 2`,
+		`nuls_api_request_duration_seconds_count{method="/api/tx/hash"} 2`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("exported metrics missing line: %s\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestApiMethodLabel(t *testing.T) {
+	tests := map[string]string{
+		"/api/block/height/3184990": "/api/block/height",
+		"/api/tx/hash/0020b4c8e2a1f6b9a1d1e9a2a06d13ce2f5e1e7e0a8d3e9b14a2b2c0f1a1e2d3c4": "/api/tx/hash",
+		"/api/tx/list/address?address=Nse2TpVsJd4gLoj79MAY8NHwEsYuXwtT&type=0":            "/api/tx/list/address",
+		"/api/accountledger/transaction/broadcast":                                        "/api/accountledger/transaction/broadcast",
+	}
+	for path, want := range tests {
+		if got := apiMethodLabel(path); got != want {
+			t.Errorf("apiMethodLabel(%s) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestClient_Metrics(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/block/newest") {
+			w.Write([]byte(`{"success":true,"data":{"height":10}}`))
+			return
+		}
+		w.Write([]byte(`{"success":false,"msg":"not found"}`))
+	}))
+	defer server.Close()
+
+	wm := testStateWalletManager()
+	wm.Api = &Client{BaseURL: server.URL}
+	registry := NewMetricsRegistry()
+	wm.SetMetrics(registry)
+
+	wm.Api.CallReq("/api/block/newest")
+	wm.Api.CallReq("/api/tx/hash/0020b4c8e2a1f6b9a1d1e9a2a06d13ce2f5e1e7e0a8d3e9b14a2b2c0f1a1e2d3c4")
+
+	if count, _ := registry.Histogram(MetricAPILatency, "method", "/api/block/newest"); count != 1 {
+		t.Errorf("api latency count = %d, want 1", count)
+	}
+	if v := registry.Counter(MetricAPIErrors, "method", "/api/block/newest"); v != 0 {
+		t.Errorf("api errors = %v, want 0", v)
+	}
+	if v := registry.Counter(MetricAPIErrors, "method", "/api/tx/hash"); v != 1 {
+		t.Errorf("api errors = %v, want 1", v)
+	}
+}
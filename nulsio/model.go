@@ -23,8 +23,24 @@ import (
 	"github.com/blocktree/openwallet/crypto"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
+	"time"
 )
 
+//NULS交易类型
+const (
+	TxTypeCoinbase         = 1   //共识奖励交易
+	TxTypeTransfer         = 2   //转账交易
+	TxTypeAlias            = 3   //设置别名交易
+	TxTypeJoinConsensus    = 5   //委托共识交易
+	TxTypeCancelDeposit    = 6   //取消委托交易
+	TxTypeStopAgent        = 9   //注销共识节点交易，退回节点的全部委托
+	TxTypeCallContract     = 101 //调用合约交易
+	TxTypeContractTransfer = 103 //合约转账交易
+)
+
+//MinDepositAmount 最小委托数量，单位NULS
+var MinDepositAmount = decimal.New(2000, 0)
+
 // Block model
 type Block struct {
 	/*
@@ -57,6 +73,10 @@ type UnscanRecord struct {
 	BlockHeight uint64
 	TxID        string
 	Reason      string
+	Attempts    int   //已重扫次数
+	NextRetryAt int64 //下次重扫时间
+	Dead        bool  //超过重扫次数，不再自动重扫
+	CreateAt    int64
 }
 
 //NewUnscanRecord new UnscanRecord
@@ -66,9 +86,88 @@ func NewUnscanRecord(height uint64, txID, reason string) *UnscanRecord {
 	obj.TxID = txID
 	obj.Reason = reason
 	obj.ID = common.Bytes2Hex(crypto.SHA256([]byte(fmt.Sprintf("%d_%s", height, txID))))
+	obj.CreateAt = time.Now().Unix()
+	obj.NextRetryAt = obj.CreateAt
 	return &obj
 }
 
+//IsRetryable 是否到了重扫时间
+func (r *UnscanRecord) IsRetryable(now int64) bool {
+	return !r.Dead && r.NextRetryAt <= now
+}
+
+//RetryFailed 重扫失败，按指数退避计算下次重扫时间，超过最大次数则不再自动重扫
+func (r *UnscanRecord) RetryFailed(reason string, now int64, interval, maxInterval time.Duration, maxAttempts int) {
+	r.Attempts++
+	if len(reason) > 0 {
+		r.Reason = reason
+	}
+	if maxAttempts > 0 && r.Attempts >= maxAttempts {
+		r.Dead = true
+		return
+	}
+	backoff := interval
+	for i := 1; i < r.Attempts && backoff < maxInterval; i++ {
+		backoff *= 2
+	}
+	if backoff > maxInterval {
+		backoff = maxInterval
+	}
+	r.NextRetryAt = now + int64(backoff/time.Second)
+}
+
+//NotifyRecord 已通知给观测者的提取数据，用于避免重复通知
+type NotifyRecord struct {
+	Key         string `storm:"id"` // primary key
+	BlockHeight uint64 `storm:"index"`
+	TxID        string
+	SourceKey   string
+	ContractID  string
+	Observer    string
+	CreateAt    int64
+}
+
+//NotifyKey 提取数据的幂等键，同一交易同一sourceKey的主币和代币数据分别通知，每个观测者分别记录
+func NotifyKey(observer, txID, sourceKey, contractID string) string {
+	return common.Bytes2Hex(crypto.SHA256([]byte(fmt.Sprintf("%s_%s_%s_%s", observer, txID, sourceKey, contractID))))
+}
+
+//NewNotifyRecord new NotifyRecord
+func NewNotifyRecord(height uint64, observer, txID, sourceKey, contractID string) *NotifyRecord {
+	obj := NotifyRecord{}
+	obj.Key = NotifyKey(observer, txID, sourceKey, contractID)
+	obj.BlockHeight = height
+	obj.TxID = txID
+	obj.SourceKey = sourceKey
+	obj.ContractID = contractID
+	obj.Observer = observer
+	obj.CreateAt = time.Now().Unix()
+	return &obj
+}
+
+//FeesSupportRecord 代币汇总时，手续费账户给地址充值的记录
+type FeesSupportRecord struct {
+	Address         string `storm:"id"` // primary key
+	ContractAddress string
+	Amount          string
+	CreateAt        int64
+}
+
+//NewFeesSupportRecord new FeesSupportRecord
+func NewFeesSupportRecord(address, contractAddress, amount string) *FeesSupportRecord {
+	obj := FeesSupportRecord{}
+	obj.Address = address
+	obj.ContractAddress = contractAddress
+	obj.Amount = amount
+	obj.CreateAt = time.Now().Unix()
+	return &obj
+}
+
+//IsExpired 充值是否已超过等待时间
+func (r *FeesSupportRecord) IsExpired(waitTime time.Duration) bool {
+	return time.Now().After(time.Unix(r.CreateAt, 0).Add(waitTime))
+}
+
 type UtxoDto struct {
 	TxHash   string `json:"fromHash"`
 	TxIndex  int32  `json:"fromIndex"`
@@ -77,6 +176,33 @@ type UtxoDto struct {
 	Address  string `json:"-"`
 }
 
+//LockTimeThreshold 锁定时间大于等于该值为毫秒时间戳，小于该值为区块高度
+const LockTimeThreshold int64 = 1000000000000
+
+//IsLockTimeUnlocked 锁定时间在当前高度和时间是否已解锁，负数为共识锁定
+func IsLockTimeUnlocked(lockTime, height int64, now time.Time) bool {
+	if lockTime == 0 {
+		return true
+	}
+	if lockTime < 0 {
+		return false
+	}
+	if lockTime >= LockTimeThreshold {
+		return lockTime <= now.UnixNano()/int64(time.Millisecond)
+	}
+	return lockTime < height
+}
+
+//IsUnlocked utxo在当前高度和时间是否可使用
+func (u *UtxoDto) IsUnlocked(height int64, now time.Time) bool {
+	return IsLockTimeUnlocked(u.LockTime, height, now)
+}
+
+//Key utxo的唯一标识
+func (u *UtxoDto) Key() string {
+	return fmt.Sprintf("%s:%d", u.TxHash, u.TxIndex)
+}
+
 func (u *UtxoDto) ScriptPubKey() string {
 	scriptPubkey, err := nulsio_addrdec.GetInputOwnerKey(u.TxHash, int64(u.TxIndex))
 	if err != nil {
@@ -120,6 +246,7 @@ func (n *NusBlock) BlockHeader(symbol string) *openwallet.BlockHeader {
 type Tx struct {
 	Hash         string    `json:"hash"`
 	BlockHeight  int64     `json:"blockHeight"`
+	BlockHash    string    `json:"blockHash"`
 	Time         int64     `json:"time"`
 	Value        int64     `json:"value"`
 	Type         int32     `json:"type"`
@@ -128,6 +255,87 @@ type Tx struct {
 	Status       int       `json:"status"`
 	ConfirmCount int32     `json:"confirmCount"`
 	ScriptSig    string    `json:"scriptSig"`
+	TxData       *TxData   `json:"txData"`
+}
+
+//TxData 交易业务数据，合约转账交易(103)记录发起的合约调用交易
+type TxData struct {
+	OrginTxHash     string `json:"orginTxHash"`
+	ContractAddress string `json:"contractAddress"`
+	Success         bool   `json:"success"`
+}
+
+//ContractResult 合约调用交易的执行结果
+type ContractResult struct {
+	Hash            string              `json:"-"`
+	Success         bool                `json:"success"`
+	Sender          string              `json:"sender"`
+	ContractAddress string              `json:"contractAddress"`
+	GasUsed         int64               `json:"gasUsed"`
+	Price           int64               `json:"price"`
+	TotalFee        int64               `json:"totalFee"`
+	RefundFee       int64               `json:"refundFee"`
+	Value           int64               `json:"value"`
+	Transfers       []*ContractTransfer `json:"transfers"`
+	TokenTransfers  []*NulsToken        `json:"tokenTransfers"`
+}
+
+//ContractTransfer 合约内部发起的主币转账，对应合约转账交易(103)
+type ContractTransfer struct {
+	TxHash string `json:"txHash"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Value  int64  `json:"value"`
+}
+
+//TxPage 地址交易列表的分页结果
+type TxPage struct {
+	PageNumber int   `json:"pageNumber"`
+	PageSize   int   `json:"pageSize"`
+	Total      int   `json:"total"`
+	Pages      int   `json:"pages"`
+	List       []*Tx `json:"list"`
+}
+
+//Deposit 共识委托
+type Deposit struct {
+	TxHash       string `json:"txHash"`
+	AgentHash    string `json:"agentHash"`
+	Address      string `json:"address"`
+	Deposit      int64  `json:"deposit"`
+	BlockHeight  int64  `json:"blockHeight"`
+	Time         int64  `json:"time"`
+	Status       int    `json:"status"` //0:等待共识，1:共识中
+	DeleteHeight int64  `json:"deleteHeight"`
+}
+
+//IsActive 委托是否未取消
+func (d *Deposit) IsActive() bool {
+	return d.DeleteHeight <= 0
+}
+
+//DepositPage 地址委托列表的一页
+type DepositPage struct {
+	PageNumber int        `json:"pageNumber"`
+	PageSize   int        `json:"pageSize"`
+	Total      int        `json:"total"`
+	Pages      int        `json:"pages"`
+	List       []*Deposit `json:"list"`
+}
+
+//Agent 共识节点
+type Agent struct {
+	AgentHash      string  `json:"agentHash"`
+	AgentName      string  `json:"agentName"`
+	AgentAddress   string  `json:"agentAddress"`
+	PackingAddress string  `json:"packingAddress"`
+	RewardAddress  string  `json:"rewardAddress"`
+	Deposit        int64   `json:"deposit"`
+	TotalDeposit   int64   `json:"totalDeposit"`
+	CommissionRate float64 `json:"commissionRate"`
+	MemberCount    int     `json:"memberCount"`
+	Status         int     `json:"status"` //0:未共识，1:共识中
+	DelHeight      int64   `json:"delHeight"`
 }
 
 type NulsToken struct {
@@ -165,6 +373,28 @@ type NulsBalance struct {
 	UnLockBalance decimal.Decimal
 }
 
+//AddressBalance 地址余额明细，单位NULS
+//对应openwallet.Balance：ConfirmBalance = Spendable，UnconfirmBalance = Pending，
+//Balance = Spendable + Reserved + ConsensusLocked + TimeLocked + Pending
+type AddressBalance struct {
+	Address         string
+	Spendable       decimal.Decimal //可使用余额
+	Reserved        decimal.Decimal //被未广播的交易单预留的余额，广播后不再计入
+	ConsensusLocked decimal.Decimal //共识锁定余额，lockTime为-1
+	TimeLocked      decimal.Decimal //按高度或时间锁定的余额
+	Pending         decimal.Decimal //已广播未确认的找零
+}
+
+//Total 总余额
+func (b *AddressBalance) Total() decimal.Decimal {
+	return b.Spendable.Add(b.Reserved).Add(b.ConsensusLocked).Add(b.TimeLocked).Add(b.Pending)
+}
+
+//Locked 锁定余额
+func (b *AddressBalance) Locked() decimal.Decimal {
+	return b.ConsensusLocked.Add(b.TimeLocked)
+}
+
 func (s UnspentSort) Len() int {
 	return len(s.Values)
 }
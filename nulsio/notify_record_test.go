@@ -0,0 +1,182 @@
+package nulsio
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/blocktree/openwallet/log"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+type testNotifyObserver struct {
+	id       string
+	fail     bool
+	notified map[string]int
+}
+
+func (o *testNotifyObserver) NotifyObserverID() string {
+	return o.id
+}
+
+func (o *testNotifyObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	return nil
+}
+
+func (o *testNotifyObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	if o.fail {
+		return fmt.Errorf("observer is down")
+	}
+	o.notified[sourceKey]++
+	return nil
+}
+
+func TestNULSBlockScanner_NotifyIdempotent(t *testing.T) {
+
+	wm := testStateWalletManager()
+	wm.Log = log.NewOWLogger(Symbol)
+	bs := NewNULSBlockScanner(wm)
+	observer := &testNotifyObserver{id: "observer", notified: make(map[string]int)}
+	bs.AddObserver(observer)
+
+	extractData := map[string]*openwallet.TxExtractData{
+		"a": openwallet.NewBlockExtractData(),
+		"b": openwallet.NewBlockExtractData(),
+	}
+
+	//通知失败记录交易级别的未扫记录
+	observer.fail = true
+	if err := bs.newExtractDataNotify(10, "tx", extractData); err == nil {
+		t.Errorf("newExtractDataNotify should fail")
+	}
+	records, _ := wm.GetUnscanRecords()
+	if len(records) != 1 || records[0].TxID != "tx" || records[0].BlockHeight != 10 {
+		t.Errorf("unscan records = %+v", records)
+	}
+
+	//部分已通知的数据不再重复通知
+	observer.fail = false
+	storage, _ := wm.GetStorage()
+	storage.SaveNotifyRecord(NewNotifyRecord(10, "observer", "tx", "a", ""))
+	if err := bs.newExtractDataNotify(10, "tx", extractData); err != nil {
+		t.Errorf("newExtractDataNotify failed, err: %v", err)
+	}
+	if err := bs.newExtractDataNotify(10, "tx", extractData); err != nil {
+		t.Errorf("newExtractDataNotify failed, err: %v", err)
+	}
+	if observer.notified["a"] != 0 || observer.notified["b"] != 1 {
+		t.Errorf("notified = %v, want a:0 b:1", observer.notified)
+	}
+
+	//分叉删除已通知记录后重新通知
+	wm.DeleteNotifyRecords(10)
+	bs.newExtractDataNotify(10, "tx", extractData)
+	if observer.notified["a"] != 1 || observer.notified["b"] != 2 {
+		t.Errorf("notified after fork = %v, want a:1 b:2", observer.notified)
+	}
+}
+
+func TestNULSBlockScanner_NotifyPerObserver(t *testing.T) {
+
+	wm := testStateWalletManager()
+	wm.Log = log.NewOWLogger(Symbol)
+	bs := NewNULSBlockScanner(wm)
+	succeeded := &testNotifyObserver{id: "succeeded", notified: make(map[string]int)}
+	failing := &testNotifyObserver{id: "failing", fail: true, notified: make(map[string]int)}
+	bs.AddObserver(succeeded)
+	bs.AddObserver(failing)
+
+	extractData := map[string]*openwallet.TxExtractData{"a": openwallet.NewBlockExtractData()}
+
+	if err := bs.newExtractDataNotify(10, "tx", extractData); err == nil {
+		t.Errorf("newExtractDataNotify should fail")
+	}
+
+	//重试时只通知失败的观测者
+	failing.fail = false
+	if err := bs.newExtractDataNotify(10, "tx", extractData); err != nil {
+		t.Errorf("newExtractDataNotify failed, err: %v", err)
+	}
+	if succeeded.notified["a"] != 1 || failing.notified["a"] != 1 {
+		t.Errorf("notified = %v, %v, want a:1 for both observers", succeeded.notified, failing.notified)
+	}
+}
+
+func TestWalletManager_PruneKeepsNotifyRecordsOfUnscan(t *testing.T) {
+
+	wm := testStateWalletManager()
+	wm.Config.BlockRetainCount = 10
+	storage, _ := wm.GetStorage()
+
+	for h := uint64(1); h <= 30; h++ {
+		storage.SaveNotifyRecord(NewNotifyRecord(h, "observer", fmt.Sprintf("tx%d", h), "key", ""))
+	}
+	//高度5的交易仍在重扫，高度3的交易已超过重扫次数
+	storage.SaveUnscanRecord(NewUnscanRecord(5, "tx5", "timeout"))
+	dead := NewUnscanRecord(3, "tx3", "timeout")
+	dead.Dead = true
+	storage.SaveUnscanRecord(dead)
+
+	if err := wm.PruneLocalBlocks(30); err != nil {
+		t.Fatalf("PruneLocalBlocks failed, err: %v", err)
+	}
+	for h, kept := range map[uint64]bool{2: false, 3: true, 5: true, 19: true} {
+		if _, err := storage.GetNotifyRecord(NotifyKey("observer", fmt.Sprintf("tx%d", h), "key", "")); (err == nil) != kept {
+			t.Errorf("notify record of height %d kept = %v, want %v", h, err == nil, kept)
+		}
+	}
+
+	//未扫记录处理完后，按区块保留策略清理
+	storage.DeleteUnscanRecordByID(dead.ID)
+	records, _ := storage.GetUnscanRecords()
+	for _, r := range records {
+		storage.DeleteUnscanRecordByID(r.ID)
+	}
+	if err := wm.PruneLocalBlocks(30); err != nil {
+		t.Fatalf("PruneLocalBlocks failed, err: %v", err)
+	}
+	for h, kept := range map[uint64]bool{5: false, 19: false, 20: true} {
+		if _, err := storage.GetNotifyRecord(NotifyKey("observer", fmt.Sprintf("tx%d", h), "key", "")); (err == nil) != kept {
+			t.Errorf("notify record of height %d kept = %v, want %v", h, err == nil, kept)
+		}
+	}
+}
+
+//testAnonymousObserver 没有实现NotifyObserverID的观测者
+type testAnonymousObserver struct {
+	notified map[string]int
+}
+
+func (o *testAnonymousObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	return nil
+}
+
+func (o *testAnonymousObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.notified[sourceKey]++
+	return nil
+}
+
+func TestNULSBlockScanner_NotifySameTypeObservers(t *testing.T) {
+
+	wm := testStateWalletManager()
+	wm.Log = log.NewOWLogger(Symbol)
+	bs := NewNULSBlockScanner(wm)
+	first := &testAnonymousObserver{notified: make(map[string]int)}
+	second := &testAnonymousObserver{notified: make(map[string]int)}
+	bs.AddObserver(first)
+	bs.AddObserver(second)
+
+	if notifyObserverID(first) == notifyObserverID(second) {
+		t.Fatalf("observers of the same type should have different ids: %s", notifyObserverID(first))
+	}
+
+	extractData := map[string]*openwallet.TxExtractData{"a": openwallet.NewBlockExtractData()}
+	if err := bs.newExtractDataNotify(10, "tx", extractData); err != nil {
+		t.Fatalf("newExtractDataNotify failed, err: %v", err)
+	}
+	if err := bs.newExtractDataNotify(10, "tx", extractData); err != nil {
+		t.Fatalf("newExtractDataNotify failed, err: %v", err)
+	}
+	if first.notified["a"] != 1 || second.notified["a"] != 1 {
+		t.Errorf("notified = %v, %v, want a:1 for both observers", first.notified, second.notified)
+	}
+}
@@ -16,9 +16,15 @@
 package nulsio
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/astaxie/beego/config"
+	"github.com/blocktree/nulsio-adapter/nulsio_addrdec"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
 )
 
 //CurveType 曲线类型
@@ -41,6 +47,15 @@ func (wm *WalletManager) Decimal() int32 {
 	return 8
 }
 
+//ChainID 地址的链ID，没有配置则为主网链ID
+func (wm *WalletManager) ChainID() int {
+	chainID, err := strconv.Atoi(wm.Config.ChainId)
+	if err != nil {
+		return nulsio_addrdec.MainnetChainID
+	}
+	return chainID
+}
+
 //BalanceModelType 余额模型类型
 func (wm *WalletManager) BalanceModelType() openwallet.BalanceModelType {
 	return openwallet.BalanceModelTypeAddress
@@ -67,12 +82,99 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 
 	wm.Config.ServerAPI = c.String("serverAPI")
 	wm.Api.BaseURL = wm.Config.ServerAPI
+	wm.Config.RPCAPI = c.String("rpcAPI")
+	wm.Api.RPCURL = wm.Config.RPCAPI
+
+	//地址的链ID
+	wm.Config.ChainId = c.DefaultString("chainId", wm.Config.ChainId)
+	if _, err := strconv.Atoi(wm.Config.ChainId); err != nil {
+		return fmt.Errorf("chainId: %s is invalid", wm.Config.ChainId)
+	}
 
 	wm.Config.DataDir = c.String("dataDir")
 
 	//数据文件夹
 	wm.Config.makeDataDir()
 
+	//合约调用gas配置
+	wm.Config.ContractGasLimit = uint64(c.DefaultInt64("contractGasLimit", int64(wm.Config.ContractGasLimit)))
+	wm.Config.ContractGasPrice = uint64(c.DefaultInt64("contractGasPrice", int64(wm.Config.ContractGasPrice)))
+	wm.Config.ContractMaxGasLimit = uint64(c.DefaultInt64("contractMaxGasLimit", int64(wm.Config.ContractMaxGasLimit)))
+	if margin, err := decimal.NewFromString(c.String("contractGasMargin")); err == nil {
+		wm.Config.ContractGasMargin = margin
+	}
+	if txFee, err := decimal.NewFromString(c.String("contractTxFee")); err == nil {
+		wm.Config.ContractTxFee = txFee
+	}
+
+	//代币余额查询来源
+	wm.Config.TokenBalanceSource = c.DefaultString("tokenBalanceSource", wm.Config.TokenBalanceSource)
+	wm.Config.TokenBalanceViewBlocks = uint64(c.DefaultInt64("tokenBalanceViewBlocks", int64(wm.Config.TokenBalanceViewBlocks)))
+
+	//代币汇总等待手续费到账的时间
+	if waitTime := c.DefaultInt64("feesSupportWaitTime", 0); waitTime > 0 {
+		wm.Config.FeesSupportWaitTime = time.Duration(waitTime) * time.Second
+	}
+
+	//交易单锁定utxo的有效时间
+	if expireTime := c.DefaultInt64("unspentLockExpireTime", 0); expireTime > 0 {
+		wm.Config.UnspentLockExpireTime = time.Duration(expireTime) * time.Second
+	}
+
+	//设置别名销毁NULS的配置
+	wm.Config.AliasBurnAddress = c.DefaultString("aliasBurnAddress", wm.Config.AliasBurnAddress)
+	if burnAmount, err := decimal.NewFromString(c.String("aliasBurnAmount")); err == nil {
+		wm.Config.AliasBurnAmount = burnAmount
+	}
+
+	//代币合约批量转账方法
+	wm.Config.BatchTransferMethod = c.String("batchTransferMethod")
+	wm.Config.BatchTransferMaxReceivers = c.DefaultInt("batchTransferMaxReceivers", wm.Config.BatchTransferMaxReceivers)
+
+	//本地区块保存策略
+	wm.Config.BlockRetainCount = uint64(c.DefaultInt64("blockRetainCount", int64(wm.Config.BlockRetainCount)))
+	wm.Config.BlockHeaderRetainCount = uint64(c.DefaultInt64("blockHeaderRetainCount", int64(wm.Config.BlockHeaderRetainCount)))
+	if interval := c.DefaultInt64("dbCompactInterval", 0); interval > 0 {
+		wm.Config.DBCompactInterval = time.Duration(interval) * time.Second
+	}
+	wm.Config.MaxDBSize = c.DefaultInt64("maxDBSize", wm.Config.MaxDBSize/1024/1024) * 1024 * 1024
+
+	//可信的区块检查点
+	checkpoints, err := parseCheckpoints(c.String("checkpoints"))
+	if err != nil {
+		return err
+	}
+	wm.Config.Checkpoints = checkpoints
+
+	//扫描失败区块的重扫策略
+	if interval := c.DefaultInt64("unscanRetryInterval", 0); interval > 0 {
+		wm.Config.UnscanRetryInterval = time.Duration(interval) * time.Second
+	}
+	if interval := c.DefaultInt64("unscanRetryMaxInterval", 0); interval > 0 {
+		wm.Config.UnscanRetryMaxInterval = time.Duration(interval) * time.Second
+	}
+	wm.Config.UnscanMaxAttempts = c.DefaultInt("unscanMaxAttempts", wm.Config.UnscanMaxAttempts)
+
+	//结构化日志配置
+	logLevels, err := parseLogLevels(c.String("logLevels"))
+	if err != nil {
+		return err
+	}
+	wm.Config.LogLevels = logLevels
+	wm.Config.LogFormat = c.DefaultString("logFormat", wm.Config.LogFormat)
+	if wm.Config.LogFormat != LogFormatText && wm.Config.LogFormat != LogFormatJSON {
+		return fmt.Errorf("log format [%s] is unknown", wm.Config.LogFormat)
+	}
+	wm.Api.Logger = wm.Logger(LogSubsystemAPI)
+
+	//健康检查
+	wm.Config.StatusMaxScanLag = uint64(c.DefaultInt64("statusMaxScanLag", int64(wm.Config.StatusMaxScanLag)))
+
+	//指标收集，已设置自定义收集器则不覆盖
+	wm.Config.EnableMetrics = c.DefaultBool("enableMetrics", wm.Config.EnableMetrics)
+	if wm.Config.EnableMetrics && wm.metrics == nil {
+		wm.SetMetrics(NewMetricsRegistry())
+	}
 
 	return nil
 }
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"fmt"
+
+	"github.com/blocktree/nulsio-adapter/nulsio_txsigner"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	//rawTxInputsKey 交易单扩展参数中记录交易输入的key
+	rawTxInputsKey = "inputs"
+)
+
+//RawTxInput 交易单使用的输入
+type RawTxInput struct {
+	TxHash  string `json:"txHash"`
+	TxIndex int32  `json:"txIndex"`
+	Value   int64  `json:"value"`
+	Address string `json:"address"`
+}
+
+//setRawTxInputs 记录交易单使用的输入，用于导出离线签名包
+func setRawTxInputs(rawTx *openwallet.RawTransaction, usedUTXO []*UtxoDto) error {
+	inputs := make([]*RawTxInput, 0, len(usedUTXO))
+	for _, u := range usedUTXO {
+		inputs = append(inputs, &RawTxInput{TxHash: u.TxHash, TxIndex: u.TxIndex, Value: u.Value, Address: u.Address})
+	}
+	return rawTx.SetExtParam(rawTxInputsKey, inputs)
+}
+
+//ExportSignBundle 导出离线签名包，在没有网络的冷钱包中签名
+func (decoder *TransactionDecoder) ExportSignBundle(rawTx *openwallet.RawTransaction) (*nulsio_txsigner.SignBundle, error) {
+
+	if !rawTx.IsBuilt || len(rawTx.RawHex) == 0 {
+		return nil, fmt.Errorf("transaction is not built")
+	}
+
+	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
+	owners := make(map[string]*openwallet.KeySignature)
+	for _, keySignature := range keySignatures {
+		owners[keySignature.Address.Address] = keySignature
+	}
+
+	inputs := make([]*nulsio_txsigner.BundleInput, 0)
+	for _, in := range rawTx.GetExtParam().Get(rawTxInputsKey).Array() {
+		address := in.Get("address").String()
+		owner, ok := owners[address]
+		if !ok {
+			return nil, fmt.Errorf("can not find signature of input owner: %s", address)
+		}
+		inputs = append(inputs, &nulsio_txsigner.BundleInput{
+			TxHash:    in.Get("txHash").String(),
+			TxIndex:   int32(in.Get("txIndex").Int()),
+			Amount:    in.Get("value").Int(),
+			Address:   address,
+			HDPath:    owner.Address.HDPath,
+			PublicKey: owner.Address.PublicKey,
+		})
+	}
+
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("transaction inputs is not recorded")
+	}
+
+	return nulsio_txsigner.NewSignBundle(rawTx.Coin.Symbol, rawTx.Account.AccountID, rawTx.RawHex, inputs)
+}
+
+//ImportSignBundleSignatures 验证离线签名并合并到交易单签名中
+func (decoder *TransactionDecoder) ImportSignBundleSignatures(rawTx *openwallet.RawTransaction, signatures []*nulsio_txsigner.BundleSignature) error {
+
+	bundle, err := decoder.ExportSignBundle(rawTx)
+	if err != nil {
+		return err
+	}
+
+	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
+	for _, sig := range signatures {
+
+		if err = nulsio_txsigner.VerifyBundleSignature(bundle, sig); err != nil {
+			return err
+		}
+
+		found := false
+		for _, keySignature := range keySignatures {
+			if keySignature.Address.Address == sig.Address {
+				keySignature.Signature = sig.Signature
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("address[%s] is not the owner of transaction inputs", sig.Address)
+		}
+	}
+
+	for _, keySignature := range keySignatures {
+		if len(keySignature.Signature) == 0 {
+			return fmt.Errorf("address[%s] has not signed", keySignature.Address.Address)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package nulsio
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	owcrypt "github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/nulsio-adapter/nulsio_addrdec"
+	"github.com/blocktree/nulsio-adapter/nulsio_txsigner"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//testOfflineKey 根据私钥生成地址
+func testOfflineKey(t *testing.T, prikeyHex string) ([]byte, *openwallet.Address) {
+	t.Helper()
+	prikey, _ := hex.DecodeString(prikeyHex)
+	//钱包地址保存未压缩公钥
+	pub, _ := owcrypt.GenPubkey(prikey, owcrypt.ECC_CURVE_SECP256K1)
+	address, err := nulsio_addrdec.GetAddressByPub(owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1))
+	if err != nil {
+		t.Fatalf("GetAddressByPub failed, err: %v", err)
+	}
+	return prikey, &openwallet.Address{Address: address, PublicKey: hex.EncodeToString(pub), HDPath: "m/44'/88'/0'/0/0"}
+}
+
+//testOfflineRawTx 创建已构建、待离线签名的交易单
+func testOfflineRawTx(t *testing.T, addrs ...*openwallet.Address) *openwallet.RawTransaction {
+	t.Helper()
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol},
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		RawHex:  "0200a1b2c3d4e5f6",
+		IsBuilt: true,
+	}
+	utxos := make([]*UtxoDto, 0)
+	keySigs := make([]*openwallet.KeySignature, 0)
+	for i, addr := range addrs {
+		utxos = append(utxos, &UtxoDto{TxHash: "tx0", TxIndex: int32(i), Value: 100000000, Address: addr.Address})
+		keySigs = append(keySigs, &openwallet.KeySignature{Address: addr})
+	}
+	if err := setRawTxInputs(rawTx, utxos); err != nil {
+		t.Fatalf("setRawTxInputs failed, err: %v", err)
+	}
+	rawTx.Signatures = map[string][]*openwallet.KeySignature{"account": keySigs}
+	return rawTx
+}
+
+func TestTransactionDecoder_OfflineSignRoundTrip(t *testing.T) {
+
+	var validated string
+	wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		json.NewDecoder(r.Body).Decode(&params)
+		validated = params["txHex"]
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{"value": true}})
+	})
+	defer server.Close()
+	decoder := NewTransactionDecoder(wm)
+
+	keyA, addrA := testOfflineKey(t, "0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+	keyB, addrB := testOfflineKey(t, "1f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+
+	rawTx := testOfflineRawTx(t, addrA, addrB)
+	bundle, err := decoder.ExportSignBundle(rawTx)
+	if err != nil {
+		t.Fatalf("ExportSignBundle failed, err: %v", err)
+	}
+
+	//冷钱包签名
+	sigA, err := nulsio_txsigner.Default.SignBundleWithPrivateKey(bundle, addrA.Address, keyA)
+	if err != nil {
+		t.Fatalf("SignBundleWithPrivateKey failed, err: %v", err)
+	}
+	sigB, err := nulsio_txsigner.Default.SignBundleWithPrivateKey(bundle, addrB.Address, keyB)
+	if err != nil {
+		t.Fatalf("SignBundleWithPrivateKey failed, err: %v", err)
+	}
+
+	if err := decoder.ImportSignBundleSignatures(rawTx, []*nulsio_txsigner.BundleSignature{sigA, sigB}); err != nil {
+		t.Fatalf("ImportSignBundleSignatures failed, err: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(nil, rawTx); err != nil {
+		t.Fatalf("VerifyRawTransaction failed, err: %v", err)
+	}
+	if !rawTx.IsCompleted || validated != rawTx.RawHex || !strings.HasPrefix(rawTx.RawHex, "0200a1b2c3d4e5f6") {
+		t.Errorf("completed = %v, raw hex = %s, validated = %s", rawTx.IsCompleted, rawTx.RawHex, validated)
+	}
+}
+
+func TestTransactionDecoder_ImportSignBundleSignaturesRejected(t *testing.T) {
+
+	wm := testStateWalletManager()
+	decoder := NewTransactionDecoder(wm)
+
+	keyA, addrA := testOfflineKey(t, "0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+	keyB, addrB := testOfflineKey(t, "1f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+
+	//签名地址不是交易输入的所有者
+	rawTx := testOfflineRawTx(t, addrA)
+	bundle, _ := decoder.ExportSignBundle(rawTx)
+	sigB, err := nulsio_txsigner.Default.SignBundleWithPrivateKey(bundle, addrB.Address, keyB)
+	if err != nil {
+		t.Fatalf("SignBundleWithPrivateKey failed, err: %v", err)
+	}
+	if err := decoder.ImportSignBundleSignatures(rawTx, []*nulsio_txsigner.BundleSignature{sigB}); err == nil {
+		t.Errorf("signature of wrong owner should be rejected")
+	}
+
+	//签名后交易单被篡改
+	rawTx = testOfflineRawTx(t, addrA)
+	bundle, _ = decoder.ExportSignBundle(rawTx)
+	sigA, err := nulsio_txsigner.Default.SignBundleWithPrivateKey(bundle, addrA.Address, keyA)
+	if err != nil {
+		t.Fatalf("SignBundleWithPrivateKey failed, err: %v", err)
+	}
+	rawTx.RawHex = "0200a1b2c3d4e5f7"
+	if err := decoder.ImportSignBundleSignatures(rawTx, []*nulsio_txsigner.BundleSignature{sigA}); err == nil {
+		t.Errorf("signature of tampered raw hex should be rejected")
+	}
+	if sig := rawTx.Signatures["account"][0].Signature; len(sig) != 0 {
+		t.Errorf("rejected signature should not be imported: %s", sig)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	//ScannerStateVersion 扫描器状态文件格式版本
+	ScannerStateVersion = 1
+)
+
+//ScannerState 扫描器状态，用于迁移扫描器到新的主机
+type ScannerState struct {
+	Version            int                  `json:"version"`
+	Symbol             string               `json:"symbol"`
+	BlockHeight        uint64               `json:"blockHeight"`
+	BlockHash          string               `json:"blockHash"`
+	Headers            []*NusBlock          `json:"headers"` //最近的区块头，不包含交易
+	UnscanRecords      []*UnscanRecord      `json:"unscanRecords"`
+	NotifyRecords      []*NotifyRecord      `json:"notifyRecords"` //已通知记录，重扫未扫记录时避免重复通知
+	UnspentLocks       []*UnspentLock       `json:"unspentLocks"`
+	PendingChanges     []*PendingChange     `json:"pendingChanges"`
+	FeesSupportRecords []*FeesSupportRecord `json:"feesSupportRecords"`
+	ExportAt           int64                `json:"exportAt"`
+}
+
+//ExportScannerState 导出扫描器状态，headerCount为导出的最近区块头数量
+func (wm *WalletManager) ExportScannerState(headerCount uint64) (*ScannerState, error) {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ScannerState{
+		Version:  ScannerStateVersion,
+		Symbol:   wm.Symbol(),
+		ExportAt: time.Now().Unix(),
+	}
+
+	state.BlockHeight, state.BlockHash, err = storage.GetLocalNewBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var from uint64 = 1
+	if state.BlockHeight > headerCount {
+		from = state.BlockHeight - headerCount + 1
+	}
+	blocks, err := storage.GetLocalBlocks(from, state.BlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	state.Headers = make([]*NusBlock, 0, len(blocks))
+	for _, b := range blocks {
+		b.TxList = nil
+		state.Headers = append(state.Headers, b)
+	}
+
+	if state.UnscanRecords, err = storage.GetUnscanRecords(); err != nil {
+		return nil, err
+	}
+	if state.NotifyRecords, err = storage.GetNotifyRecords(); err != nil {
+		return nil, err
+	}
+	if state.UnspentLocks, err = storage.GetAllUnspentLocks(); err != nil {
+		return nil, err
+	}
+	if state.PendingChanges, err = storage.GetAllPendingChanges(); err != nil {
+		return nil, err
+	}
+	if state.FeesSupportRecords, err = storage.GetFeesSupportRecords(); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+//ExportScannerStateFile 导出扫描器状态到文件
+func (wm *WalletManager) ExportScannerStateFile(path string, headerCount uint64) error {
+
+	state, err := wm.ExportScannerState(headerCount)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+//CheckScannerState 检查扫描器状态：版本、币种、区块头是否连续，以及是否与检查点一致
+func (wm *WalletManager) CheckScannerState(state *ScannerState) error {
+
+	if state.Version != ScannerStateVersion {
+		return fmt.Errorf("unsupported scanner state version: %d", state.Version)
+	}
+
+	if state.Symbol != wm.Symbol() {
+		return fmt.Errorf("scanner state symbol [%s] is not match %s", state.Symbol, wm.Symbol())
+	}
+
+	if state.BlockHeight == 0 || len(state.BlockHash) == 0 {
+		return fmt.Errorf("scanner state block cursor is empty")
+	}
+
+	if err := wm.VerifyCheckpoint(state.BlockHeight, state.BlockHash); err != nil {
+		return err
+	}
+
+	for i, header := range state.Headers {
+		if err := wm.VerifyCheckpoint(uint64(header.Height), header.Hash); err != nil {
+			return err
+		}
+		if i > 0 {
+			prev := state.Headers[i-1]
+			if header.Height != prev.Height+1 {
+				return fmt.Errorf("scanner state headers are not continuous between [%d] and [%d]", prev.Height, header.Height)
+			}
+			if header.PreHash != prev.Hash {
+				return fmt.Errorf("scanner state header [%d] is not linked to previous header", header.Height)
+			}
+		}
+	}
+
+	if n := len(state.Headers); n > 0 {
+		last := state.Headers[n-1]
+		if uint64(last.Height) == state.BlockHeight && last.Hash != state.BlockHash {
+			return fmt.Errorf("scanner state block cursor is not match header [%d]", last.Height)
+		}
+	}
+
+	return nil
+}
+
+//ImportScannerState 导入扫描器状态，所有数据在同一事务中写入，跳过本地已有的区块
+func (wm *WalletManager) ImportScannerState(state *ScannerState) error {
+
+	if err := wm.CheckScannerState(state); err != nil {
+		return err
+	}
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	return storage.ImportScannerState(state)
+}
+
+//ImportScannerStateFile 从文件导入扫描器状态
+func (wm *WalletManager) ImportScannerStateFile(path string) error {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var state ScannerState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	return wm.ImportScannerState(&state)
+}
+
+//VerifyCheckpoint 区块hash与配置的检查点不一致时返回错误，高度没有检查点时不检查
+func (wm *WalletManager) VerifyCheckpoint(height uint64, hash string) error {
+	checkpoint, ok := wm.Config.Checkpoints[height]
+	if !ok || checkpoint == hash {
+		return nil
+	}
+	return fmt.Errorf("block [%d] hash %s is not match checkpoint %s", height, hash, checkpoint)
+}
+
+//VerifyCheckpointsWithNode 检查节点在各检查点高度的区块hash，不超过height的检查点才检查
+func (wm *WalletManager) VerifyCheckpointsWithNode(height uint64) error {
+	for checkpointHeight := range wm.Config.Checkpoints {
+		if checkpointHeight > height {
+			continue
+		}
+		hash, err := wm.GetBlockHash(checkpointHeight)
+		if err != nil {
+			return err
+		}
+		if err = wm.VerifyCheckpoint(checkpointHeight, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package nulsio
+
+import (
+	"testing"
+)
+
+func testStateWalletManager() *WalletManager {
+	wm := &WalletManager{Config: &WalletConfig{Symbol: Symbol, Checkpoints: make(map[uint64]string)}}
+	wm.SetStorage(NewMemoryStorage())
+	return wm
+}
+
+func TestScannerState_ExportImport(t *testing.T) {
+
+	src := testStateWalletManager()
+	storage, _ := src.GetStorage()
+	storage.SaveLocalBlockWithCursor(&NusBlock{Height: 1, Hash: "h1"})
+	storage.SaveLocalBlockWithCursor(&NusBlock{Height: 2, Hash: "h2", PreHash: "h1", TxList: []*Tx{{Hash: "tx"}}})
+	storage.SaveLocalBlockWithCursor(&NusBlock{Height: 3, Hash: "h3", PreHash: "h2"})
+	storage.SaveUnscanRecord(NewUnscanRecord(2, "tx", "timeout"))
+	storage.SaveNotifyRecord(NewNotifyRecord(2, "observer", "tx", "key", ""))
+	storage.SaveUnspentLocks([]*UnspentLock{{Key: "a:0", LockID: "lock", Address: "addr"}}, nil)
+
+	state, err := src.ExportScannerState(2)
+	if err != nil {
+		t.Errorf("ExportScannerState failed, err: %v", err)
+		return
+	}
+	if state.BlockHeight != 3 || len(state.Headers) != 2 || len(state.Headers[0].TxList) != 0 {
+		t.Errorf("ExportScannerState result is wrong: %+v", state)
+	}
+
+	dst := testStateWalletManager()
+	dst.Config.Checkpoints[2] = "h2"
+	if err = dst.ImportScannerState(state); err != nil {
+		t.Errorf("ImportScannerState failed, err: %v", err)
+		return
+	}
+
+	height, hash := dst.GetLocalNewBlock()
+	if height != 3 || hash != "h3" {
+		t.Errorf("imported cursor = %d %s, want 3 h3", height, hash)
+	}
+	if records, _ := dst.GetUnscanRecords(); len(records) != 1 {
+		t.Errorf("imported unscan records = %d, want 1", len(records))
+	}
+	//重扫已导入的未扫记录时不重复通知
+	dstStorage, _ := dst.GetStorage()
+	if _, err := dstStorage.GetNotifyRecord(NotifyKey("observer", "tx", "key", "")); err != nil {
+		t.Errorf("notify record should be imported, err: %v", err)
+	}
+}
+
+func TestScannerState_Checkpoint(t *testing.T) {
+
+	wm := testStateWalletManager()
+	wm.Config.Checkpoints[2] = "other"
+
+	state := &ScannerState{
+		Version:     ScannerStateVersion,
+		Symbol:      Symbol,
+		BlockHeight: 3,
+		BlockHash:   "h3",
+		Headers: []*NusBlock{
+			{Height: 2, Hash: "h2", PreHash: "h1"},
+			{Height: 3, Hash: "h3", PreHash: "h2"},
+		},
+	}
+
+	if err := wm.ImportScannerState(state); err == nil {
+		t.Errorf("ImportScannerState should fail with mismatched checkpoint")
+	}
+
+	wm.Config.Checkpoints[2] = "h2"
+	state.Headers[1].PreHash = "fork"
+	if err := wm.ImportScannerState(state); err == nil {
+		t.Errorf("ImportScannerState should fail with unlinked headers")
+	}
+
+	//区块头不连续
+	state.Headers = []*NusBlock{
+		{Height: 1, Hash: "h1"},
+		{Height: 3, Hash: "h3", PreHash: "h2"},
+	}
+	if err := wm.ImportScannerState(state); err == nil {
+		t.Errorf("ImportScannerState should fail with header gap")
+	}
+}
+
+func TestScannerState_ImportKeepLocalBlocks(t *testing.T) {
+
+	wm := testStateWalletManager()
+	storage, _ := wm.GetStorage()
+	storage.SaveLocalBlockWithCursor(&NusBlock{Height: 2, Hash: "h2", PreHash: "h1", TxList: []*Tx{{Hash: "tx"}}})
+
+	state := &ScannerState{
+		Version:     ScannerStateVersion,
+		Symbol:      Symbol,
+		BlockHeight: 3,
+		BlockHash:   "h3",
+		Headers: []*NusBlock{
+			{Height: 2, Hash: "h2", PreHash: "h1"},
+			{Height: 3, Hash: "h3", PreHash: "h2"},
+		},
+	}
+	if err := wm.ImportScannerState(state); err != nil {
+		t.Fatalf("ImportScannerState failed, err: %v", err)
+	}
+
+	//本地完整区块不被区块头覆盖
+	if block, err := storage.GetLocalBlock(2); err != nil || len(block.TxList) != 1 {
+		t.Errorf("local block 2 should keep transactions, err: %v", err)
+	}
+	if block, err := storage.GetLocalBlock(3); err != nil || block.Hash != "h3" {
+		t.Errorf("block 3 should be imported, err: %v", err)
+	}
+}
+
+func TestParseCheckpoints(t *testing.T) {
+	checkpoints, err := parseCheckpoints("100:aa, 200:bb")
+	if err != nil || len(checkpoints) != 2 || checkpoints[200] != "bb" {
+		t.Errorf("parseCheckpoints failed, result: %v, err: %v", checkpoints, err)
+	}
+
+	if _, err = parseCheckpoints("100"); err == nil {
+		t.Errorf("parseCheckpoints should fail without hash")
+	}
+}
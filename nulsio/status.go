@@ -0,0 +1,270 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	//statusEndpointCacheTTL 节点接口检查结果的缓存时间，避免频繁的健康检查请求节点
+	statusEndpointCacheTTL = 5 * time.Second
+)
+
+//ScannedBlock 成功扫描的区块
+type ScannedBlock struct {
+	Height    uint64 `json:"height"`
+	Hash      string `json:"hash"`
+	BlockTime int64  `json:"blockTime"` //区块时间，毫秒
+	ScanAt    int64  `json:"scanAt"`    //扫描完成时间，秒
+}
+
+//EndpointStatus 节点接口的可用状态
+type EndpointStatus struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	Latency   int64  `json:"latency"` //请求耗时，毫秒
+	Error     string `json:"error,omitempty"`
+	CheckAt   int64  `json:"checkAt"` //检查时间，秒，缓存时间内复用检查结果
+}
+
+//endpointCache 节点接口检查结果缓存
+type endpointCache struct {
+	mu         sync.Mutex
+	checkAt    time.Time
+	nodeHeight uint64
+	endpoints  []*EndpointStatus
+}
+
+//StatusConfig 状态中输出的配置摘要，不包含敏感配置
+type StatusConfig struct {
+	ChainId                string `json:"chainId"`
+	DataDir                string `json:"dataDir"`
+	TokenBalanceSource     string `json:"tokenBalanceSource"`
+	RescanLastBlockCount   uint64 `json:"rescanLastBlockCount"`
+	BlockRetainCount       uint64 `json:"blockRetainCount"`
+	BlockHeaderRetainCount uint64 `json:"blockHeaderRetainCount"`
+	MaxDBSize              int64  `json:"maxDBSize"`
+	UnscanMaxAttempts      int    `json:"unscanMaxAttempts"`
+	StatusMaxScanLag       uint64 `json:"statusMaxScanLag"`
+	EnableMetrics          bool   `json:"enableMetrics"`
+	LogFormat              string `json:"logFormat"`
+}
+
+//AdapterStatus 适配器的健康状态
+type AdapterStatus struct {
+	Symbol         string            `json:"symbol"`
+	Healthy        bool              `json:"healthy"`
+	Problems       []string          `json:"problems,omitempty"` //不健康的原因
+	Endpoints      []*EndpointStatus `json:"endpoints"`
+	NodeHeight     uint64            `json:"nodeHeight"`
+	ScannedHeight  uint64            `json:"scannedHeight"`
+	ScanLag        uint64            `json:"scanLag"`
+	ScannerRunning bool              `json:"scannerRunning"`
+	StorageOpen    bool              `json:"storageOpen"`
+	LastBlock      *ScannedBlock     `json:"lastBlock,omitempty"`
+	PendingUnscan  int               `json:"pendingUnscan"`
+	DeadUnscan     int               `json:"deadUnscan"`
+	DBSize         int64             `json:"dbSize"`
+	Config         StatusConfig      `json:"config"`
+	CheckAt        int64             `json:"checkAt"`
+}
+
+//Status 检查节点接口、扫描进度、未扫记录和本地数据库，汇总适配器的健康状态，节点接口的检查结果缓存statusEndpointCacheTTL
+func (wm *WalletManager) Status() *AdapterStatus {
+
+	status := &AdapterStatus{
+		Symbol:  wm.Symbol(),
+		Config:  wm.statusConfig(),
+		CheckAt: time.Now().Unix(),
+	}
+
+	//节点接口，同时获取节点高度
+	status.Endpoints, status.NodeHeight = wm.checkEndpoints(time.Now())
+	for _, e := range status.Endpoints {
+		if !e.Reachable {
+			status.problem("endpoint %s is unreachable: %s", e.Name, e.Error)
+		}
+	}
+
+	//扫描器
+	if wm.Blockscanner != nil {
+		status.ScannerRunning = wm.Blockscanner.BlockScannerBase != nil && wm.Blockscanner.Scanning && !wm.Blockscanner.IsClose()
+		status.LastBlock = wm.Blockscanner.getLastBlock()
+	}
+
+	//本地数据库，健康检查不打开数据库
+	wm.storageMu.Lock()
+	storage := wm.storage
+	wm.storageMu.Unlock()
+	if storage == nil {
+		//扫描器未运行时数据库尚未打开是正常的，只有扫描器运行时才是问题
+		if status.ScannerRunning {
+			status.problem("storage not open")
+		}
+	} else {
+		status.StorageOpen = true
+		var err error
+		if status.ScannedHeight, _, err = storage.GetLocalNewBlock(); err != nil {
+			status.problem("get scanned height failed: %v", err)
+		}
+		if list, err := storage.GetUnscanRecords(); err != nil {
+			status.problem("get unscan records failed: %v", err)
+		} else {
+			status.PendingUnscan, status.DeadUnscan = countUnscanRecords(list)
+		}
+		if status.DBSize, err = storage.Size(); err != nil {
+			status.problem("get local storage size failed: %v", err)
+		}
+	}
+
+	if status.Endpoints[0].Reachable && status.NodeHeight > status.ScannedHeight {
+		status.ScanLag = status.NodeHeight - status.ScannedHeight
+	}
+
+	//扫描器运行时才检查进度
+	if status.ScannerRunning && wm.Config.StatusMaxScanLag > 0 && status.ScanLag > wm.Config.StatusMaxScanLag {
+		status.problem("scanner is %d blocks behind the node, max: %d", status.ScanLag, wm.Config.StatusMaxScanLag)
+	}
+
+	if wm.Config.MaxDBSize > 0 && status.DBSize > wm.Config.MaxDBSize {
+		status.problem("local storage size %d exceeds limit %d", status.DBSize, wm.Config.MaxDBSize)
+	}
+
+	status.Healthy = len(status.Problems) == 0
+
+	return status
+}
+
+//checkEndpoints 检查节点接口并获取节点高度，缓存时间内返回上次的检查结果
+func (wm *WalletManager) checkEndpoints(now time.Time) ([]*EndpointStatus, uint64) {
+
+	wm.endpoints.mu.Lock()
+	defer wm.endpoints.mu.Unlock()
+
+	if wm.endpoints.endpoints == nil || now.Sub(wm.endpoints.checkAt) >= statusEndpointCacheTTL {
+		wm.endpoints.endpoints, wm.endpoints.nodeHeight = wm.requestEndpoints(now)
+		wm.endpoints.checkAt = now
+	}
+
+	//返回副本，调用者修改不影响缓存
+	endpoints := make([]*EndpointStatus, 0, len(wm.endpoints.endpoints))
+	for _, e := range wm.endpoints.endpoints {
+		endpoint := *e
+		endpoints = append(endpoints, &endpoint)
+	}
+	return endpoints, wm.endpoints.nodeHeight
+}
+
+//requestEndpoints 请求节点接口，返回接口状态和节点高度
+func (wm *WalletManager) requestEndpoints(now time.Time) ([]*EndpointStatus, uint64) {
+
+	var nodeHeight uint64
+	endpoint := &EndpointStatus{Name: "serverAPI", CheckAt: now.Unix()}
+	rpcEndpoint := &EndpointStatus{Name: "rpcAPI", CheckAt: now.Unix()}
+	if wm.Api != nil {
+		endpoint.URL = wm.Api.BaseURL
+		start := time.Now()
+		height, err := wm.Api.GetNewHeight()
+		endpoint.Latency = int64(time.Since(start) / time.Millisecond)
+		if err != nil {
+			endpoint.Error = RedactSensitive(err.Error())
+		} else {
+			endpoint.Reachable = true
+			nodeHeight = uint64(height)
+		}
+
+		//utxo和账户查询使用的JSON-RPC接口
+		rpcEndpoint.URL = wm.Api.rpcURL()
+		start = time.Now()
+		err = wm.Api.PingRPC(wm.Config.AliasBurnAddress)
+		rpcEndpoint.Latency = int64(time.Since(start) / time.Millisecond)
+		if err != nil {
+			rpcEndpoint.Error = RedactSensitive(err.Error())
+		} else {
+			rpcEndpoint.Reachable = true
+		}
+	} else {
+		endpoint.Error = "client is not set"
+		rpcEndpoint.Error = "client is not set"
+	}
+	return []*EndpointStatus{endpoint, rpcEndpoint}, nodeHeight
+}
+
+//StatusHandler 提供健康检查的HTTP接口，健康返回200，否则返回503，内容为json格式的状态
+func (wm *WalletManager) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		status := wm.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+//problem 记录不健康的原因
+func (status *AdapterStatus) problem(format string, args ...interface{}) {
+	status.Problems = append(status.Problems, fmt.Sprintf(format, args...))
+}
+
+//statusConfig 配置摘要
+func (wm *WalletManager) statusConfig() StatusConfig {
+	c := StatusConfig{
+		ChainId:                wm.Config.ChainId,
+		DataDir:                wm.Config.DataDir,
+		TokenBalanceSource:     wm.Config.TokenBalanceSource,
+		BlockRetainCount:       wm.Config.BlockRetainCount,
+		BlockHeaderRetainCount: wm.Config.BlockHeaderRetainCount,
+		MaxDBSize:              wm.Config.MaxDBSize,
+		UnscanMaxAttempts:      wm.Config.UnscanMaxAttempts,
+		StatusMaxScanLag:       wm.Config.StatusMaxScanLag,
+		EnableMetrics:          wm.Config.EnableMetrics,
+		LogFormat:              wm.Config.LogFormat,
+	}
+	if wm.Blockscanner != nil {
+		c.RescanLastBlockCount = wm.Blockscanner.RescanLastBlockCount
+	}
+	return c
+}
+
+//setLastBlock 记录最近一次成功扫描的区块
+func (bs *NULSBlockScanner) setLastBlock(block *NusBlock) {
+	bs.lastBlockMu.Lock()
+	defer bs.lastBlockMu.Unlock()
+	bs.lastBlock = &ScannedBlock{
+		Height:    uint64(block.Height),
+		Hash:      block.Hash,
+		BlockTime: block.Time,
+		ScanAt:    time.Now().Unix(),
+	}
+}
+
+//getLastBlock 获取最近一次成功扫描的区块，未扫描过返回nil
+func (bs *NULSBlockScanner) getLastBlock() *ScannedBlock {
+	bs.lastBlockMu.RLock()
+	defer bs.lastBlockMu.RUnlock()
+	if bs.lastBlock == nil {
+		return nil
+	}
+	last := *bs.lastBlock
+	return &last
+}
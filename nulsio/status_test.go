@@ -0,0 +1,129 @@
+package nulsio
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/log"
+)
+
+func TestWalletManager_Status(t *testing.T) {
+
+	nodeHeight := 120
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		//JSON-RPC接口
+		if r.URL.Path == "/rpc" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": map[string]interface{}{"balance": 0}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{"value": nodeHeight}})
+	}))
+	defer server.Close()
+
+	wm := testStateWalletManager()
+	wm.Log = log.NewOWLogger(Symbol)
+	wm.Config.StatusMaxScanLag = 10
+	wm.Api = &Client{BaseURL: server.URL, RPCURL: server.URL + "/rpc"}
+	wm.Blockscanner = NewNULSBlockScanner(wm)
+	wm.Blockscanner.Scanning = true
+
+	storage, _ := wm.GetStorage()
+	block := &NusBlock{Height: 115, Hash: "h115", Time: 1571400000000}
+	storage.SaveLocalBlockWithCursor(block)
+	wm.Blockscanner.setLastBlock(block)
+	storage.SaveUnscanRecord(NewUnscanRecord(100, "", "timeout"))
+	dead := NewUnscanRecord(101, "tx", "timeout")
+	dead.Dead = true
+	storage.SaveUnscanRecord(dead)
+
+	status := wm.Status()
+	if !status.Healthy || len(status.Problems) > 0 {
+		t.Errorf("status should be healthy, problems: %v", status.Problems)
+	}
+	if len(status.Endpoints) != 2 || !status.Endpoints[0].Reachable || status.Endpoints[0].URL != server.URL {
+		t.Errorf("endpoints = %+v", status.Endpoints[0])
+	}
+	if rpc := status.Endpoints[1]; rpc.Name != "rpcAPI" || !rpc.Reachable || rpc.URL != server.URL+"/rpc" {
+		t.Errorf("rpc endpoint = %+v", rpc)
+	}
+	if status.NodeHeight != 120 || status.ScannedHeight != 115 || status.ScanLag != 5 || !status.ScannerRunning {
+		t.Errorf("status = %+v", status)
+	}
+	if status.LastBlock == nil || status.LastBlock.Hash != "h115" || status.LastBlock.BlockTime != block.Time {
+		t.Errorf("last block = %+v", status.LastBlock)
+	}
+	if status.PendingUnscan != 1 || status.DeadUnscan != 1 {
+		t.Errorf("unscan records = %d pending, %d dead, want 1, 1", status.PendingUnscan, status.DeadUnscan)
+	}
+
+	//缓存时间内不再请求节点
+	nodeHeight = 200
+	if status = wm.Status(); requests != 2 || status.NodeHeight != 120 {
+		t.Errorf("cached status requests = %d, node height = %d, want 2, 120", requests, status.NodeHeight)
+	}
+
+	//缓存过期后，落后节点过多
+	wm.endpoints.checkAt = time.Now().Add(-statusEndpointCacheTTL)
+	rec := httptest.NewRecorder()
+	wm.StatusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	var got AdapterStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode status failed, err: %v", err)
+	}
+	if got.Healthy || got.ScanLag != 85 || len(got.Problems) != 1 {
+		t.Errorf("status = %+v", got)
+	}
+
+	//节点不可用
+	server.Close()
+	wm.endpoints.checkAt = time.Now().Add(-statusEndpointCacheTTL)
+	status = wm.Status()
+	if status.Healthy || status.Endpoints[0].Reachable || len(status.Endpoints[0].Error) == 0 || status.Endpoints[1].Reachable {
+		t.Errorf("status should be unhealthy when endpoint is unreachable: %+v", status.Endpoints)
+	}
+}
+
+func TestWalletManager_StatusStorageNotOpen(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{"value": 1}, "result": map[string]interface{}{}})
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "nulsio-status")
+	if err != nil {
+		t.Fatalf("TempDir failed, err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := &WalletManager{Config: NewConfig(Symbol)}
+	wm.Config.dbPath = dir
+	wm.Api = &Client{BaseURL: server.URL, RPCURL: server.URL}
+
+	//健康检查不打开数据库，扫描器未运行时数据库未打开不影响健康
+	status := wm.Status()
+	if !status.Healthy || status.StorageOpen || len(status.Problems) != 0 {
+		t.Errorf("status = %+v, want healthy with storage not open", status)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("status should not create database file, files: %d", len(files))
+	}
+
+	//扫描器运行时数据库未打开
+	wm.Blockscanner = NewNULSBlockScanner(wm)
+	wm.Blockscanner.Scanning = true
+	status = wm.Status()
+	if status.Healthy || len(status.Problems) != 1 || status.Problems[0] != "storage not open" {
+		t.Errorf("problems = %v, want [storage not open]", status.Problems)
+	}
+}
@@ -0,0 +1,845 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	//pruneBatchSize 单次清理区块的最大高度数量
+	pruneBatchSize = 10000
+
+	//storageOpenTimeout 打开数据库等待文件锁的超时时间，数据库被其它进程占用时返回错误而不是一直阻塞
+	storageOpenTimeout = time.Second
+)
+
+//BlockchainStorage 区块扫描及交易单创建使用的本地数据存储，实现必须支持并发调用
+type BlockchainStorage interface {
+
+	//GetLocalNewBlock 获取本地记录的区块高度和hash
+	GetLocalNewBlock() (uint64, string, error)
+	//SaveLocalNewBlock 记录区块高度和hash
+	SaveLocalNewBlock(height uint64, hash string) error
+	//SaveLocalBlock 记录区块
+	SaveLocalBlock(block *NusBlock) error
+	//SaveLocalBlockWithCursor 在同一事务中记录区块及区块高度和hash
+	SaveLocalBlockWithCursor(block *NusBlock) error
+	//GetLocalBlock 获取指定高度的区块
+	GetLocalBlock(height uint64) (*NusBlock, error)
+	//GetLocalBlocks 获取高度范围[from, to]内本地保存的区块
+	GetLocalBlocks(from, to uint64) ([]*NusBlock, error)
+	//PruneLocalBlocks 清除高度小于fullBefore的区块交易，删除高度小于headerBefore的区块
+	PruneLocalBlocks(fullBefore, headerBefore uint64) error
+
+	//SaveUnscanRecord 保存未扫记录
+	SaveUnscanRecord(record *UnscanRecord) error
+	//GetUnscanRecord 获取指定的未扫记录
+	GetUnscanRecord(id string) (*UnscanRecord, error)
+	//GetUnscanRecords 获取所有未扫记录
+	GetUnscanRecords() ([]*UnscanRecord, error)
+	//DeleteUnscanRecordByID 删除指定的未扫记录
+	DeleteUnscanRecordByID(id string) error
+	//DeleteUnscanRecord 删除指定高度的未扫记录
+	DeleteUnscanRecord(height uint64) error
+
+	//SaveNotifyRecord 保存已通知记录
+	SaveNotifyRecord(record *NotifyRecord) error
+	//GetNotifyRecord 获取已通知记录
+	GetNotifyRecord(key string) (*NotifyRecord, error)
+	//DeleteNotifyRecords 删除指定高度的已通知记录
+	DeleteNotifyRecords(height uint64) error
+	//DeleteNotifyRecordsBefore 删除高度小于height的已通知记录
+	DeleteNotifyRecordsBefore(height uint64) error
+	//GetNotifyRecords 获取所有已通知记录
+	GetNotifyRecords() ([]*NotifyRecord, error)
+
+	//SaveFeesSupportRecord 保存手续费充值记录
+	SaveFeesSupportRecord(record *FeesSupportRecord) error
+	//GetFeesSupportRecord 获取地址的手续费充值记录
+	GetFeesSupportRecord(address string) (*FeesSupportRecord, error)
+	//DeleteFeesSupportRecord 删除地址的手续费充值记录
+	DeleteFeesSupportRecord(address string) error
+	//GetFeesSupportRecords 获取所有手续费充值记录
+	GetFeesSupportRecords() ([]*FeesSupportRecord, error)
+
+	//GetUnspentLocks 获取地址锁定的utxo
+	GetUnspentLocks(address string) ([]*UnspentLock, error)
+	//GetPendingChanges 获取地址未确认的找零
+	GetPendingChanges(address string) ([]*PendingChange, error)
+	//GetAllUnspentLocks 获取所有锁定的utxo
+	GetAllUnspentLocks() ([]*UnspentLock, error)
+	//GetAllPendingChanges 获取所有未确认的找零
+	GetAllPendingChanges() ([]*PendingChange, error)
+	//SaveUnspentLocks 在同一事务中保存锁定的utxo和找零
+	SaveUnspentLocks(locks []*UnspentLock, changes []*PendingChange) error
+	//DeleteUnspentLock 删除锁定的utxo
+	DeleteUnspentLock(key string) error
+	//DeletePendingChange 删除未确认的找零
+	DeletePendingChange(key string) error
+	//DeleteUnspentLocksByID 删除交易单锁定的utxo和找零
+	DeleteUnspentLocksByID(lockID string) error
+	//ConfirmUnspentLocks 交易单广播成功，已使用的utxo继续锁定，找零转为以txid记录
+	ConfirmUnspentLocks(lockID, txid string, now int64) error
+
+	//ImportScannerState 在同一事务中导入扫描器状态，跳过本地已有的区块
+	ImportScannerState(state *ScannerState) error
+
+	//Compact 压缩存储，回收已删除数据占用的空间
+	Compact() error
+	//Size 存储占用的字节数
+	Size() (int64, error)
+	//Close 关闭存储
+	Close() error
+}
+
+//StormStorage 基于storm数据库的存储，数据库只打开一次
+type StormStorage struct {
+	mu   sync.RWMutex //压缩数据库时需要重新打开，期间阻塞其它操作
+	db   *storm.DB
+	file string
+}
+
+//NewStormStorage 打开storm数据库文件
+func NewStormStorage(file string) (*StormStorage, error) {
+	db, err := storm.Open(file, storm.BoltOptions(0600, &bolt.Options{Timeout: storageOpenTimeout}))
+	if err != nil {
+		return nil, err
+	}
+	return &StormStorage{db: db, file: file}, nil
+}
+
+//GetLocalNewBlock 获取本地记录的区块高度和hash
+func (s *StormStorage) GetLocalNewBlock() (uint64, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		blockHeight uint64 = 0
+		blockHash   string = ""
+	)
+	s.db.Get(blockchainBucket, "blockHeight", &blockHeight)
+	s.db.Get(blockchainBucket, "blockHash", &blockHash)
+	return blockHeight, blockHash, nil
+}
+
+//SaveLocalNewBlock 记录区块高度和hash
+func (s *StormStorage) SaveLocalNewBlock(height uint64, hash string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = saveBlockCursor(tx, height, hash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//SaveLocalBlock 记录区块
+func (s *StormStorage) SaveLocalBlock(block *NusBlock) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.Save(block)
+}
+
+//SaveLocalBlockWithCursor 在同一事务中记录区块及区块高度和hash
+func (s *StormStorage) SaveLocalBlockWithCursor(block *NusBlock) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = saveBlockCursor(tx, uint64(block.Height), block.Hash); err != nil {
+		return err
+	}
+	if err = tx.Save(block); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//GetLocalBlock 获取指定高度的区块
+func (s *StormStorage) GetLocalBlock(height uint64) (*NusBlock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var block NusBlock
+	err := s.db.One("Height", height, &block)
+	if err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+//GetLocalBlocks 获取高度范围[from, to]内本地保存的区块
+func (s *StormStorage) GetLocalBlocks(from, to uint64) ([]*NusBlock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	blocks := make([]*NusBlock, 0)
+	if from == 0 {
+		from = 1
+	}
+	for h := from; h <= to; h++ {
+		var block NusBlock
+		err := s.db.One("Height", h, &block)
+		if err == storm.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, &block)
+	}
+	return blocks, nil
+}
+
+//PruneLocalBlocks 清除高度小于fullBefore的区块交易，删除高度小于headerBefore的区块
+//已清理的高度记录在本地，每次只处理新增的范围，单次最多处理pruneBatchSize个高度
+func (s *StormStorage) PruneLocalBlocks(fullBefore, headerBefore uint64) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		prunedFull   uint64 = 1
+		prunedHeader uint64 = 1
+	)
+
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tx.Get(blockchainBucket, "prunedFullHeight", &prunedFull)
+	tx.Get(blockchainBucket, "prunedHeaderHeight", &prunedHeader)
+
+	headerBefore = minUint64(headerBefore, prunedHeader+pruneBatchSize)
+	for h := prunedHeader; h < headerBefore; h++ {
+		err = tx.DeleteStruct(&NusBlock{Height: int64(h)})
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+	}
+	if headerBefore > prunedHeader {
+		prunedHeader = headerBefore
+	}
+
+	//已删除的区块不需要再清除交易
+	if prunedFull < prunedHeader {
+		prunedFull = prunedHeader
+	}
+	fullBefore = minUint64(fullBefore, prunedFull+pruneBatchSize)
+	for h := prunedFull; h < fullBefore; h++ {
+		var block NusBlock
+		if tx.One("Height", h, &block) != nil || len(block.TxList) == 0 {
+			continue
+		}
+		block.TxList = nil
+		if err = tx.Save(&block); err != nil {
+			return err
+		}
+	}
+	if fullBefore > prunedFull {
+		prunedFull = fullBefore
+	}
+
+	if err = tx.Set(blockchainBucket, "prunedFullHeight", &prunedFull); err != nil {
+		return err
+	}
+	if err = tx.Set(blockchainBucket, "prunedHeaderHeight", &prunedHeader); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//SaveUnscanRecord 保存未扫记录
+func (s *StormStorage) SaveUnscanRecord(record *UnscanRecord) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.Save(record)
+}
+
+//GetUnscanRecord 获取指定的未扫记录
+func (s *StormStorage) GetUnscanRecord(id string) (*UnscanRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var record UnscanRecord
+	err := s.db.One("ID", id, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+//GetUnscanRecords 获取所有未扫记录
+func (s *StormStorage) GetUnscanRecords() ([]*UnscanRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var list []*UnscanRecord
+	err := s.db.All(&list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+//DeleteUnscanRecord 删除指定高度的未扫记录
+func (s *StormStorage) DeleteUnscanRecord(height uint64) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	err := s.db.Select(q.Eq("BlockHeight", height)).Delete(&UnscanRecord{})
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+//DeleteUnscanRecordByID 删除指定的未扫记录
+func (s *StormStorage) DeleteUnscanRecordByID(id string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.DeleteStruct(&UnscanRecord{ID: id})
+}
+
+//SaveNotifyRecord 保存已通知记录
+func (s *StormStorage) SaveNotifyRecord(record *NotifyRecord) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.Save(record)
+}
+
+//GetNotifyRecord 获取已通知记录
+func (s *StormStorage) GetNotifyRecord(key string) (*NotifyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var record NotifyRecord
+	err := s.db.One("Key", key, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+//DeleteNotifyRecords 删除指定高度的已通知记录
+func (s *StormStorage) DeleteNotifyRecords(height uint64) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	err := s.db.Select(q.Eq("BlockHeight", height)).Delete(&NotifyRecord{})
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+//DeleteNotifyRecordsBefore 删除高度小于height的已通知记录
+func (s *StormStorage) DeleteNotifyRecordsBefore(height uint64) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	err := s.db.Select(q.Lt("BlockHeight", height)).Delete(&NotifyRecord{})
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+//GetNotifyRecords 获取所有已通知记录
+func (s *StormStorage) GetNotifyRecords() ([]*NotifyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []*NotifyRecord
+	if err := s.db.All(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+//SaveFeesSupportRecord 保存手续费充值记录
+func (s *StormStorage) SaveFeesSupportRecord(record *FeesSupportRecord) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.Save(record)
+}
+
+//GetFeesSupportRecord 获取地址的手续费充值记录
+func (s *StormStorage) GetFeesSupportRecord(address string) (*FeesSupportRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var record FeesSupportRecord
+	err := s.db.One("Address", address, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+//DeleteFeesSupportRecord 删除地址的手续费充值记录
+func (s *StormStorage) DeleteFeesSupportRecord(address string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.DeleteStruct(&FeesSupportRecord{Address: address})
+}
+
+//GetFeesSupportRecords 获取所有手续费充值记录
+func (s *StormStorage) GetFeesSupportRecords() ([]*FeesSupportRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []*FeesSupportRecord
+	if err := s.db.All(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+//GetUnspentLocks 获取地址锁定的utxo
+func (s *StormStorage) GetUnspentLocks(address string) ([]*UnspentLock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var locks []*UnspentLock
+	err := s.db.Find("Address", address, &locks)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return locks, nil
+}
+
+//GetPendingChanges 获取地址未确认的找零
+func (s *StormStorage) GetPendingChanges(address string) ([]*PendingChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var changes []*PendingChange
+	err := s.db.Find("Address", address, &changes)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return changes, nil
+}
+
+//GetAllUnspentLocks 获取所有锁定的utxo
+func (s *StormStorage) GetAllUnspentLocks() ([]*UnspentLock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var locks []*UnspentLock
+	if err := s.db.All(&locks); err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
+//GetAllPendingChanges 获取所有未确认的找零
+func (s *StormStorage) GetAllPendingChanges() ([]*PendingChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var changes []*PendingChange
+	if err := s.db.All(&changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+//SaveUnspentLocks 在同一事务中保存锁定的utxo和找零
+func (s *StormStorage) SaveUnspentLocks(locks []*UnspentLock, changes []*PendingChange) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, l := range locks {
+		if err = tx.Save(l); err != nil {
+			return err
+		}
+	}
+	for _, c := range changes {
+		if err = tx.Save(c); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//DeleteUnspentLock 删除锁定的utxo
+func (s *StormStorage) DeleteUnspentLock(key string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.DeleteStruct(&UnspentLock{Key: key})
+}
+
+//DeletePendingChange 删除未确认的找零
+func (s *StormStorage) DeletePendingChange(key string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.DeleteStruct(&PendingChange{Key: key})
+}
+
+//DeleteUnspentLocksByID 删除交易单锁定的utxo和找零
+func (s *StormStorage) DeleteUnspentLocksByID(lockID string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = tx.Select(q.Eq("LockID", lockID)).Delete(&UnspentLock{}); err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	if err = tx.Select(q.Eq("LockID", lockID)).Delete(&PendingChange{}); err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	return tx.Commit()
+}
+
+//ConfirmUnspentLocks 交易单广播成功，已使用的utxo继续锁定，找零转为以txid记录
+func (s *StormStorage) ConfirmUnspentLocks(lockID, txid string, now int64) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		locks   []*UnspentLock
+		changes []*PendingChange
+	)
+
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//已使用的utxo继续锁定，直到节点不再返回或过期；已花费的未确认找零不再使用
+	tx.Find("LockID", lockID, &locks)
+	for _, l := range locks {
+		l.CreateAt = now
+		l.SpentTxID = txid
+		if err = tx.Update(l); err != nil {
+			return err
+		}
+		tx.DeleteStruct(&PendingChange{Key: l.Key})
+	}
+
+	tx.Find("LockID", lockID, &changes)
+	for _, c := range changes {
+		if err = tx.DeleteStruct(c); err != nil {
+			return err
+		}
+		confirmPendingChange(c, txid, now)
+		if err = tx.Save(c); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+//ImportScannerState 在同一事务中导入扫描器状态，跳过本地已有的区块，区块高度和hash最后写入
+func (s *StormStorage) ImportScannerState(state *ScannerState) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//本地已有的区块可能包含完整交易，不使用导入的区块头覆盖
+	for _, header := range state.Headers {
+		var local NusBlock
+		if err = tx.One("Height", header.Height, &local); err == nil {
+			continue
+		} else if err != storm.ErrNotFound {
+			return err
+		}
+		if err = tx.Save(header); err != nil {
+			return err
+		}
+	}
+	for _, record := range state.UnscanRecords {
+		if err = tx.Save(record); err != nil {
+			return err
+		}
+	}
+	for _, record := range state.NotifyRecords {
+		if err = tx.Save(record); err != nil {
+			return err
+		}
+	}
+	for _, l := range state.UnspentLocks {
+		if err = tx.Save(l); err != nil {
+			return err
+		}
+	}
+	for _, c := range state.PendingChanges {
+		if err = tx.Save(c); err != nil {
+			return err
+		}
+	}
+	for _, record := range state.FeesSupportRecords {
+		if err = tx.Save(record); err != nil {
+			return err
+		}
+	}
+	if err = saveBlockCursor(tx, state.BlockHeight, state.BlockHash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//Compact 复制数据到新文件并替换原文件，回收已删除数据占用的空间
+func (s *StormStorage) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	compactFile := s.file + ".compact"
+	os.Remove(compactFile)
+
+	dst, err := bolt.Open(compactFile, 0600, &bolt.Options{Timeout: storageOpenTimeout})
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Bolt.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				dstBucket, err := dstTx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(b, dstBucket)
+			})
+		})
+	})
+	dst.Close()
+	if err != nil {
+		os.Remove(compactFile)
+		return err
+	}
+
+	if err = s.db.Close(); err != nil {
+		os.Remove(compactFile)
+		return err
+	}
+
+	//替换失败时重新打开原文件
+	renameErr := os.Rename(compactFile, s.file)
+
+	db, err := storm.Open(s.file, storm.BoltOptions(0600, &bolt.Options{Timeout: storageOpenTimeout}))
+	if err != nil {
+		return err
+	}
+	s.db = db
+
+	return renameErr
+}
+
+//Size 数据库文件大小
+func (s *StormStorage) Size() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+//Close 关闭数据库
+func (s *StormStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Close()
+}
+
+//saveBlockCursor 记录区块高度和hash
+func saveBlockCursor(tx storm.Node, height uint64, hash string) error {
+	if err := tx.Set(blockchainBucket, "blockHeight", &height); err != nil {
+		return err
+	}
+	return tx.Set(blockchainBucket, "blockHash", &hash)
+}
+
+//confirmPendingChange 找零以txid重新记录
+func confirmPendingChange(c *PendingChange, txid string, now int64) {
+	c.TxHash = txid
+	c.Key = (&UtxoDto{TxHash: txid, TxIndex: c.TxIndex}).Key()
+	c.LockID = ""
+	c.CreateAt = now
+}
+
+//SetStorage 设置本地数据存储，需在扫描和创建交易单之前设置
+func (wm *WalletManager) SetStorage(storage BlockchainStorage) {
+	wm.storageMu.Lock()
+	defer wm.storageMu.Unlock()
+	wm.storage = storage
+}
+
+//GetStorage 获取本地数据存储，未设置时打开配置的区块链数据文件
+func (wm *WalletManager) GetStorage() (BlockchainStorage, error) {
+	wm.storageMu.Lock()
+	defer wm.storageMu.Unlock()
+
+	if wm.storage == nil {
+		storage, err := NewStormStorage(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+		if err != nil {
+			return nil, err
+		}
+		wm.storage = storage
+	}
+	return wm.storage, nil
+}
+
+//CloseStorage 关闭本地数据存储
+func (wm *WalletManager) CloseStorage() error {
+	wm.storageMu.Lock()
+	defer wm.storageMu.Unlock()
+
+	if wm.storage == nil {
+		return nil
+	}
+	err := wm.storage.Close()
+	wm.storage = nil
+	return err
+}
+
+//copyBucket 复制bucket的所有数据，包括嵌套的bucket
+func copyBucket(src, dst *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v == nil {
+			child, err := dst.CreateBucketIfNotExists(k)
+			if err != nil {
+				return err
+			}
+			return copyBucket(src.Bucket(k), child)
+		}
+		return dst.Put(k, v)
+	})
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+//PruneLocalBlocks 按保存策略清理本地区块，最新的BlockRetainCount个区块保留完整交易，更早的只保留区块头
+func (wm *WalletManager) PruneLocalBlocks(height uint64) error {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	var fullBefore, headerBefore uint64
+	if height > wm.Config.BlockRetainCount {
+		fullBefore = height - wm.Config.BlockRetainCount
+	}
+	if wm.Config.BlockHeaderRetainCount > 0 && height > wm.Config.BlockHeaderRetainCount {
+		headerBefore = height - wm.Config.BlockHeaderRetainCount
+	}
+
+	if err = storage.PruneLocalBlocks(fullBefore, headerBefore); err != nil {
+		return err
+	}
+
+	//已清除交易的区块不会再按区块重扫，但未扫记录的重扫仍需要已通知记录，保留最低未扫高度及以上的记录
+	records, err := storage.GetUnscanRecords()
+	if err != nil {
+		return err
+	}
+	notifyBefore := fullBefore
+	for _, r := range records {
+		notifyBefore = minUint64(notifyBefore, r.BlockHeight)
+	}
+
+	return storage.DeleteNotifyRecordsBefore(notifyBefore)
+}
+
+//CompactLocalStorage 压缩本地数据库，超过大小上限时删除只有区块头的区块后再压缩
+func (wm *WalletManager) CompactLocalStorage(height uint64) error {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	if err = storage.Compact(); err != nil {
+		return err
+	}
+
+	size, err := storage.Size()
+	if err != nil {
+		return err
+	}
+
+	if wm.Config.MaxDBSize <= 0 || size <= wm.Config.MaxDBSize || height <= wm.Config.BlockRetainCount {
+		return nil
+	}
+
+	wm.Logger(LogSubsystemScanner).Warn("local database size exceeds limit, drop block headers before full blocks", "size", size, "limit", wm.Config.MaxDBSize)
+
+	fullBefore := height - wm.Config.BlockRetainCount
+	for i := uint64(0); i <= fullBefore/pruneBatchSize; i++ {
+		if err = storage.PruneLocalBlocks(fullBefore, fullBefore); err != nil {
+			return err
+		}
+	}
+
+	return storage.Compact()
+}
@@ -0,0 +1,432 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"sync"
+
+	"github.com/asdine/storm"
+)
+
+//MemoryStorage 内存存储，用于测试，不做持久化
+type MemoryStorage struct {
+	mu            sync.RWMutex
+	blockHeight   uint64
+	blockHash     string
+	blocks        map[uint64]NusBlock
+	unscanRecords map[string]UnscanRecord
+	feesSupports  map[string]FeesSupportRecord
+	unspentLocks  map[string]UnspentLock
+	changes       map[string]PendingChange
+	notifyRecords map[string]NotifyRecord
+}
+
+//NewMemoryStorage 创建内存存储
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		blocks:        make(map[uint64]NusBlock),
+		unscanRecords: make(map[string]UnscanRecord),
+		feesSupports:  make(map[string]FeesSupportRecord),
+		unspentLocks:  make(map[string]UnspentLock),
+		changes:       make(map[string]PendingChange),
+		notifyRecords: make(map[string]NotifyRecord),
+	}
+}
+
+//GetLocalNewBlock 获取本地记录的区块高度和hash
+func (s *MemoryStorage) GetLocalNewBlock() (uint64, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.blockHeight, s.blockHash, nil
+}
+
+//SaveLocalNewBlock 记录区块高度和hash
+func (s *MemoryStorage) SaveLocalNewBlock(height uint64, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blockHeight = height
+	s.blockHash = hash
+	return nil
+}
+
+//SaveLocalBlock 记录区块
+func (s *MemoryStorage) SaveLocalBlock(block *NusBlock) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocks[uint64(block.Height)] = *block
+	return nil
+}
+
+//SaveLocalBlockWithCursor 在同一事务中记录区块及区块高度和hash
+func (s *MemoryStorage) SaveLocalBlockWithCursor(block *NusBlock) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocks[uint64(block.Height)] = *block
+	s.blockHeight = uint64(block.Height)
+	s.blockHash = block.Hash
+	return nil
+}
+
+//GetLocalBlock 获取指定高度的区块
+func (s *MemoryStorage) GetLocalBlock(height uint64) (*NusBlock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	block, ok := s.blocks[height]
+	if !ok {
+		return nil, storm.ErrNotFound
+	}
+	return &block, nil
+}
+
+//GetLocalBlocks 获取高度范围[from, to]内本地保存的区块
+func (s *MemoryStorage) GetLocalBlocks(from, to uint64) ([]*NusBlock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	blocks := make([]*NusBlock, 0)
+	for h := from; h <= to; h++ {
+		if block, ok := s.blocks[h]; ok {
+			blocks = append(blocks, &block)
+		}
+	}
+	return blocks, nil
+}
+
+//PruneLocalBlocks 清除高度小于fullBefore的区块交易，删除高度小于headerBefore的区块
+func (s *MemoryStorage) PruneLocalBlocks(fullBefore, headerBefore uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for height, block := range s.blocks {
+		if height < headerBefore {
+			delete(s.blocks, height)
+		} else if height < fullBefore && len(block.TxList) > 0 {
+			block.TxList = nil
+			s.blocks[height] = block
+		}
+	}
+	return nil
+}
+
+//SaveUnscanRecord 保存未扫记录
+func (s *MemoryStorage) SaveUnscanRecord(record *UnscanRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unscanRecords[record.ID] = *record
+	return nil
+}
+
+//GetUnscanRecord 获取指定的未扫记录
+func (s *MemoryStorage) GetUnscanRecord(id string) (*UnscanRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.unscanRecords[id]
+	if !ok {
+		return nil, storm.ErrNotFound
+	}
+	return &record, nil
+}
+
+//GetUnscanRecords 获取所有未扫记录
+func (s *MemoryStorage) GetUnscanRecords() ([]*UnscanRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*UnscanRecord, 0, len(s.unscanRecords))
+	for _, r := range s.unscanRecords {
+		record := r
+		list = append(list, &record)
+	}
+	return list, nil
+}
+
+//DeleteUnscanRecord 删除指定高度的未扫记录
+func (s *MemoryStorage) DeleteUnscanRecord(height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, r := range s.unscanRecords {
+		if r.BlockHeight == height {
+			delete(s.unscanRecords, id)
+		}
+	}
+	return nil
+}
+
+//DeleteUnscanRecordByID 删除指定的未扫记录
+func (s *MemoryStorage) DeleteUnscanRecordByID(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.unscanRecords[id]; !ok {
+		return storm.ErrNotFound
+	}
+	delete(s.unscanRecords, id)
+	return nil
+}
+
+//SaveNotifyRecord 保存已通知记录
+func (s *MemoryStorage) SaveNotifyRecord(record *NotifyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifyRecords[record.Key] = *record
+	return nil
+}
+
+//GetNotifyRecord 获取已通知记录
+func (s *MemoryStorage) GetNotifyRecord(key string) (*NotifyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.notifyRecords[key]
+	if !ok {
+		return nil, storm.ErrNotFound
+	}
+	return &record, nil
+}
+
+//DeleteNotifyRecords 删除指定高度的已通知记录
+func (s *MemoryStorage) DeleteNotifyRecords(height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, r := range s.notifyRecords {
+		if r.BlockHeight == height {
+			delete(s.notifyRecords, key)
+		}
+	}
+	return nil
+}
+
+//DeleteNotifyRecordsBefore 删除高度小于height的已通知记录
+func (s *MemoryStorage) DeleteNotifyRecordsBefore(height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, r := range s.notifyRecords {
+		if r.BlockHeight < height {
+			delete(s.notifyRecords, key)
+		}
+	}
+	return nil
+}
+
+//GetNotifyRecords 获取所有已通知记录
+func (s *MemoryStorage) GetNotifyRecords() ([]*NotifyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]*NotifyRecord, 0, len(s.notifyRecords))
+	for _, r := range s.notifyRecords {
+		record := r
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+//SaveFeesSupportRecord 保存手续费充值记录
+func (s *MemoryStorage) SaveFeesSupportRecord(record *FeesSupportRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feesSupports[record.Address] = *record
+	return nil
+}
+
+//GetFeesSupportRecord 获取地址的手续费充值记录
+func (s *MemoryStorage) GetFeesSupportRecord(address string) (*FeesSupportRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.feesSupports[address]
+	if !ok {
+		return nil, storm.ErrNotFound
+	}
+	return &record, nil
+}
+
+//DeleteFeesSupportRecord 删除地址的手续费充值记录
+func (s *MemoryStorage) DeleteFeesSupportRecord(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.feesSupports, address)
+	return nil
+}
+
+//GetFeesSupportRecords 获取所有手续费充值记录
+func (s *MemoryStorage) GetFeesSupportRecords() ([]*FeesSupportRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]*FeesSupportRecord, 0, len(s.feesSupports))
+	for _, r := range s.feesSupports {
+		record := r
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+//GetUnspentLocks 获取地址锁定的utxo
+func (s *MemoryStorage) GetUnspentLocks(address string) ([]*UnspentLock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	locks := make([]*UnspentLock, 0)
+	for _, l := range s.unspentLocks {
+		if l.Address == address {
+			lock := l
+			locks = append(locks, &lock)
+		}
+	}
+	return locks, nil
+}
+
+//GetPendingChanges 获取地址未确认的找零
+func (s *MemoryStorage) GetPendingChanges(address string) ([]*PendingChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	changes := make([]*PendingChange, 0)
+	for _, c := range s.changes {
+		if c.Address == address {
+			change := c
+			changes = append(changes, &change)
+		}
+	}
+	return changes, nil
+}
+
+//GetAllUnspentLocks 获取所有锁定的utxo
+func (s *MemoryStorage) GetAllUnspentLocks() ([]*UnspentLock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	locks := make([]*UnspentLock, 0, len(s.unspentLocks))
+	for _, l := range s.unspentLocks {
+		lock := l
+		locks = append(locks, &lock)
+	}
+	return locks, nil
+}
+
+//GetAllPendingChanges 获取所有未确认的找零
+func (s *MemoryStorage) GetAllPendingChanges() ([]*PendingChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	changes := make([]*PendingChange, 0, len(s.changes))
+	for _, c := range s.changes {
+		change := c
+		changes = append(changes, &change)
+	}
+	return changes, nil
+}
+
+//SaveUnspentLocks 在同一事务中保存锁定的utxo和找零
+func (s *MemoryStorage) SaveUnspentLocks(locks []*UnspentLock, changes []*PendingChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range locks {
+		s.unspentLocks[l.Key] = *l
+	}
+	for _, c := range changes {
+		s.changes[c.Key] = *c
+	}
+	return nil
+}
+
+//DeleteUnspentLock 删除锁定的utxo
+func (s *MemoryStorage) DeleteUnspentLock(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.unspentLocks, key)
+	return nil
+}
+
+//DeletePendingChange 删除未确认的找零
+func (s *MemoryStorage) DeletePendingChange(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.changes, key)
+	return nil
+}
+
+//DeleteUnspentLocksByID 删除交易单锁定的utxo和找零
+func (s *MemoryStorage) DeleteUnspentLocksByID(lockID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, l := range s.unspentLocks {
+		if l.LockID == lockID {
+			delete(s.unspentLocks, key)
+		}
+	}
+	for key, c := range s.changes {
+		if c.LockID == lockID {
+			delete(s.changes, key)
+		}
+	}
+	return nil
+}
+
+//ConfirmUnspentLocks 交易单广播成功，已使用的utxo继续锁定，找零转为以txid记录
+func (s *MemoryStorage) ConfirmUnspentLocks(lockID, txid string, now int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, l := range s.unspentLocks {
+		if l.LockID == lockID {
+			l.CreateAt = now
+			l.SpentTxID = txid
+			s.unspentLocks[key] = l
+			delete(s.changes, key)
+		}
+	}
+	for key, c := range s.changes {
+		if c.LockID == lockID {
+			delete(s.changes, key)
+			confirmPendingChange(&c, txid, now)
+			s.changes[c.Key] = c
+		}
+	}
+	return nil
+}
+
+//ImportScannerState 在同一事务中导入扫描器状态，跳过本地已有的区块
+func (s *MemoryStorage) ImportScannerState(state *ScannerState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, header := range state.Headers {
+		if _, ok := s.blocks[uint64(header.Height)]; !ok {
+			s.blocks[uint64(header.Height)] = *header
+		}
+	}
+	for _, r := range state.UnscanRecords {
+		s.unscanRecords[r.ID] = *r
+	}
+	for _, r := range state.NotifyRecords {
+		s.notifyRecords[r.Key] = *r
+	}
+	for _, l := range state.UnspentLocks {
+		s.unspentLocks[l.Key] = *l
+	}
+	for _, c := range state.PendingChanges {
+		s.changes[c.Key] = *c
+	}
+	for _, r := range state.FeesSupportRecords {
+		s.feesSupports[r.Address] = *r
+	}
+	s.blockHeight = state.BlockHeight
+	s.blockHash = state.BlockHash
+	return nil
+}
+
+//Compact 内存存储不需要压缩
+func (s *MemoryStorage) Compact() error {
+	return nil
+}
+
+//Size 内存存储不计算大小
+func (s *MemoryStorage) Size() (int64, error) {
+	return 0, nil
+}
+
+//Close 关闭存储
+func (s *MemoryStorage) Close() error {
+	return nil
+}
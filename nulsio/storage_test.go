@@ -0,0 +1,314 @@
+package nulsio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func testStorages(t *testing.T) (map[string]BlockchainStorage, func()) {
+	dir, err := ioutil.TempDir("", "nulsio-storage")
+	if err != nil {
+		t.Fatalf("TempDir failed, err: %v", err)
+	}
+
+	stormStorage, err := NewStormStorage(filepath.Join(dir, "blockchain.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("NewStormStorage failed, err: %v", err)
+	}
+
+	cleanup := func() {
+		stormStorage.Close()
+		os.RemoveAll(dir)
+	}
+
+	return map[string]BlockchainStorage{
+		"storm":  stormStorage,
+		"memory": NewMemoryStorage(),
+	}, cleanup
+}
+
+func TestBlockchainStorage_Block(t *testing.T) {
+	storages, cleanup := testStorages(t)
+	defer cleanup()
+	for name, storage := range storages {
+
+		height, hash, _ := storage.GetLocalNewBlock()
+		if height != 0 || hash != "" {
+			t.Errorf("%s: empty storage cursor = %d %s", name, height, hash)
+		}
+
+		block := &NusBlock{Height: 10, Hash: "hash10", PreHash: "hash9"}
+		if err := storage.SaveLocalBlockWithCursor(block); err != nil {
+			t.Errorf("%s: SaveLocalBlockWithCursor failed, err: %v", name, err)
+			continue
+		}
+
+		height, hash, _ = storage.GetLocalNewBlock()
+		if height != 10 || hash != "hash10" {
+			t.Errorf("%s: cursor = %d %s, want 10 hash10", name, height, hash)
+		}
+
+		local, err := storage.GetLocalBlock(10)
+		if err != nil || local.Hash != "hash10" {
+			t.Errorf("%s: GetLocalBlock failed, err: %v", name, err)
+		}
+
+		if _, err = storage.GetLocalBlock(11); err == nil {
+			t.Errorf("%s: GetLocalBlock should fail with unknown height", name)
+		}
+	}
+}
+
+func TestBlockchainStorage_UnscanRecord(t *testing.T) {
+	storages, cleanup := testStorages(t)
+	defer cleanup()
+	for name, storage := range storages {
+
+		storage.SaveUnscanRecord(NewUnscanRecord(1, "tx1", "[-5]No information available about transaction"))
+		storage.SaveUnscanRecord(NewUnscanRecord(1, "tx2", "timeout"))
+		storage.SaveUnscanRecord(NewUnscanRecord(2, "tx3", "timeout"))
+
+		if list, _ := storage.GetUnscanRecords(); len(list) != 3 {
+			t.Errorf("%s: unscan records = %d, want 3", name, len(list))
+		}
+
+		if err := storage.DeleteUnscanRecord(1); err != nil {
+			t.Errorf("%s: DeleteUnscanRecord failed, err: %v", name, err)
+		}
+		list, _ := storage.GetUnscanRecords()
+		if len(list) != 1 || list[0].TxID != "tx3" {
+			t.Errorf("%s: unscan records after delete = %+v", name, list)
+			continue
+		}
+
+		record, err := storage.GetUnscanRecord(list[0].ID)
+		if err != nil || record.TxID != "tx3" {
+			t.Errorf("%s: GetUnscanRecord = %+v, err: %v", name, record, err)
+		}
+		if err = storage.DeleteUnscanRecordByID(list[0].ID); err != nil {
+			t.Errorf("%s: DeleteUnscanRecordByID failed, err: %v", name, err)
+		}
+		if _, err = storage.GetUnscanRecord(list[0].ID); err == nil {
+			t.Errorf("%s: GetUnscanRecord should fail after delete", name)
+		}
+	}
+}
+
+func TestBlockchainStorage_UnspentLocks(t *testing.T) {
+	storages, cleanup := testStorages(t)
+	defer cleanup()
+	for name, storage := range storages {
+
+		locks := []*UnspentLock{{Key: "a:0", LockID: "lock", TxHash: "a", Address: "addr1"}}
+		changes := []*PendingChange{{Key: "lock:1", LockID: "lock", TxIndex: 1, Value: 100, Address: "addr1"}}
+		if err := storage.SaveUnspentLocks(locks, changes); err != nil {
+			t.Errorf("%s: SaveUnspentLocks failed, err: %v", name, err)
+			continue
+		}
+
+		if err := storage.ConfirmUnspentLocks("lock", "txid", 100); err != nil {
+			t.Errorf("%s: ConfirmUnspentLocks failed, err: %v", name, err)
+		}
+
+		pending, _ := storage.GetPendingChanges("addr1")
+		if len(pending) != 1 || pending[0].Key != "txid:1" || pending[0].LockID != "" {
+			t.Errorf("%s: pending changes after confirm = %+v", name, pending)
+		}
+		locked, _ := storage.GetUnspentLocks("addr1")
+		if len(locked) != 1 || locked[0].CreateAt != 100 || locked[0].SpentTxID != "txid" {
+			t.Errorf("%s: unspent locks after confirm = %+v", name, locked)
+		}
+
+		storage.DeleteUnspentLocksByID("lock")
+		if locked, _ = storage.GetUnspentLocks("addr1"); len(locked) != 0 {
+			t.Errorf("%s: unspent locks should be deleted", name)
+		}
+	}
+}
+
+func TestBlockchainStorage_NotifyRecord(t *testing.T) {
+	storages, cleanup := testStorages(t)
+	defer cleanup()
+	for name, storage := range storages {
+
+		storage.SaveNotifyRecord(NewNotifyRecord(1, "observer", "tx1", "key", ""))
+		storage.SaveNotifyRecord(NewNotifyRecord(2, "observer", "tx2", "key", ""))
+		storage.SaveNotifyRecord(NewNotifyRecord(2, "observer", "tx2", "key", "contract"))
+		storage.SaveNotifyRecord(NewNotifyRecord(3, "observer", "tx3", "key", ""))
+
+		if _, err := storage.GetNotifyRecord(NotifyKey("observer", "tx2", "key", "contract")); err != nil {
+			t.Errorf("%s: GetNotifyRecord failed, err: %v", name, err)
+		}
+		if err := storage.DeleteNotifyRecordsBefore(2); err != nil {
+			t.Errorf("%s: DeleteNotifyRecordsBefore failed, err: %v", name, err)
+		}
+		if err := storage.DeleteNotifyRecords(3); err != nil {
+			t.Errorf("%s: DeleteNotifyRecords failed, err: %v", name, err)
+		}
+		for txid, kept := range map[string]bool{"tx1": false, "tx2": true, "tx3": false} {
+			if _, err := storage.GetNotifyRecord(NotifyKey("observer", txid, "key", "")); (err == nil) != kept {
+				t.Errorf("%s: notify record of %s kept = %v, want %v", name, txid, err == nil, kept)
+			}
+		}
+	}
+}
+
+func TestBlockchainStorage_Concurrent(t *testing.T) {
+	storages, cleanup := testStorages(t)
+	defer cleanup()
+	for name, storage := range storages {
+
+		var wg sync.WaitGroup
+		for i := 1; i <= 20; i++ {
+			wg.Add(1)
+			go func(height uint64) {
+				defer wg.Done()
+				storage.SaveUnscanRecord(NewUnscanRecord(height, "", "timeout"))
+				storage.SaveLocalBlock(&NusBlock{Height: int64(height)})
+				storage.GetUnscanRecords()
+			}(uint64(i))
+		}
+		wg.Wait()
+
+		if list, _ := storage.GetUnscanRecords(); len(list) != 20 {
+			t.Errorf("%s: unscan records = %d, want 20", name, len(list))
+		}
+	}
+}
+
+func TestBlockchainStorage_PruneAndCompact(t *testing.T) {
+	storages, cleanup := testStorages(t)
+	defer cleanup()
+	for name, storage := range storages {
+
+		for h := int64(1); h <= 30; h++ {
+			storage.SaveLocalBlockWithCursor(&NusBlock{Height: h, Hash: "hash", TxList: []*Tx{{Hash: "tx"}}})
+		}
+
+		//保留20之后的完整区块，10之后的区块头
+		if err := storage.PruneLocalBlocks(20, 10); err != nil {
+			t.Errorf("%s: PruneLocalBlocks failed, err: %v", name, err)
+			continue
+		}
+
+		if _, err := storage.GetLocalBlock(9); err == nil {
+			t.Errorf("%s: block 9 should be deleted", name)
+		}
+		if block, err := storage.GetLocalBlock(10); err != nil || len(block.TxList) != 0 {
+			t.Errorf("%s: block 10 should keep header only, err: %v", name, err)
+		}
+		if block, err := storage.GetLocalBlock(20); err != nil || len(block.TxList) != 1 {
+			t.Errorf("%s: block 20 should keep transactions, err: %v", name, err)
+		}
+
+		if err := storage.Compact(); err != nil {
+			t.Errorf("%s: Compact failed, err: %v", name, err)
+			continue
+		}
+
+		height, _, _ := storage.GetLocalNewBlock()
+		if height != 30 {
+			t.Errorf("%s: cursor after compact = %d, want 30", name, height)
+		}
+		if block, err := storage.GetLocalBlock(25); err != nil || len(block.TxList) != 1 {
+			t.Errorf("%s: block 25 should be kept after compact, err: %v", name, err)
+		}
+	}
+}
+
+func TestNewStormStorage_Locked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nulsio-storage")
+	if err != nil {
+		t.Fatalf("TempDir failed, err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "blockchain.db")
+	storage, err := NewStormStorage(file)
+	if err != nil {
+		t.Fatalf("NewStormStorage failed, err: %v", err)
+	}
+	defer storage.Close()
+
+	//数据库已被打开，超时后返回错误
+	if locked, err := NewStormStorage(file); err == nil {
+		locked.Close()
+		t.Errorf("opening a locked database should time out")
+	}
+}
+
+func TestBlockchainStorage_ImportScannerState(t *testing.T) {
+	storages, cleanup := testStorages(t)
+	defer cleanup()
+	for name, storage := range storages {
+
+		storage.SaveLocalBlock(&NusBlock{Height: 2, Hash: "h2", TxList: []*Tx{{Hash: "tx"}}})
+
+		state := &ScannerState{
+			BlockHeight:        3,
+			BlockHash:          "h3",
+			Headers:            []*NusBlock{{Height: 2, Hash: "h2"}, {Height: 3, Hash: "h3", PreHash: "h2"}},
+			UnscanRecords:      []*UnscanRecord{NewUnscanRecord(2, "tx", "timeout")},
+			NotifyRecords:      []*NotifyRecord{NewNotifyRecord(2, "observer", "tx", "key", "")},
+			UnspentLocks:       []*UnspentLock{{Key: "a:0", LockID: "lock", Address: "addr"}},
+			PendingChanges:     []*PendingChange{{Key: "b:1", LockID: "lock", Address: "addr"}},
+			FeesSupportRecords: []*FeesSupportRecord{{Address: "addr"}},
+		}
+		if err := storage.ImportScannerState(state); err != nil {
+			t.Errorf("%s: ImportScannerState failed, err: %v", name, err)
+			continue
+		}
+
+		if height, hash, _ := storage.GetLocalNewBlock(); height != 3 || hash != "h3" {
+			t.Errorf("%s: imported cursor = %d %s, want 3 h3", name, height, hash)
+		}
+		if block, err := storage.GetLocalBlock(2); err != nil || len(block.TxList) != 1 {
+			t.Errorf("%s: local block 2 should keep transactions, err: %v", name, err)
+		}
+		if _, err := storage.GetLocalBlock(3); err != nil {
+			t.Errorf("%s: block 3 should be imported, err: %v", name, err)
+		}
+		if _, err := storage.GetNotifyRecord(NotifyKey("observer", "tx", "key", "")); err != nil {
+			t.Errorf("%s: notify record should be imported, err: %v", name, err)
+		}
+		records, _ := storage.GetUnscanRecords()
+		locks, _ := storage.GetAllUnspentLocks()
+		changes, _ := storage.GetAllPendingChanges()
+		fees, _ := storage.GetFeesSupportRecords()
+		if len(records) != 1 || len(locks) != 1 || len(changes) != 1 || len(fees) != 1 {
+			t.Errorf("%s: imported records = %d, locks = %d, changes = %d, fees = %d", name, len(records), len(locks), len(changes), len(fees))
+		}
+	}
+}
+
+func TestStormStorage_ImportScannerStateRollback(t *testing.T) {
+	storages, cleanup := testStorages(t)
+	defer cleanup()
+	storage := storages["storm"]
+
+	//已通知记录缺少主键，写入失败，整个导入回滚
+	state := &ScannerState{
+		BlockHeight:   3,
+		BlockHash:     "h3",
+		Headers:       []*NusBlock{{Height: 3, Hash: "h3"}},
+		UnscanRecords: []*UnscanRecord{NewUnscanRecord(3, "tx", "timeout")},
+		NotifyRecords: []*NotifyRecord{{BlockHeight: 3}},
+	}
+	if err := storage.ImportScannerState(state); err == nil {
+		t.Fatalf("ImportScannerState should fail with empty notify record key")
+	}
+
+	if height, _, _ := storage.GetLocalNewBlock(); height != 0 {
+		t.Errorf("cursor should not be imported, height = %d", height)
+	}
+	if _, err := storage.GetLocalBlock(3); err == nil {
+		t.Errorf("block 3 should not be imported")
+	}
+	if records, _ := storage.GetUnscanRecords(); len(records) != 0 {
+		t.Errorf("unscan records should not be imported: %d", len(records))
+	}
+}
@@ -16,8 +16,21 @@ import (
 )
 
 var (
-	DEFAULT_GAS_LIMIT = "250000"
-	DEFAULT_GAS_PRICE = decimal.New(4, -7)
+	DEFAULT_GAS_LIMIT uint64 = 20000 //合约调用默认gas上限
+	DEFAULT_GAS_PRICE uint64 = 25    //合约调用默认gas单价，单位Na
+)
+
+const (
+	//交易单扩展参数txType，用于创建共识、别名等交易
+	RawTxTypeJoinConsensus = "joinConsensus"
+	RawTxTypeCancelDeposit = "cancelDeposit"
+	RawTxTypeAlias         = "alias"
+
+	//feesSupportContractKey 交易单扩展参数中记录手续费充值交易对应代币合约的key
+	feesSupportContractKey = "feesSupportContract"
+
+	//resolvedAliasesKey 交易单扩展参数中记录接收别名解析结果的key
+	resolvedAliasesKey = "resolvedAliases"
 )
 
 type TransactionDecoder struct {
@@ -34,13 +47,73 @@ func NewTransactionDecoder(wm *WalletManager) *TransactionDecoder {
 
 //CreateRawTransaction 创建交易单
 func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	//共识委托、取消委托、设置别名交易
+	if rawTx.GetExtParam().Get("txType").Exists() {
+		return decoder.CreateTypedRawTransaction(wrapper, rawTx)
+	}
+
+	//接收地址可以是别名，创建前解析为地址
+	if err := decoder.resolveReceivers(rawTx); err != nil {
+		return err
+	}
+
 	if rawTx.Coin.IsContract {
+		//多个接收地址且没有配置批量转账方法，需要使用CreateNrc20BatchRawTransaction
+		if len(rawTx.To) > 1 && len(decoder.wm.Config.BatchTransferMethod) == 0 {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "token transaction with multiple receivers requires batchTransferMethod, or use CreateNrc20BatchRawTransaction")
+		}
 		return decoder.CreateNrc20RawTransaction(wrapper, rawTx, "")
 	} else {
 		return decoder.CreateSimpleRawTransaction(wrapper, rawTx)
 	}
 }
 
+//CreateTypedRawTransaction 根据交易单扩展参数txType创建共识、别名等交易
+func (decoder *TransactionDecoder) CreateTypedRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	switch txType := rawTx.GetExtParam().Get("txType").String(); txType {
+	case RawTxTypeJoinConsensus:
+		return decoder.CreateJoinConsensusRawTransaction(wrapper, rawTx)
+	case RawTxTypeCancelDeposit:
+		return decoder.CreateCancelDepositRawTransaction(wrapper, rawTx)
+	case RawTxTypeAlias:
+		return decoder.CreateAliasRawTransaction(wrapper, rawTx)
+	default:
+		return fmt.Errorf("unknown transaction type: %s", txType)
+	}
+}
+
+//resolveReceivers 把接收地址中的别名解析为地址，并校验地址
+func (decoder *TransactionDecoder) resolveReceivers(rawTx *openwallet.RawTransaction) error {
+
+	addressDecoder, ok := decoder.wm.Decoder.(*AddressDecoder)
+	if !ok {
+		return nil
+	}
+
+	resolved := make(map[string]string)
+	to := make(map[string]string)
+	for receiver, amount := range rawTx.To {
+		address, err := addressDecoder.ResolveAddress(receiver)
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "receiver[%s] is invalid, err: %v", receiver, err)
+		}
+		if _, exist := to[address]; exist {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "receiver[%s] is duplicated with address: %s", receiver, address)
+		}
+		if address != receiver {
+			resolved[receiver] = address
+		}
+		to[address] = amount
+	}
+
+	if len(resolved) > 0 {
+		rawTx.To = to
+		rawTx.SetExtParam(resolvedAliasesKey, resolved)
+	}
+
+	return nil
+}
+
 //CreateSummaryRawTransaction 创建汇总交易，返回原始交易单数组
 func (decoder *TransactionDecoder) CreateSummaryRawTransactionWithError(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransactionWithError, error) {
 	if sumRawTx.Coin.IsContract {
@@ -84,9 +157,9 @@ func (decoder *TransactionDecoder) CreateSimpleRawTransaction(wrapper openwallet
 
 	unspent := make([]*UtxoDto, 0)
 	for _, v := range searchAddrs {
-		unspentTemps, err := decoder.wm.Api.GetUnSpent(v)
+		unspentTemps, err := decoder.wm.GetAvailableUnspent(v)
 		if err != nil {
-			decoder.wm.Log.Warn("cant find the unspent...")
+			decoder.wm.Logger(LogSubsystemTx).Warn("get available unspent failed", "address", v, "err", err)
 			continue
 		}
 		unspent = append(unspent, unspentTemps...)
@@ -100,6 +173,12 @@ func (decoder *TransactionDecoder) CreateSimpleRawTransaction(wrapper openwallet
 		return errors.New("Receiver addresses is empty!")
 	}
 
+	//接收地址输出的锁定时间
+	outputLockTime, err := decoder.getOutputLockTime(rawTx)
+	if err != nil {
+		return err
+	}
+
 	//计算总发送金额
 	for addr, amount := range rawTx.To {
 		deamount, _ := decimal.NewFromString(amount)
@@ -133,7 +212,7 @@ func (decoder *TransactionDecoder) CreateSimpleRawTransaction(wrapper openwallet
 		feesRate, _ = decimal.NewFromString(rawTx.FeeRate)
 	}
 
-	decoder.wm.Log.Info("Calculating wallet unspent record to build transaction...")
+	decoder.wm.Logger(LogSubsystemTx).Info("calculating wallet unspent record to build transaction")
 	computeTotalSend := totalSend
 	//循环的计算余额是否足够支付发送数额+手续费
 	for {
@@ -186,19 +265,27 @@ func (decoder *TransactionDecoder) CreateSimpleRawTransaction(wrapper openwallet
 	//取账户最后一个地址
 	changeAddress := usedUTXO[0].Address
 
+	//输入地址的输出作为找零，锁定的输出不能发送到输入地址
+	if outputLockTime > 0 {
+		for _, u := range usedUTXO {
+			if _, ok := rawTx.To[u.Address]; ok {
+				return fmt.Errorf("time-locked output can not be sent to input address: %s", u.Address)
+			}
+		}
+	}
+
 	changeAmount := balance.Sub(computeTotalSend).Sub(actualFees)
 	rawTx.FeeRate = feesRate.StringFixed(decoder.wm.Decimal())
 	rawTx.Fees = actualFees.StringFixed(decoder.wm.Decimal())
 
-	decoder.wm.Log.Std.Notice("-----------------------------------------------")
-	decoder.wm.Log.Std.Notice("From Account: %s", accountID)
-	decoder.wm.Log.Std.Notice("To Address: %s", strings.Join(destinations, ", "))
-	decoder.wm.Log.Std.Notice("Use: %v", balance.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Fees: %v", actualFees.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Receive: %v", computeTotalSend.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Change: %v", changeAmount.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Change Address: %v", changeAddress)
-	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+	decoder.wm.Logger(LogSubsystemTx).Info("build transaction",
+		"account", accountID,
+		"to", strings.Join(destinations, ", "),
+		"use", balance.StringFixed(decoder.wm.Decimal()),
+		"fees", actualFees.StringFixed(decoder.wm.Decimal()),
+		"receive", computeTotalSend.StringFixed(decoder.wm.Decimal()),
+		"change", changeAmount.StringFixed(decoder.wm.Decimal()),
+		"changeAddress", changeAddress)
 
 	//装配输出
 	for to, amount := range rawTx.To {
@@ -221,7 +308,93 @@ func (decoder *TransactionDecoder) CreateSimpleRawTransaction(wrapper openwallet
 }
 
 //CreateNrc20RawTransaction 创建合约交易
-func (decoder *TransactionDecoder) CreateNrc20RawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, sendTragetAddress string) (error) {
+//多个接收地址时，调用配置的批量转账合约方法
+func (decoder *TransactionDecoder) CreateNrc20RawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, sendTragetAddress string) error {
+	return decoder.createNrc20RawTransaction(wrapper, rawTx, sendTragetAddress, nil)
+}
+
+//CreateNrc20BatchRawTransaction 创建多个接收地址的合约交易
+//配置了批量转账方法则创建一笔批量转账交易，否则每个接收地址创建一笔交易，已使用的utxo被锁定，各交易使用不同的utxo支付手续费
+func (decoder *TransactionDecoder) CreateNrc20BatchRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) ([]*openwallet.RawTransactionWithError, error) {
+
+	rawTxArray := make([]*openwallet.RawTransactionWithError, 0)
+
+	if !rawTx.Coin.IsContract {
+		return nil, errors.New("This is a token transaction!")
+	}
+
+	if len(rawTx.To) == 0 {
+		return nil, errors.New("Receiver addresses is empty!")
+	}
+
+	//接收地址可以是别名，创建前解析为地址
+	if err := decoder.resolveReceivers(rawTx); err != nil {
+		return nil, err
+	}
+
+	if len(rawTx.To) == 1 || len(decoder.wm.Config.BatchTransferMethod) > 0 {
+		if err := decoder.checkBatchTransferReceivers(rawTx); err != nil {
+			return nil, err
+		}
+		createErr := decoder.CreateNrc20RawTransaction(wrapper, rawTx, "")
+		rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+			RawTx: rawTx,
+			Error: openwallet.ConvertError(createErr),
+		})
+		return rawTxArray, nil
+	}
+
+	//按地址排序，保证创建顺序一致
+	destinations := make([]string, 0, len(rawTx.To))
+	for addr := range rawTx.To {
+		destinations = append(destinations, addr)
+	}
+	sort.Strings(destinations)
+
+	batch := newNrc20BatchContext()
+
+	for _, addr := range destinations {
+		subRawTx := &openwallet.RawTransaction{
+			Coin:     rawTx.Coin,
+			Account:  rawTx.Account,
+			FeeRate:  rawTx.FeeRate,
+			To:       map[string]string{addr: rawTx.To[addr]},
+			Required: rawTx.Required,
+		}
+
+		createErr := decoder.createNrc20RawTransaction(wrapper, subRawTx, "", batch)
+		rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+			RawTx: subRawTx,
+			Error: openwallet.ConvertError(createErr),
+		})
+	}
+
+	return rawTxArray, nil
+}
+
+//checkBatchTransferReceivers 检查批量转账的接收地址数量是否超过合约的限制
+func (decoder *TransactionDecoder) checkBatchTransferReceivers(rawTx *openwallet.RawTransaction) error {
+	max := decoder.wm.Config.BatchTransferMaxReceivers
+	if len(rawTx.To) > 1 && max > 0 && len(rawTx.To) > max {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "receivers: %d is over batch transfer limit: %d", len(rawTx.To), max)
+	}
+	return nil
+}
+
+//nrc20BatchContext 批量创建合约交易时，记录已转出的代币
+//已使用的utxo由LockUnspent锁定，GetAvailableUnspent不会再次选择
+type nrc20BatchContext struct {
+	tokenSpent map[string]decimal.Decimal
+}
+
+func newNrc20BatchContext() *nrc20BatchContext {
+	return &nrc20BatchContext{
+		tokenSpent: make(map[string]decimal.Decimal),
+	}
+}
+
+//createNrc20RawTransaction 创建合约交易，batch不为空时扣除批量中已转出的代币
+func (decoder *TransactionDecoder) createNrc20RawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, sendTragetAddress string, batch *nrc20BatchContext) error {
 
 	var (
 		outputAddrs        = make(map[string]decimal.Decimal)
@@ -229,13 +402,17 @@ func (decoder *TransactionDecoder) CreateNrc20RawTransaction(wrapper openwallet.
 		totalSend          = decimal.New(0, 0)
 		actualFees         = decimal.New(0, 0)
 		feesRate           = decimal.New(0, 0)
-		to                 string
+		destinations       = make([]string, 0)
+		amounts            = make([]decimal.Decimal, 0)
 		tokenAddress       string
 		tokenDecimal       uint64
 		sendAddressBalance decimal.Decimal
 		changeAddress      string
 		changeAmount       decimal.Decimal
 		sendAddress        string
+		gasLimit           uint64
+		gasPrice           = decoder.wm.Config.ContractGasPrice
+		estimateErr        error
 		accountID          = rawTx.Account.AccountID
 	)
 
@@ -258,26 +435,31 @@ func (decoder *TransactionDecoder) CreateNrc20RawTransaction(wrapper openwallet.
 		return errors.New("Receiver addresses is empty!")
 	}
 
-	if len(rawTx.To) > 1 {
-		return errors.New("Don't support !")
+	if len(rawTx.To) > 1 && len(decoder.wm.Config.BatchTransferMethod) == 0 {
+		return errors.New("batchTransferMethod is not configured, multiple receivers is not supported")
 	}
 
-	if len(rawTx.FeeRate) == 0 {
-		feesRate, err = decoder.wm.EstimateTokenFeeRate()
-		if err != nil {
-			return err
-		}
-	} else {
-		feesRate, _ = decimal.NewFromString(rawTx.FeeRate)
+	if err := decoder.checkBatchTransferReceivers(rawTx); err != nil {
+		return err
 	}
 
-	actualFees = feesRate //临定费率
-
 	//计算总发送金额
-	for addr, amount := range rawTx.To {
-		deamount, _ := decimal.NewFromString(amount)
+	for addr := range rawTx.To {
+		destinations = append(destinations, addr)
+	}
+	sort.Strings(destinations)
+	for _, addr := range destinations {
+		deamount, _ := decimal.NewFromString(rawTx.To[addr])
 		totalSend = totalSend.Add(deamount)
-		to = addr
+		amounts = append(amounts, deamount)
+	}
+
+	//创建合约调用
+	newToken := func(sender string) *nulsio_trans.TxToken {
+		if len(destinations) > 1 {
+			return newNrc20BatchTransferToken(sender, tokenAddress, decoder.wm.Config.BatchTransferMethod, destinations, amounts, tokenDecimal)
+		}
+		return newNrc20TransferToken(sender, tokenAddress, destinations[0], totalSend, tokenDecimal)
 	}
 
 	unspent := make([]*UtxoDto, 0)
@@ -290,23 +472,48 @@ func (decoder *TransactionDecoder) CreateNrc20RawTransaction(wrapper openwallet.
 				continue
 			}
 		}
-		tokenBalance, err := decoder.wm.Api.GetTokenBalances(tokenAddress, address.Address)
+		tokenBalance, err := decoder.wm.GetTokenBalance(tokenAddress, tokenDecimal, address.Address)
 		if err == nil {
 
+			//扣除批量中已转出的代币
+			if batch != nil {
+				tokenBalance = tokenBalance.Sub(batch.tokenSpent[address.Address])
+			}
+
 			//token是否足够
 			if tokenBalance.GreaterThanOrEqual(totalSend) {
-				unspentTemps, err := decoder.wm.Api.GetUnSpent(address.Address)
+
+				//自定义手续费则使用默认gas上限，否则通过节点预估gas
+				if len(rawTx.FeeRate) > 0 {
+					feesRate, _ = decimal.NewFromString(rawTx.FeeRate)
+					gasLimit = decoder.wm.Config.ContractGasLimit
+				} else {
+					gasLimit, err = decoder.wm.EstimateContractGas(newToken(address.Address))
+					if err != nil {
+						decoder.wm.Logger(LogSubsystemTx).Warn("estimate contract gas failed", "address", address.Address, "err", err)
+						estimateErr = err
+						continue
+					}
+					feesRate, err = decoder.wm.EstimateContractFee(gasLimit, gasPrice)
+					if err != nil {
+						return err
+					}
+				}
+
+				actualFees = feesRate
+
+				unspentTemps, err := decoder.wm.GetAvailableUnspent(address.Address)
 				if err != nil {
-					decoder.wm.Log.Warn("cant find the unspent...")
+					decoder.wm.Logger(LogSubsystemTx).Warn("get available unspent failed", "address", address.Address, "err", err)
 					continue
 				}
-				if unspentTemps != nil {
+				if len(unspentTemps) > 0 {
 					//查找utxo成功结束标记
 					unspentTempsFinish := false
 					//判断utxo是否足够
 					comSend := decimal.Zero
 					for _, u := range unspentTemps {
-						utxoBalance := decimal.New(u.Value, 0)
+						utxoBalance := decimal.New(u.Value, 0).Shift(-decoder.wm.Decimal())
 						comSend = comSend.Add(utxoBalance)
 					}
 					if comSend.GreaterThanOrEqual(actualFees) {
@@ -351,58 +558,61 @@ func (decoder *TransactionDecoder) CreateNrc20RawTransaction(wrapper openwallet.
 
 	if sendAddressBalance.LessThanOrEqual(decimal.Zero) {
 
+		if estimateErr != nil {
+			return openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "the [%s] contract call can not be estimated, err: %v", rawTx.Coin.Symbol, estimateErr)
+		}
+
 		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "the [%s] balance: %s is not enough to call smart contract", rawTx.Coin.Symbol, sendAddressBalance)
 
 	}
 
 	if len(unspent) == 0 {
-		return openwallet.Errorf(openwallet.ErrInsufficientFees, "the [%s] balance: %s is not enough to call smart contract", rawTx.Coin.Symbol)
+		return openwallet.Errorf(openwallet.ErrInsufficientFees, "the [%s] balance is not enough to pay fees: %s", rawTx.Coin.Symbol, actualFees.StringFixed(decoder.wm.Decimal()))
 
 	}
 
 	if changeAmount.LessThan(decimal.Zero) {
 		return fmt.Errorf("[%s] balance is not enough", rawTx.Coin.Contract.Name)
 	}
-	decoder.wm.Log.Info("Calculating wallet unspent record to build transaction...")
+	decoder.wm.Logger(LogSubsystemTx).Info("calculating wallet unspent record to build transaction")
 	computeTotalSend := totalSend
 
 	rawTx.FeeRate = feesRate.StringFixed(decoder.wm.Decimal())
 	rawTx.Fees = actualFees.StringFixed(decoder.wm.Decimal())
-
-	decoder.wm.Log.Std.Notice("-----------------------------------------------")
-	decoder.wm.Log.Std.Notice("From Account: %s", accountID)
-	decoder.wm.Log.Std.Notice("From Token Address: %s", sendAddress)
-	decoder.wm.Log.Std.Notice("From ContractAddress Address: %s", tokenAddress)
-	decoder.wm.Log.Std.Notice("From Token Address Balance: %s", sendAddressBalance.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("To Token Address: %s", to)
-	decoder.wm.Log.Std.Notice("To Token : %s", totalSend.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Use: %v", balance.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Fees: %v", actualFees.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Receive: %v", computeTotalSend.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Change: %v", changeAmount.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Change Address: %v", changeAddress)
-	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+	rawTx.SetExtParam("gasLimit", gasLimit)
+	rawTx.SetExtParam("gasPrice", gasPrice)
+
+	decoder.wm.Logger(LogSubsystemTx).Info("build token transaction",
+		"account", accountID,
+		"from", sendAddress,
+		"contract", tokenAddress,
+		"tokenBalance", sendAddressBalance.StringFixed(decoder.wm.Decimal()),
+		"to", strings.Join(destinations, ", "),
+		"tokenAmount", totalSend.StringFixed(decoder.wm.Decimal()),
+		"use", balance.StringFixed(decoder.wm.Decimal()),
+		"fees", actualFees.StringFixed(decoder.wm.Decimal()),
+		"gasLimit", gasLimit,
+		"receive", computeTotalSend.StringFixed(decoder.wm.Decimal()),
+		"change", changeAmount.StringFixed(decoder.wm.Decimal()),
+		"changeAddress", changeAddress)
 
 	if changeAmount.GreaterThan(decimal.New(0, 0)) {
 		outputAddrs = appendOutput(outputAddrs, changeAddress, changeAmount)
 	}
 
-	token := &nulsio_trans.TxToken{
-		Sender:          sendAddress,
-		ContractAddress: tokenAddress,
-		Value:           0,
-		GasLimit:        20000,
-		Price:           25,
-		MethodName:      "transfer",
-		ArgsCount:       2,
-		Args:            []string{to, totalSend.Shift(int32(tokenDecimal)).String()},
-	}
+	token := newToken(sendAddress)
+	token.GasLimit = gasLimit
+	token.Price = gasPrice
 
 	err = decoder.createSimpleNrc20RawTransaction(wrapper, rawTx, unspent, outputAddrs, token)
 	if err != nil {
 		return err
 	}
 
+	if batch != nil {
+		batch.markSpent(sendAddress, totalSend)
+	}
+
 	return nil
 }
 
@@ -447,7 +657,7 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 	for _, addrBalance := range addrBalanceArray {
 		//decoder.wm.Log.Debugf("addrBalance: %+v", addrBalance)
 		//检查余额是否超过最低转账
-		addrBalance_dec, _ := decimal.NewFromString(addrBalance.Balance)
+		addrBalance_dec, _ := decimal.NewFromString(addrBalance.ConfirmBalance)
 		if addrBalance_dec.GreaterThanOrEqual(minTransfer) {
 			//添加到转账地址数组
 			sumAddresses = append(sumAddresses, addrBalance.Address)
@@ -474,7 +684,7 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 
 	for i, addr := range sumAddresses {
 
-		unspents, err := decoder.wm.Api.GetUnSpent(addr)
+		unspents, err := decoder.wm.GetAvailableUnspent(addr)
 		if err != nil {
 			continue
 		}
@@ -521,10 +731,11 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 			retainedBalanceTotal := retainedBalance.Mul(decimal.New(int64(len(outputAddrs)), 0))
 			sumAmount := totalInputAmount.Sub(retainedBalanceTotal).Sub(fees)
 
-			decoder.wm.Log.Debugf("totalInputAmount: %v", totalInputAmount)
-			decoder.wm.Log.Debugf("retainedBalanceTotal: %v", retainedBalanceTotal)
-			decoder.wm.Log.Debugf("fees: %v", fees)
-			decoder.wm.Log.Debugf("sumAmount: %v", sumAmount)
+			decoder.wm.Logger(LogSubsystemTx).Debug("summary amount",
+				"totalInputAmount", totalInputAmount,
+				"retainedBalanceTotal", retainedBalanceTotal,
+				"fees", fees,
+				"sumAmount", sumAmount)
 
 			//最后填充汇总地址及汇总数量
 			outputAddrs = appendOutput(outputAddrs, sumRawTx.SummaryAddress, sumAmount)
@@ -570,27 +781,50 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 }
 
 //CreateTokenSummaryRawTransaction 创建代币汇总交易
+//地址主币不足以支付手续费时，先由手续费账户充值，待充值到账后再汇总代币
 func (decoder *TransactionDecoder) CreateTokenSummaryRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransactionWithError, error) {
 
 	var (
 		rawTxArray         = make([]*openwallet.RawTransactionWithError, 0)
 		accountID          = sumRawTx.Account.AccountID
 		feesSupportAccount *openwallet.AssetsAccount
-		supportFessAccount decimal.Decimal
-		fixSupportAmount   decimal.Decimal
+		supportFessAccount = decimal.Zero
+		fixSupportAmount   = decimal.Zero
+		feesSupportScale   = decimal.Zero
+		feedTo             = make(map[string]string)
 	)
 
 	tokenDecimals := int32(sumRawTx.Coin.Contract.Decimals)
 	minTransfer := common.StringNumToBigIntWithExp(sumRawTx.MinTransfer, tokenDecimals)
 	retainedBalance := common.StringNumToBigIntWithExp(sumRawTx.RetainedBalance, tokenDecimals)
 
+	if minTransfer.Cmp(retainedBalance) < 0 {
+		return nil, fmt.Errorf("mini transfer amount must be greater than address retained balance")
+	}
+
+	//计算手续费账户转账的手续费
+	feeMain, err := decoder.wm.EstimateFeeRate()
+	if err != nil {
+		return nil, err
+	}
+
 	// 如果有提供手续费账户，检查账户是否存在
 	if feesAcount := sumRawTx.FeesSupportAccount; feesAcount != nil {
-		var err error
-		fixSupportAmount, err = decimal.NewFromString(feesAcount.FixSupportAmount)
-		if err != nil {
-			return nil, openwallet.Errorf(openwallet.ErrAccountNotFound, "fixSupportAmount can't be nil")
+
+		//每次充值的数量，没有固定数量则按手续费倍率计算
+		if len(feesAcount.FixSupportAmount) > 0 {
+			fixSupportAmount, err = decimal.NewFromString(feesAcount.FixSupportAmount)
+			if err != nil {
+				return nil, openwallet.Errorf(openwallet.ErrAccountNotFound, "fixSupportAmount is invalid")
+			}
+		} else {
+			scale, scaleErr := decimal.NewFromString(feesAcount.FeesSupportScale)
+			if scaleErr != nil {
+				return nil, openwallet.Errorf(openwallet.ErrAccountNotFound, "fixSupportAmount and feesScale can't be both nil")
+			}
+			feesSupportScale = scale
 		}
+
 		account, supportErr := wrapper.GetAssetsAccountInfo(feesAcount.AccountID)
 		if supportErr != nil {
 			return nil, openwallet.Errorf(openwallet.ErrAccountNotFound, "can not find fees support account")
@@ -609,24 +843,17 @@ func (decoder *TransactionDecoder) CreateTokenSummaryRawTransaction(wrapper open
 			searchAddrs = append(searchAddrs, address.Address)
 		}
 
-		//查询主币余额是否足够
 		feeBalance, createErr := decoder.wm.Blockscanner.GetBalanceByAddress(searchAddrs...)
 		if createErr != nil {
 			return nil, createErr
 		}
 
-		if feeBalance != nil && len(feeBalance) > 0 {
-			for _, f := range feeBalance {
-				b, _ := decimal.NewFromString(f.Balance)
-				supportFessAccount = supportFessAccount.Add(b)
-			}
+		for _, f := range feeBalance {
+			b, _ := decimal.NewFromString(f.ConfirmBalance)
+			supportFessAccount = supportFessAccount.Add(b)
 		}
 	}
 
-	if minTransfer.Cmp(retainedBalance) < 0 {
-		return nil, fmt.Errorf("mini transfer amount must be greater than address retained balance")
-	}
-
 	//获取wallet
 	addresses, err := wrapper.GetAddressList(sumRawTx.AddressStartIndex, sumRawTx.AddressLimit,
 		"AccountID", sumRawTx.Account.AccountID)
@@ -648,10 +875,42 @@ func (decoder *TransactionDecoder) CreateTokenSummaryRawTransaction(wrapper open
 		return nil, err
 	}
 
-	toMap := make(map[string]string)
+	//充值手续费的交易单
+	createFeedTransaction := func() {
+		if len(feedTo) == 0 {
+			return
+		}
+
+		decoder.wm.Logger(LogSubsystemTx).Debug("create fees support transaction", "receivers", len(feedTo))
+
+		coinTemp := sumRawTx.Coin
+		coinTemp.IsContract = false
+		coinTemp.ContractID = ""
+		coinTemp.Contract = openwallet.SmartContract{}
+		rawTx := &openwallet.RawTransaction{
+			Coin:     coinTemp,
+			Account:  feesSupportAccount,
+			To:       feedTo,
+			Required: 1,
+		}
+
+		createTxErr := decoder.CreateSimpleRawTransaction(wrapper, rawTx)
+		if createTxErr == nil {
+			//广播成功后记录充值中的地址
+			createTxErr = rawTx.SetExtParam(feesSupportContractKey, sumRawTx.Coin.Contract.Address)
+		}
+
+		rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+			RawTx: rawTx,
+			Error: openwallet.ConvertError(createTxErr),
+		})
+
+		feedTo = make(map[string]string)
+	}
+
 	for _, addrBalance := range addrBalanceArray {
 
-		//trcBalance := big.NewInt(0)
+		address := addrBalance.Balance.Address
 
 		//检查余额是否超过最低转账
 		addrBalance_BI := common.StringNumToBigIntWithExp(addrBalance.Balance.Balance, tokenDecimals)
@@ -664,120 +923,117 @@ func (decoder *TransactionDecoder) CreateTokenSummaryRawTransaction(wrapper open
 		sumAmount_BI.Sub(addrBalance_BI, retainedBalance)
 		sumAmount := common.BigIntToDecimals(sumAmount_BI, tokenDecimals)
 
-		//计算token手续费
-		fee, createErr := decoder.wm.EstimateTokenFeeRate()
-		if createErr != nil {
-			decoder.wm.Log.Std.Error("GetTransactionFeeEstimated from[%v] -> to[%v] failed, err=%v", addrBalance.Balance.Address, sumRawTx.SummaryAddress, createErr)
-			return nil, createErr
-		}
-
-		//计算手续费
-		feeMain, createErr := decoder.wm.EstimateFeeRate()
-		if createErr != nil {
-			decoder.wm.Log.Std.Error("GetTransactionFeeEstimated from[%v] -> to[%v] failed, err=%v", addrBalance.Balance.Address, sumRawTx.SummaryAddress, createErr)
-			return nil, createErr
+		coinTemp := sumRawTx.Coin
+		coinTemp.IsContract = true
+		rawTx := &openwallet.RawTransaction{
+			Coin:    coinTemp,
+			Account: sumRawTx.Account,
+			To: map[string]string{
+				sumRawTx.SummaryAddress: sumAmount.StringFixed(int32(tokenDecimals)),
+			},
+			Required: 1,
 		}
 
 		//查询主币余额是否足够
-		addrNulsBalanceArray, createErr := decoder.wm.Blockscanner.GetBalanceByAddress(addrBalance.Balance.Address)
+		addrNulsBalanceArray, createErr := decoder.wm.Blockscanner.GetBalanceByAddress(address)
 		if createErr != nil {
-			return nil, createErr
+			rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+				RawTx: rawTx,
+				Error: openwallet.ConvertError(createErr),
+			})
+			continue
 		}
+
+		nulsBalance := decimal.Zero
 		if len(addrNulsBalanceArray) > 0 {
-			nulsBalance, _ := decimal.NewFromString(addrNulsBalanceArray[0].Balance)
-			//不够手续费，要充
-			if nulsBalance.LessThan(fee) {
-				totalMainFee := fixSupportAmount.Add(feeMain)
-				if supportFessAccount.LessThan(totalMainFee) {
-					decoder.wm.Log.Std.Error(" fees support address have not enough money,from[%v] -> to[%v] ,supportFessAccount[%v],fixSupportAmount[%v] failed", addrBalance.Balance.Address, sumRawTx.SummaryAddress, supportFessAccount, fixSupportAmount)
-					continue
-				} else {
-					decoder.wm.Log.Info("send fee Amount: %v", fixSupportAmount)
-					decoder.wm.Log.Info("fees: %v", feeMain)
-
-					sumRawTx.Coin.IsContract = false
-					toMap[addrBalance.Balance.Address] = fixSupportAmount.Truncate(decoder.wm.Decimal()).String()
-					supportFessAccount = supportFessAccount.Sub(totalMainFee)
-					//最后一个,或者差1个到50
-					if len(toMap) == decoder.wm.Config.MaxTxInputs {
-						//创建一笔交易单
-						coinTemp := sumRawTx.Coin
-						coinTemp.IsContract = false
-						rawTx := &openwallet.RawTransaction{
-							Coin:     coinTemp,
-							Account:  feesSupportAccount,
-							To:       toMap,
-							Required: 1,
-						}
+			nulsBalance, _ = decimal.NewFromString(addrNulsBalanceArray[0].ConfirmBalance)
+		}
 
-						createTxErr := decoder.CreateSimpleRawTransaction(
-							wrapper,
-							rawTx)
-						rawTxWithErr := &openwallet.RawTransactionWithError{
-							RawTx: rawTx,
-							Error: openwallet.ConvertError(createTxErr),
-						}
+		//计算token手续费，与创建汇总交易单时预估的gas一致
+		fee, createErr := decoder.estimateNrc20TransferFee(address, sumRawTx.SummaryAddress, sumAmount, sumRawTx.Coin.Contract)
+		if createErr != nil {
+			rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+				RawTx: rawTx,
+				Error: openwallet.ConvertError(createErr),
+			})
+			continue
+		}
 
-						//创建成功，添加到队列
-						rawTxArray = append(rawTxArray, rawTxWithErr)
+		//不够手续费，要充
+		if nulsBalance.LessThan(fee) {
 
-						//清理toMap
-						toMap = make(map[string]string)
-						return rawTxArray, nil
-					}
+			if feesSupportAccount == nil {
+				rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+					RawTx: rawTx,
+					Error: openwallet.Errorf(openwallet.ErrInsufficientFees, "address[%s] balance: %s is not enough to pay fees: %s", address, nulsBalance.String(), fee.String()),
+				})
+				continue
+			}
 
-					continue
+			//已充值但未到账，继续等待
+			if record, _ := decoder.wm.GetFeesSupportRecord(address); record != nil && !record.IsExpired(decoder.wm.Config.FeesSupportWaitTime) {
+				decoder.wm.Logger(LogSubsystemTx).Info("address is waiting for fees supported", "address", address)
+				rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+					RawTx: rawTx,
+					Error: openwallet.Errorf(openwallet.ErrInsufficientFees, "address[%s] is waiting for fees supported", address),
+				})
+				continue
+			}
 
-				}
+			supportAmount := fixSupportAmount
+			if supportAmount.IsZero() {
+				supportAmount = fee.Mul(feesSupportScale)
+			}
+			if supportAmount.LessThan(fee) {
+				rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+					RawTx: rawTx,
+					Error: openwallet.Errorf(openwallet.ErrInsufficientFees, "fees support amount: %s is less than token transaction fees: %s", supportAmount.String(), fee.String()),
+				})
+				continue
 			}
-		}
 
-		decoder.wm.Log.Debugf("balance: %v", addrBalance.Balance.Balance)
-		decoder.wm.Log.Debugf("fees: %v", fee)
-		decoder.wm.Log.Debugf("sumAmount: %v", sumAmount)
-		coinTemp := sumRawTx.Coin
-		coinTemp.IsContract = true
-		//创建一笔交易单
-		rawTx := &openwallet.RawTransaction{
-			Coin:    coinTemp,
-			Account: sumRawTx.Account,
-			To: map[string]string{
-				sumRawTx.SummaryAddress: sumAmount.StringFixed(int32(tokenDecimals)),
-			},
-			Required: 1,
-		}
+			totalMainFee := supportAmount.Add(feeMain)
+			if supportFessAccount.LessThan(totalMainFee) {
+				decoder.wm.Logger(LogSubsystemTx).Error("fees support account balance is not enough", "from", address, "to", sumRawTx.SummaryAddress, "supportBalance", supportFessAccount, "supportAmount", supportAmount)
+				rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+					RawTx: rawTx,
+					Error: openwallet.Errorf(openwallet.ErrInsufficientFees, "fees support account balance: %s is not enough", supportFessAccount.String()),
+				})
+				continue
+			}
 
-		createTxErr := decoder.CreateNrc20RawTransaction(
-			wrapper,
-			rawTx,
-			addrBalance.Balance.Address, )
-		rawTxWithErr := &openwallet.RawTransactionWithError{
-			RawTx: rawTx,
-			Error: openwallet.ConvertError(createTxErr),
-		}
+			decoder.wm.Logger(LogSubsystemTx).Debug("fees support", "address", address, "amount", supportAmount, "fees", feeMain)
 
-		//创建成功，添加到队列
-		rawTxArray = append(rawTxArray, rawTxWithErr)
+			feedTo[address] = supportAmount.Truncate(decoder.wm.Decimal()).String()
+			supportFessAccount = supportFessAccount.Sub(totalMainFee)
 
-	}
+			rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+				RawTx: rawTx,
+				Error: openwallet.Errorf(openwallet.ErrInsufficientFees, "address[%s] is waiting for fees supported", address),
+			})
 
-	//如果已经有toMap先组装
-	if len(toMap) > 0 {
+			//达到最大输出数，先创建一笔充值交易单
+			if len(feedTo) >= decoder.wm.Config.MaxTxInputs {
+				createFeedTransaction()
+			}
 
-		decoder.wm.Log.Debugf("have %v trans be send the fee", len(toMap))
-		//创建一笔交易单
-		coinTemp := sumRawTx.Coin
-		coinTemp.IsContract = false
-		rawTx := &openwallet.RawTransaction{
-			Coin:     coinTemp,
-			Account:  feesSupportAccount,
-			To:       toMap,
-			Required: 1,
+			continue
 		}
 
-		createTxErr := decoder.CreateSimpleRawTransaction(
+		decoder.wm.Logger(LogSubsystemTx).Debug("token summary amount",
+			"balance", addrBalance.Balance.Balance,
+			"fees", fee,
+			"sumAmount", sumAmount)
+
+		createTxErr := decoder.CreateNrc20RawTransaction(
 			wrapper,
-			rawTx)
+			rawTx,
+			address)
+		if createTxErr == nil {
+			//手续费已到账，清除充值记录
+			decoder.wm.DeleteFeesSupportRecord(address)
+		}
+
 		rawTxWithErr := &openwallet.RawTransactionWithError{
 			RawTx: rawTx,
 			Error: openwallet.ConvertError(createTxErr),
@@ -786,10 +1042,11 @@ func (decoder *TransactionDecoder) CreateTokenSummaryRawTransaction(wrapper open
 		//创建成功，添加到队列
 		rawTxArray = append(rawTxArray, rawTxWithErr)
 
-		//清理toMap
-		toMap = make(map[string]string)
 	}
 
+	//剩余的充值地址
+	createFeedTransaction()
+
 	return rawTxArray, nil
 }
 
@@ -806,13 +1063,25 @@ func (decoder *TransactionDecoder) SignRawTransaction(wrapper openwallet.WalletD
 		return err
 	}
 
+	//所有交易类型统一签名原始交易单的两次sha256
+	txHash, err := TransactionSigHash(rawTx.RawHex)
+	if err != nil {
+		return err
+	}
+
 	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
 	if keySignatures != nil {
 		for _, keySignature := range keySignatures {
 
+			if len(keySignature.Message) > 0 && keySignature.Message != hex.EncodeToString(txHash) {
+				return fmt.Errorf("sign message of address[%s] is not match transaction hash", keySignature.Address.Address)
+			}
+
 			childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
+			if err != nil {
+				return err
+			}
 			keyBytes, err := childKey.GetPrivateKeyBytes()
-			txHash,err := hex.DecodeString(keySignature.Message)
 			if err != nil {
 				return err
 			}
@@ -822,15 +1091,12 @@ func (decoder *TransactionDecoder) SignRawTransaction(wrapper openwallet.WalletD
 			signature, err := nulsio_trans.SignTransactionMessage(txHash, keyBytes)
 			if err != nil {
 				return fmt.Errorf("transaction hash sign failed, unexpected error: %v", err)
-			} else {
-
 			}
 
 			keySignature.Signature = hex.EncodeToString(signature)
 		}
 	}
 
-
 	rawTx.Signatures[rawTx.Account.AccountID] = keySignatures
 
 
@@ -851,35 +1117,41 @@ func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.Walle
 		return fmt.Errorf("transaction signature is empty")
 	}
 
-	sigPubByte := make([]byte, 0)
+	txHash := nulsio_trans.Sha256Twice(rawHex)
 
-	for accountID, keySignatures := range rawTx.Signatures {
-		decoder.wm.Log.Debug("accountID Signatures:", accountID)
-		for _, keySignature := range keySignatures {
+	//签名按输入地址的顺序排列
+	keySignatures, err := decoder.orderedKeySignatures(rawTx)
+	if err != nil {
+		decoder.wm.ReleaseUnspentLock(rawTx)
+		return err
+	}
 
-			signature, _ := hex.DecodeString(keySignature.Signature)
-			pub,_ := hex.DecodeString(keySignature.Address.PublicKey)
-			pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
+	sigPubByte := make([]byte, 0)
 
-			sigPub := &nulsio_trans.SigPub{
-				pub,
-				signature,
-			}
+	for _, keySignature := range keySignatures {
 
+		signature, _ := hex.DecodeString(keySignature.Signature)
+		pub, _ := hex.DecodeString(keySignature.Address.PublicKey)
+		pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
 
-			result := make([]byte, 0)
-			result = append(result, byte(len(pub)))
-			result = append(result, pub...)
+		if err = nulsio_trans.VerifyTransactionSignature(pub, txHash, signature); err != nil {
+			decoder.wm.ReleaseUnspentLock(rawTx)
+			return fmt.Errorf("signature of address[%s] is invalid, err: %v", keySignature.Address.Address, err)
+		}
 
-			result = append(result, 0)
-			resultSig := make([]byte, 0)
-			resultSig = append(resultSig, sigPub.ToBytes()...)
+		sigPub := &nulsio_trans.SigPub{
+			pub,
+			signature,
+		}
 
-			result = append(result, resultSig...)
+		result := make([]byte, 0)
+		result = append(result, byte(len(pub)))
+		result = append(result, pub...)
 
+		result = append(result, 0)
+		result = append(result, sigPub.ToBytes()...)
 
-			sigPubByte = append(sigPubByte, result...)
-		}
+		sigPubByte = append(sigPubByte, result...)
 	}
 
 	sigPubByte, _ = nulsio_trans.GetBytesWithLength(sigPubByte)
@@ -892,6 +1164,7 @@ func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.Walle
 
 	_, err = decoder.wm.Api.VaildTransaction(rawTx.RawHex)
 	if err != nil {
+		decoder.wm.ReleaseUnspentLock(rawTx)
 		return err
 	}
 
@@ -917,10 +1190,21 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 
 	txId, err := decoder.wm.Api.SendRawTransaction(rawTx.RawHex)
 	if err != nil {
+		decoder.wm.GetMetrics().AddCounter(MetricBroadcast, 1, "result", "failure")
+		decoder.wm.ReleaseUnspentLock(rawTx)
 		return nil, err
 	}
+	decoder.wm.GetMetrics().AddCounter(MetricBroadcast, 1, "result", "success")
 	rawTx.TxID = txId
 
+	//找零转为未确认utxo，可继续用于创建交易单
+	if lockErr := decoder.wm.ConfirmUnspentLock(rawTx, txId); lockErr != nil {
+		decoder.wm.Logger(LogSubsystemTx).Warn("confirm unspent lock failed", "txid", txId, "err", lockErr)
+	}
+
+	//手续费充值交易已广播，记录充值中的地址，到账前不再重复充值
+	decoder.wm.saveFeesSupportRecords(rawTx)
+
 	decimals := int32(0)
 	//fees := "0"
 	//if rawTx.Coin.IsContract {
@@ -952,6 +1236,60 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 	return tx, nil
 }
 
+//EstimateRawTransactionFee 预估交易单手续费，合约交易通过节点预估gas
+func (decoder *TransactionDecoder) EstimateRawTransactionFee(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	if !rawTx.Coin.IsContract {
+		fees, err := decoder.wm.EstimateFeeRate()
+		if err != nil {
+			return err
+		}
+		rawTx.Fees = fees.StringFixed(decoder.wm.Decimal())
+		return nil
+	}
+
+	var (
+		to        string
+		totalSend = decimal.Zero
+	)
+
+	for addr, amount := range rawTx.To {
+		deamount, _ := decimal.NewFromString(amount)
+		totalSend = totalSend.Add(deamount)
+		to = addr
+	}
+
+	address, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range address {
+		tokenBalance, err := decoder.wm.GetTokenBalance(rawTx.Coin.Contract.Address, rawTx.Coin.Contract.Decimals, a.Address)
+		if err != nil || tokenBalance.LessThan(totalSend) {
+			continue
+		}
+
+		token := newNrc20TransferToken(a.Address, rawTx.Coin.Contract.Address, to, totalSend, rawTx.Coin.Contract.Decimals)
+		gasLimit, err := decoder.wm.EstimateContractGas(token)
+		if err != nil {
+			return err
+		}
+
+		fees, err := decoder.wm.EstimateContractFee(gasLimit, decoder.wm.Config.ContractGasPrice)
+		if err != nil {
+			return err
+		}
+
+		rawTx.Fees = fees.StringFixed(decoder.wm.Decimal())
+		rawTx.SetExtParam("gasLimit", gasLimit)
+		rawTx.SetExtParam("gasPrice", decoder.wm.Config.ContractGasPrice)
+		return nil
+	}
+
+	return openwallet.Errorf(openwallet.ErrInsufficientTokenBalanceOfAddress, "[%s] token balance is not enough", rawTx.Account.AccountID)
+}
+
 //GetRawTransactionFeeRate 获取交易单的费率
 func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, unit string, err error) {
 	rate, err := decoder.wm.EstimateFeeRate()
@@ -981,6 +1319,7 @@ func (decoder *TransactionDecoder) createSimpleRawTransaction(
 		txFrom           = make([]string, 0)
 		txTo             = make([]string, 0)
 		accountID        = rawTx.Account.AccountID
+		changes          = make([]*PendingChange, 0)
 	)
 
 	if len(usedUTXO) == 0 {
@@ -991,6 +1330,9 @@ func (decoder *TransactionDecoder) createSimpleRawTransaction(
 		return fmt.Errorf("Receiver addresses is empty! ")
 	}
 
+	//接收地址输出的锁定时间，已在创建交易单时校验
+	outputLockTime := rawTx.GetExtParam().Get("lockTime").Int()
+
 	//计算总发送金额
 	for addr, deamount := range to {
 		//deamount, _ := decimal.NewFromString(amount)
@@ -1032,6 +1374,16 @@ func (decoder *TransactionDecoder) createSimpleRawTransaction(
 		//deamount, _ := decimal.NewFromString(amount)
 		amount = amount.Shift(decoder.wm.Decimal())
 		out := nulsio_trans.Vout{to, uint64(amount.IntPart()), 0}
+		//输入地址的输出为找零，不能锁定
+		_, isReceiver := rawTx.To[to]
+		if _, ok := addressMap[to]; ok {
+			if isReceiver && outputLockTime > 0 {
+				return fmt.Errorf("time-locked output can not be sent to input address: %s", to)
+			}
+			changes = append(changes, &PendingChange{TxIndex: int32(len(vouts)), Value: amount.IntPart(), Address: to})
+		} else if isReceiver {
+			out.LockTime = uint64(outputLockTime)
+		}
 		vouts = append(vouts, out)
 
 		txTo = append(txTo, fmt.Sprintf("%s:%s", to, amount))
@@ -1060,44 +1412,31 @@ func (decoder *TransactionDecoder) createSimpleRawTransaction(
 
 	rawTx.RawHex = signTrans
 
-	if rawTx.Signatures == nil {
-		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
-	}
-
-	//装配签名
-	keySigs := make([]*openwallet.KeySignature, 0)
-
-	//按照地址来
-	for i, _ := range addressMap {
-
-		beSignHex := signTrans
-
-		addr, err := wrapper.GetAddress(i)
-		if err != nil {
-			return err
-		}
-
-		signature := openwallet.KeySignature{
-			EccType: decoder.wm.Config.CurveType,
-			Nonce:   "",
-			Address: addr,
-			Message: beSignHex,
-		}
-
-		keySigs = append(keySigs, &signature)
-
+	//装配签名，签名顺序与输入地址一致
+	if err = decoder.setKeySignatures(wrapper, rawTx, signerAddresses(usedUTXO)); err != nil {
+		return err
 	}
 
 	feesDec, _ := decimal.NewFromString(rawTx.Fees)
 	accountTotalSent = accountTotalSent.Add(feesDec)
 	accountTotalSent = decimal.Zero.Sub(accountTotalSent)
 
-	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
 	rawTx.IsBuilt = true
 	rawTx.TxAmount = accountTotalSent.StringFixed(decoder.wm.Decimal())
 	rawTx.TxFrom = txFrom
 	rawTx.TxTo = txTo
 
+	//记录交易输入，用于导出离线签名包
+	if err = setRawTxInputs(rawTx, usedUTXO); err != nil {
+		return err
+	}
+
+	//锁定已使用的utxo，避免后续交易单重复使用
+	err = decoder.wm.LockUnspent(rawTx, usedUTXO, changes)
+	if err != nil {
+		return fmt.Errorf("lock unspent failed, unexpected error: %v", err)
+	}
+
 	return nil
 }
 
@@ -1121,6 +1460,7 @@ func (decoder *TransactionDecoder) createSimpleNrc20RawTransaction(
 		txFrom           = make([]string, 0)
 		txTo             = make([]string, 0)
 		accountID        = rawTx.Account.AccountID
+		changes          = make([]*PendingChange, 0)
 	)
 
 	if len(usedUTXO) == 0 {
@@ -1157,6 +1497,10 @@ func (decoder *TransactionDecoder) createSimpleNrc20RawTransaction(
 	for to, amount := range to {
 		amount = amount.Shift(decoder.wm.Decimal())
 		out := nulsio_trans.Vout{to, uint64(amount.IntPart()), 0}
+		//输入地址的输出为找零
+		if _, ok := addressMap[to]; ok {
+			changes = append(changes, &PendingChange{TxIndex: int32(len(vouts)), Value: amount.IntPart(), Address: to})
+		}
 		vouts = append(vouts, out)
 
 		txTo = append(txTo, fmt.Sprintf("%s:%s", to, amount))
@@ -1178,51 +1522,31 @@ func (decoder *TransactionDecoder) createSimpleNrc20RawTransaction(
 
 	rawTx.RawHex = signTrans
 
-	if rawTx.Signatures == nil {
-		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
-	}
-
-	//装配签名
-	keySigs := make([]*openwallet.KeySignature, 0)
-
-	//按照地址来
-	for i, _ := range addressMap {
-
-		beSignHex := signTrans
-		beSignHexHex, err := hex.DecodeString(beSignHex)
-		if err != nil {
-			return err
-		}
-
-		beSignHexHex = nulsio_trans.Sha256Twice(beSignHexHex) //sha256
-
-
-		addr, err := wrapper.GetAddress(i)
-		if err != nil {
-			return err
-		}
-
-		signature := openwallet.KeySignature{
-			EccType: decoder.wm.Config.CurveType,
-			Nonce:   "",
-			Address: addr,
-			Message: hex.EncodeToString(beSignHexHex),
-		}
-
-		keySigs = append(keySigs, &signature)
-
+	//装配签名，合约调用者排在输入地址之前
+	if err = decoder.setKeySignatures(wrapper, rawTx, signerAddresses(usedUTXO, token.Sender)); err != nil {
+		return err
 	}
 
 	feesDec, _ := decimal.NewFromString(rawTx.Fees)
 	accountTotalSent = accountTotalSent.Add(feesDec)
 	accountTotalSent = decimal.Zero.Sub(accountTotalSent)
 
-	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
 	rawTx.IsBuilt = true
 	rawTx.TxAmount = accountTotalSent.StringFixed(decoder.wm.Decimal())
 	rawTx.TxFrom = txFrom
 	rawTx.TxTo = txTo
 
+	//记录交易输入，用于导出离线签名包
+	if err = setRawTxInputs(rawTx, usedUTXO); err != nil {
+		return err
+	}
+
+	//锁定已使用的utxo，避免后续交易单重复使用
+	err = decoder.wm.LockUnspent(rawTx, usedUTXO, changes)
+	if err != nil {
+		return fmt.Errorf("lock unspent failed, unexpected error: %v", err)
+	}
+
 	return nil
 }
 
@@ -1242,6 +1566,83 @@ func (decoder *TransactionDecoder) createSimpleNrc20RawTransaction(
 //	return raTxWithErr, nil
 //}
 
+//getOutputLockTime 获取交易单扩展参数中接收地址输出的锁定时间
+//lockTime小于LockTimeThreshold为区块高度，否则为毫秒时间戳
+func (decoder *TransactionDecoder) getOutputLockTime(rawTx *openwallet.RawTransaction) (int64, error) {
+	result := rawTx.GetExtParam().Get("lockTime")
+	if !result.Exists() {
+		return 0, nil
+	}
+
+	lockTime := result.Int()
+	if lockTime <= 0 {
+		return 0, fmt.Errorf("invalid output lock time: %s", result.String())
+	}
+
+	//锁定时间已过，输出不会被锁定
+	if lockTime >= LockTimeThreshold {
+		if lockTime <= time.Now().UnixNano()/int64(time.Millisecond) {
+			return 0, fmt.Errorf("output lock time: %d is earlier than now", lockTime)
+		}
+	} else {
+		height, err := decoder.wm.Api.GetNewHeight()
+		if err != nil {
+			return 0, err
+		}
+		if lockTime <= height {
+			return 0, fmt.Errorf("output lock height: %d is not greater than current height: %d", lockTime, height)
+		}
+	}
+
+	return lockTime, nil
+}
+
+//newNrc20TransferToken 创建nrc20转账的合约调用
+func newNrc20TransferToken(sender, contractAddress, to string, amount decimal.Decimal, decimals uint64) *nulsio_trans.TxToken {
+	return &nulsio_trans.TxToken{
+		Sender:          sender,
+		ContractAddress: contractAddress,
+		Value:           0,
+		GasLimit:        DEFAULT_GAS_LIMIT,
+		Price:           DEFAULT_GAS_PRICE,
+		MethodName:      "transfer",
+		ArgsCount:       2,
+		Args:            []string{to, amount.Shift(int32(decimals)).String()},
+	}
+}
+
+//newNrc20BatchTransferToken 创建nrc20批量转账的合约调用
+func newNrc20BatchTransferToken(sender, contractAddress, methodName string, tos []string, amounts []decimal.Decimal, decimals uint64) *nulsio_trans.TxToken {
+	values := make([]string, 0, len(amounts))
+	for _, amount := range amounts {
+		values = append(values, amount.Shift(int32(decimals)).String())
+	}
+	return &nulsio_trans.TxToken{
+		Sender:          sender,
+		ContractAddress: contractAddress,
+		Value:           0,
+		GasLimit:        DEFAULT_GAS_LIMIT,
+		Price:           DEFAULT_GAS_PRICE,
+		MethodName:      methodName,
+		ArgsCount:       2,
+		ArrayArgs:       [][]string{tos, values},
+	}
+}
+
+//estimateNrc20TransferFee 通过节点预估gas计算代币转账的手续费，与CreateNrc20RawTransaction的计算一致
+func (decoder *TransactionDecoder) estimateNrc20TransferFee(sender, to string, amount decimal.Decimal, contract openwallet.SmartContract) (decimal.Decimal, error) {
+	gasLimit, err := decoder.wm.EstimateContractGas(newNrc20TransferToken(sender, contract.Address, to, amount, contract.Decimals))
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decoder.wm.EstimateContractFee(gasLimit, decoder.wm.Config.ContractGasPrice)
+}
+
+//markSpent 记录已转出的代币
+func (batch *nrc20BatchContext) markSpent(sender string, tokenAmount decimal.Decimal) {
+	batch.tokenSpent[sender] = batch.tokenSpent[sender].Add(tokenAmount)
+}
+
 func appendOutput(output map[string]decimal.Decimal, address string, amount decimal.Decimal) map[string]decimal.Decimal {
 	if origin, ok := output[address]; ok {
 		origin = origin.Add(amount)
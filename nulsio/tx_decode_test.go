@@ -0,0 +1,117 @@
+package nulsio
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+func TestTransactionDecoder_SubmitFeesSupportRawTransaction(t *testing.T) {
+
+	broadcastOK := false
+	wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {
+		if !broadcastOK {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "msg": "rejected"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{"value": "feedtx"}})
+	})
+	defer server.Close()
+	decoder := NewTransactionDecoder(wm)
+
+	rawTx := &openwallet.RawTransaction{
+		RawHex:      "00",
+		IsCompleted: true,
+		Account:     &openwallet.AssetsAccount{AccountID: "fees"},
+		To:          map[string]string{"addrA": "0.01"},
+	}
+	rawTx.SetExtParam(feesSupportContractKey, "contract")
+
+	//广播失败不记录充值，下次汇总可以重新充值
+	if _, err := decoder.SubmitRawTransaction(nil, rawTx); err == nil {
+		t.Fatalf("SubmitRawTransaction should fail")
+	}
+	if record, _ := wm.GetFeesSupportRecord("addrA"); record != nil {
+		t.Errorf("fees support record should not be saved before broadcast succeeds: %+v", record)
+	}
+
+	broadcastOK = true
+	if _, err := decoder.SubmitRawTransaction(nil, rawTx); err != nil {
+		t.Fatalf("SubmitRawTransaction failed, err: %v", err)
+	}
+	record, _ := wm.GetFeesSupportRecord("addrA")
+	if record == nil || record.ContractAddress != "contract" || record.Amount != "0.01" {
+		t.Errorf("fees support record = %+v", record)
+	}
+}
+
+func TestTransactionDecoder_CreateNrc20BatchRawTransactionLimit(t *testing.T) {
+
+	wm := testStateWalletManager()
+	wm.Config.BatchTransferMethod = "batchTransfer"
+	wm.Config.BatchTransferMaxReceivers = 2
+	decoder := NewTransactionDecoder(wm)
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{Symbol: Symbol, IsContract: true},
+		To:   map[string]string{"addrA": "1", "addrB": "1", "addrC": "1"},
+	}
+	if _, err := decoder.CreateNrc20BatchRawTransaction(nil, rawTx); err == nil {
+		t.Errorf("receivers over batch transfer limit should be rejected")
+	}
+}
+
+func TestTransactionDecoder_CreateSimpleRawTransactionLockedToInput(t *testing.T) {
+
+	decoder := NewTransactionDecoder(testStateWalletManager())
+
+	//接收地址也是输入地址，锁定的输出会被合并为找零
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol},
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		To:      map[string]string{"addrB": "1"},
+	}
+	rawTx.SetExtParam("lockTime", 100)
+	usedUTXO := []*UtxoDto{
+		{TxHash: "tx0", TxIndex: 0, Value: 100000000, Address: "addrA"},
+		{TxHash: "tx1", TxIndex: 0, Value: 200000000, Address: "addrB"},
+	}
+	to := map[string]decimal.Decimal{"addrB": decimal.New(1, 0), "addrA": decimal.New(199, -2)}
+
+	if err := decoder.createSimpleRawTransaction(&openwallet.WalletDAIBase{}, rawTx, usedUTXO, to); err == nil || !strings.Contains(err.Error(), "input address") {
+		t.Errorf("time-locked output to input address should be rejected, err: %v", err)
+	}
+}
+
+func TestTransactionDecoder_ResolveReceivers(t *testing.T) {
+
+	wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{"address": "NsdvjsZ8z9WHD2SXGnChhxPKm8eYfJfU"}})
+	})
+	defer server.Close()
+	wm.Decoder = NewAddressDecoder(wm)
+	decoder := NewTransactionDecoder(wm)
+
+	//别名解析为地址，解析结果记录在resolvedAliases，不与别名交易的alias参数冲突
+	rawTx := &openwallet.RawTransaction{To: map[string]string{"payee": "1"}}
+	if err := decoder.resolveReceivers(rawTx); err != nil {
+		t.Fatalf("resolveReceivers failed, err: %v", err)
+	}
+	if rawTx.To["NsdvjsZ8z9WHD2SXGnChhxPKm8eYfJfU"] != "1" || rawTx.GetExtParam().Get("alias").Exists() {
+		t.Errorf("receivers = %v, ext = %v", rawTx.To, rawTx.GetExtParam())
+	}
+	if address := rawTx.GetExtParam().Get(resolvedAliasesKey + ".payee").String(); address != "NsdvjsZ8z9WHD2SXGnChhxPKm8eYfJfU" {
+		t.Errorf("resolved alias = %s", address)
+	}
+
+	//按配置的链ID校验地址
+	wm.Config.ChainId = "261"
+	rawTx = &openwallet.RawTransaction{To: map[string]string{"NsdvjsZ8z9WHD2SXGnChhxPKm8eYfJfU": "1"}}
+	if err := decoder.resolveReceivers(rawTx); err == nil {
+		t.Errorf("address of other chain should be rejected")
+	}
+}
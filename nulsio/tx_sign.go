@@ -0,0 +1,135 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/blocktree/nulsio-adapter/nulsio_trans"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	//rawTxSignersKey 交易单扩展参数中记录签名地址顺序的key
+	rawTxSignersKey = "signers"
+)
+
+//TransactionSigHash 交易单待签名的哈希，所有交易类型统一为原始交易单的两次sha256
+func TransactionSigHash(rawHex string) ([]byte, error) {
+	rawBytes, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, fmt.Errorf("transaction hex is invalid, err: %v", err)
+	}
+	return nulsio_trans.Sha256Twice(rawBytes), nil
+}
+
+//signerAddresses 按输入顺序返回不重复的签名地址，extra为没有输入也需要签名的地址（如合约调用者）
+func signerAddresses(usedUTXO []*UtxoDto, extra ...string) []string {
+	signers := make([]string, 0)
+	exist := make(map[string]bool)
+	appendSigner := func(address string) {
+		if len(address) == 0 || exist[address] {
+			return
+		}
+		exist[address] = true
+		signers = append(signers, address)
+	}
+	for _, address := range extra {
+		appendSigner(address)
+	}
+	for _, u := range usedUTXO {
+		appendSigner(u.Address)
+	}
+	return signers
+}
+
+//setKeySignatures 按签名地址顺序装配待签名数据
+func (decoder *TransactionDecoder) setKeySignatures(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, signers []string) error {
+
+	hash, err := TransactionSigHash(rawTx.RawHex)
+	if err != nil {
+		return err
+	}
+
+	keySigs := make([]*openwallet.KeySignature, 0, len(signers))
+	for _, address := range signers {
+		addr, err := wrapper.GetAddress(address)
+		if err != nil {
+			return err
+		}
+
+		keySigs = append(keySigs, &openwallet.KeySignature{
+			EccType: decoder.wm.Config.CurveType,
+			Nonce:   "",
+			Address: addr,
+			Message: hex.EncodeToString(hash),
+		})
+	}
+
+	if rawTx.Signatures == nil {
+		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
+	}
+	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
+
+	return rawTx.SetExtParam(rawTxSignersKey, signers)
+}
+
+//orderedKeySignatures 按签名地址顺序返回签名，每个签名地址必须有且只有一个签名
+func (decoder *TransactionDecoder) orderedKeySignatures(rawTx *openwallet.RawTransaction) ([]*openwallet.KeySignature, error) {
+
+	accountIDs := make([]string, 0, len(rawTx.Signatures))
+	for accountID := range rawTx.Signatures {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Strings(accountIDs)
+
+	all := make([]*openwallet.KeySignature, 0)
+	keySigMap := make(map[string]*openwallet.KeySignature)
+	for _, accountID := range accountIDs {
+		for _, keySignature := range rawTx.Signatures[accountID] {
+			if keySignature.Address == nil {
+				return nil, fmt.Errorf("signature address is empty")
+			}
+			if _, exist := keySigMap[keySignature.Address.Address]; exist {
+				return nil, fmt.Errorf("address[%s] is signed repeatedly", keySignature.Address.Address)
+			}
+			keySigMap[keySignature.Address.Address] = keySignature
+			all = append(all, keySignature)
+		}
+	}
+
+	signers := rawTx.GetExtParam().Get(rawTxSignersKey).Array()
+	if len(signers) == 0 {
+		return all, nil
+	}
+
+	if len(signers) != len(all) {
+		return nil, fmt.Errorf("the number of signatures is not match signers")
+	}
+
+	ordered := make([]*openwallet.KeySignature, 0, len(signers))
+	for _, signer := range signers {
+		keySignature, ok := keySigMap[signer.String()]
+		if !ok {
+			return nil, fmt.Errorf("address[%s] has not signed", signer.String())
+		}
+		ordered = append(ordered, keySignature)
+	}
+
+	return ordered, nil
+}
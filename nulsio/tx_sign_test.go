@@ -0,0 +1,148 @@
+package nulsio
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/blocktree/nulsio-adapter/nulsio_txsigner"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//testAddressWrapper 按地址返回钱包地址
+type testAddressWrapper struct {
+	openwallet.WalletDAIBase
+	addresses map[string]*openwallet.Address
+}
+
+func (wrapper *testAddressWrapper) GetAddress(address string) (*openwallet.Address, error) {
+	addr, ok := wrapper.addresses[address]
+	if !ok {
+		return nil, fmt.Errorf("address[%s] not found", address)
+	}
+	return addr, nil
+}
+
+func TestSignerAddresses(t *testing.T) {
+
+	usedUTXO := []*UtxoDto{
+		{TxHash: "tx0", TxIndex: 0, Address: "addrB"},
+		{TxHash: "tx0", TxIndex: 1, Address: "addrC"},
+		{TxHash: "tx1", TxIndex: 0, Address: "addrB"},
+		{TxHash: "tx2", TxIndex: 0, Address: "sender"},
+	}
+
+	//按输入顺序去重
+	if signers := signerAddresses(usedUTXO); !reflect.DeepEqual(signers, []string{"addrB", "addrC", "sender"}) {
+		t.Errorf("signers = %v, want [addrB addrC sender]", signers)
+	}
+
+	//代币转账的发送地址排在最前
+	if signers := signerAddresses(usedUTXO, "sender"); !reflect.DeepEqual(signers, []string{"sender", "addrB", "addrC"}) {
+		t.Errorf("token signers = %v, want [sender addrB addrC]", signers)
+	}
+}
+
+func TestTransactionDecoder_OrderedKeySignatures(t *testing.T) {
+
+	decoder := NewTransactionDecoder(testStateWalletManager())
+	keySig := func(address string) *openwallet.KeySignature {
+		return &openwallet.KeySignature{Address: &openwallet.Address{Address: address}}
+	}
+	addresses := func(keySigs []*openwallet.KeySignature) []string {
+		list := make([]string, 0, len(keySigs))
+		for _, keySig := range keySigs {
+			list = append(list, keySig.Address.Address)
+		}
+		return list
+	}
+
+	//多个账户的签名按签名地址顺序排列
+	rawTx := &openwallet.RawTransaction{Signatures: map[string][]*openwallet.KeySignature{
+		"account2": {keySig("addrA")},
+		"account1": {keySig("addrC"), keySig("sender")},
+	}}
+	rawTx.SetExtParam(rawTxSignersKey, []string{"sender", "addrA", "addrC"})
+
+	ordered, err := decoder.orderedKeySignatures(rawTx)
+	if err != nil {
+		t.Fatalf("orderedKeySignatures failed, err: %v", err)
+	}
+	if list := addresses(ordered); !reflect.DeepEqual(list, []string{"sender", "addrA", "addrC"}) {
+		t.Errorf("ordered = %v, want [sender addrA addrC]", list)
+	}
+
+	//缺少签名地址
+	rawTx.Signatures["account2"] = []*openwallet.KeySignature{keySig("addrB")}
+	if _, err := decoder.orderedKeySignatures(rawTx); err == nil {
+		t.Errorf("signatures not match signers should be rejected")
+	}
+
+	//重复签名
+	rawTx.Signatures["account2"] = []*openwallet.KeySignature{keySig("addrC")}
+	if _, err := decoder.orderedKeySignatures(rawTx); err == nil {
+		t.Errorf("address signed repeatedly should be rejected")
+	}
+
+	//签名数量与签名地址不一致
+	rawTx.Signatures["account2"] = []*openwallet.KeySignature{keySig("addrA"), keySig("addrD")}
+	if _, err := decoder.orderedKeySignatures(rawTx); err == nil {
+		t.Errorf("the number of signatures not match signers should be rejected")
+	}
+}
+
+func TestTransactionSigner_SignDecoderMessage(t *testing.T) {
+
+	wm, server := testScannerWalletManager(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true,"data":{"value":true}}`))
+	})
+	defer server.Close()
+	decoder := NewTransactionDecoder(wm)
+
+	keys := make(map[string][]byte)
+	wrapper := &testAddressWrapper{addresses: make(map[string]*openwallet.Address)}
+	addrs := make([]*openwallet.Address, 0)
+	for _, prikeyHex := range []string{
+		"0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab",
+		"1f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab",
+		"2f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab",
+	} {
+		prikey, addr := testOfflineKey(t, prikeyHex)
+		keys[addr.Address] = prikey
+		wrapper.addresses[addr.Address] = addr
+		addrs = append(addrs, addr)
+	}
+
+	//3个地址的输入，由decoder装配待签名消息
+	rawTx := testOfflineRawTx(t, addrs...)
+	signers := []string{addrs[0].Address, addrs[1].Address, addrs[2].Address}
+	if err := decoder.setKeySignatures(wrapper, rawTx, signers); err != nil {
+		t.Fatalf("setKeySignatures failed, err: %v", err)
+	}
+
+	for _, keySig := range rawTx.Signatures[rawTx.Account.AccountID] {
+		msg, err := hex.DecodeString(keySig.Message)
+		if err != nil {
+			t.Fatalf("message is invalid, err: %v", err)
+		}
+		signature, err := nulsio_txsigner.Default.SignTransactionHash(msg, keys[keySig.Address.Address], keySig.EccType)
+		if err != nil {
+			t.Fatalf("SignTransactionHash failed, err: %v", err)
+		}
+		keySig.Signature = hex.EncodeToString(signature)
+	}
+
+	if err := decoder.VerifyRawTransaction(wrapper, rawTx); err != nil {
+		t.Fatalf("VerifyRawTransaction failed, err: %v", err)
+	}
+	if !rawTx.IsCompleted {
+		t.Errorf("transaction should be completed")
+	}
+
+	//已经是哈希的消息不能再次哈希，非32字节消息被拒绝
+	if _, err := nulsio_txsigner.Default.SignTransactionHash([]byte("raw"), keys[addrs[0].Address], 0); err == nil {
+		t.Errorf("message not 32 bytes should be rejected")
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+//ListUnscanRecords 列出未扫记录，dead为true只列出不再自动重扫的记录，否则列出等待重扫的记录
+func (wm *WalletManager) ListUnscanRecords(dead bool) ([]*UnscanRecord, error) {
+
+	list, err := wm.GetUnscanRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*UnscanRecord, 0)
+	for _, r := range list {
+		if r.Dead == dead {
+			records = append(records, r)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].BlockHeight == records[j].BlockHeight {
+			return records[i].TxID < records[j].TxID
+		}
+		return records[i].BlockHeight < records[j].BlockHeight
+	})
+
+	return records, nil
+}
+
+//RequeueUnscanRecord 重置未扫记录的重扫次数，下一轮重扫时立即重扫
+func (wm *WalletManager) RequeueUnscanRecord(id string) error {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	record, err := storage.GetUnscanRecord(id)
+	if err != nil {
+		return fmt.Errorf("unscan record [%s] not found: %v", id, err)
+	}
+
+	record.Attempts = 0
+	record.Dead = false
+	record.NextRetryAt = time.Now().Unix()
+
+	return storage.SaveUnscanRecord(record)
+}
+
+//DiscardUnscanRecord 丢弃未扫记录，不再重扫
+func (wm *WalletManager) DiscardUnscanRecord(id string) error {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	if _, err := storage.GetUnscanRecord(id); err != nil {
+		return fmt.Errorf("unscan record [%s] not found: %v", id, err)
+	}
+
+	return storage.DeleteUnscanRecordByID(id)
+}
+
+//DeleteUnscanRecordByID 删除指定的未扫记录
+func (wm *WalletManager) DeleteUnscanRecordByID(id string) error {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	return storage.DeleteUnscanRecordByID(id)
+}
+
+//countUnscanRecords 统计等待重扫和已进入死信的记录数
+func countUnscanRecords(list []*UnscanRecord) (pending, dead int) {
+	for _, r := range list {
+		if r.Dead {
+			dead++
+		} else {
+			pending++
+		}
+	}
+	return pending, dead
+}
+
+//saveUnscanRecord 直接保存未扫记录，覆盖已有的重扫进度
+func (wm *WalletManager) saveUnscanRecord(record *UnscanRecord) error {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	return storage.SaveUnscanRecord(record)
+}
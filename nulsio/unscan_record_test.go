@@ -0,0 +1,74 @@
+package nulsio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnscanRecord_RetryFailed(t *testing.T) {
+
+	record := NewUnscanRecord(10, "tx", "timeout")
+	now := record.CreateAt
+	if !record.IsRetryable(now) {
+		t.Errorf("new record should be retryable")
+	}
+
+	expected := []int64{60, 120, 240, 240}
+	for i, wait := range expected {
+		record.RetryFailed("", now, time.Minute, 4*time.Minute, 5)
+		if record.Attempts != i+1 || record.NextRetryAt != now+wait {
+			t.Errorf("attempt %d: next retry at %d, expected %d", record.Attempts, record.NextRetryAt-now, wait)
+		}
+		if record.IsRetryable(now) || !record.IsRetryable(now+wait) {
+			t.Errorf("attempt %d: retryable is wrong", record.Attempts)
+		}
+	}
+
+	record.RetryFailed("not found", now, time.Minute, 4*time.Minute, 5)
+	if !record.Dead || record.Reason != "not found" {
+		t.Errorf("record should be dead after max attempts: %+v", record)
+	}
+	if record.IsRetryable(now + 3600) {
+		t.Errorf("dead record should not be retryable")
+	}
+}
+
+func TestWalletManager_RequeueDiscardUnscanRecord(t *testing.T) {
+
+	wm := testStateWalletManager()
+	storage, _ := wm.GetStorage()
+
+	dead := NewUnscanRecord(1, "a", "timeout")
+	dead.Attempts = 10
+	dead.Dead = true
+	storage.SaveUnscanRecord(dead)
+	storage.SaveUnscanRecord(NewUnscanRecord(2, "b", "timeout"))
+
+	list, err := wm.ListUnscanRecords(true)
+	if err != nil || len(list) != 1 || list[0].ID != dead.ID {
+		t.Errorf("ListUnscanRecords dead failed, list: %v, err: %v", list, err)
+		return
+	}
+
+	if err = wm.RequeueUnscanRecord(dead.ID); err != nil {
+		t.Errorf("RequeueUnscanRecord failed, err: %v", err)
+		return
+	}
+	record, _ := storage.GetUnscanRecord(dead.ID)
+	if record.Dead || record.Attempts != 0 || !record.IsRetryable(time.Now().Unix()) {
+		t.Errorf("requeued record is wrong: %+v", record)
+	}
+	if list, _ = wm.ListUnscanRecords(false); len(list) != 2 {
+		t.Errorf("ListUnscanRecords pending expected 2, got %d", len(list))
+	}
+
+	if err = wm.DiscardUnscanRecord(dead.ID); err != nil {
+		t.Errorf("DiscardUnscanRecord failed, err: %v", err)
+	}
+	if err = wm.DiscardUnscanRecord(dead.ID); err == nil {
+		t.Errorf("DiscardUnscanRecord should fail on missing record")
+	}
+	if list, _ = wm.GetUnscanRecords(); len(list) != 1 {
+		t.Errorf("GetUnscanRecords expected 1, got %d", len(list))
+	}
+}
@@ -0,0 +1,259 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package nulsio
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	//utxoLockIDKey 交易单扩展参数中记录utxo锁定标识的key
+	utxoLockIDKey = "utxoLockID"
+)
+
+//UnspentLock 已被交易单使用的utxo，交易单广播后记录花费的txid
+type UnspentLock struct {
+	Key       string `storm:"id"` // primary key, txHash:index
+	LockID    string `storm:"index"`
+	TxHash    string
+	TxIndex   int32
+	Value     int64
+	LockTime  int64
+	Address   string
+	CreateAt  int64
+	SpentTxID string //花费该utxo的交易txid，为空则交易单未广播
+}
+
+//PendingChange 已广播交易单的找零输出，确认前可继续使用
+type PendingChange struct {
+	Key      string `storm:"id"` // primary key, txHash:index
+	LockID   string `storm:"index"`
+	TxHash   string
+	TxIndex  int32
+	Value    int64
+	Address  string
+	CreateAt int64
+}
+
+//IsExpired 是否已超过有效时间
+func (l *UnspentLock) IsExpired(expire time.Duration) bool {
+	return time.Now().After(time.Unix(l.CreateAt, 0).Add(expire))
+}
+
+//IsExpired 是否已超过有效时间
+func (c *PendingChange) IsExpired(expire time.Duration) bool {
+	return time.Now().After(time.Unix(c.CreateAt, 0).Add(expire))
+}
+
+//UtxoDto 转为可使用的utxo
+func (c *PendingChange) UtxoDto() *UtxoDto {
+	return &UtxoDto{
+		TxHash:  c.TxHash,
+		TxIndex: c.TxIndex,
+		Value:   c.Value,
+		Address: c.Address,
+	}
+}
+
+//GetAvailableUnspent 获取地址可用的utxo，排除已锁定的utxo，加入未确认的找零
+func (wm *WalletManager) GetAvailableUnspent(address string) ([]*UtxoDto, error) {
+
+	unspent, err := wm.Api.GetUnSpent(address)
+	if err != nil {
+		return nil, err
+	}
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		locked    = make(map[string]bool)
+		available = make([]*UtxoDto, 0, len(unspent))
+		exist     = make(map[string]bool)
+	)
+
+	locks, err := storage.GetUnspentLocks(address)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range locks {
+		if l.IsExpired(wm.Config.UnspentLockExpireTime) {
+			storage.DeleteUnspentLock(l.Key)
+			continue
+		}
+		locked[l.Key] = true
+	}
+
+	for _, u := range unspent {
+		exist[u.Key()] = true
+		if locked[u.Key()] {
+			continue
+		}
+		available = append(available, u)
+	}
+
+	changes, err := storage.GetPendingChanges(address)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		//节点已返回该utxo，或者已过期，则不再记录
+		if exist[c.Key] || c.IsExpired(wm.Config.UnspentLockExpireTime) {
+			storage.DeletePendingChange(c.Key)
+			continue
+		}
+		//交易单未广播，找零还不可使用
+		if len(c.LockID) > 0 || locked[c.Key] {
+			continue
+		}
+		available = append(available, c.UtxoDto())
+	}
+
+	return available, nil
+}
+
+//LockUnspent 锁定交易单使用的utxo，并记录交易单的找零输出
+func (wm *WalletManager) LockUnspent(rawTx *openwallet.RawTransaction, usedUTXO []*UtxoDto, changes []*PendingChange) error {
+
+	hash := sha256.Sum256([]byte(rawTx.RawHex))
+	lockID := hex.EncodeToString(hash[:])
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	locks := make([]*UnspentLock, 0, len(usedUTXO))
+	for _, u := range usedUTXO {
+		locks = append(locks, &UnspentLock{
+			Key:      u.Key(),
+			LockID:   lockID,
+			TxHash:   u.TxHash,
+			TxIndex:  u.TxIndex,
+			Value:    u.Value,
+			LockTime: u.LockTime,
+			Address:  u.Address,
+			CreateAt: now,
+		})
+	}
+
+	//找零的txHash在广播后才能确定，先以锁定标识保存
+	for _, c := range changes {
+		c.Key = fmt.Sprintf("%s:%d", lockID, c.TxIndex)
+		c.LockID = lockID
+		c.CreateAt = now
+	}
+
+	if err = storage.SaveUnspentLocks(locks, changes); err != nil {
+		return err
+	}
+
+	return rawTx.SetExtParam(utxoLockIDKey, lockID)
+}
+
+//ReleaseUnspentLock 交易单创建后失败，释放锁定的utxo
+func (wm *WalletManager) ReleaseUnspentLock(rawTx *openwallet.RawTransaction) error {
+
+	lockID := rawTx.GetExtParam().Get(utxoLockIDKey).String()
+	if len(lockID) == 0 {
+		return nil
+	}
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	return storage.DeleteUnspentLocksByID(lockID)
+}
+
+//ConfirmUnspentLock 交易单广播成功，已使用的utxo及找零转为以txid记录的未确认utxo
+func (wm *WalletManager) ConfirmUnspentLock(rawTx *openwallet.RawTransaction, txid string) error {
+
+	lockID := rawTx.GetExtParam().Get(utxoLockIDKey).String()
+	if len(lockID) == 0 {
+		return nil
+	}
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return err
+	}
+
+	return storage.ConfirmUnspentLocks(lockID, txid, time.Now().Unix())
+}
+
+//GetUnspentLockKeys 获取地址被交易单锁定的utxo，已过期的锁定不计
+//reserved为未广播交易单预留的utxo，spent为已广播交易单花费但节点仍返回的utxo
+func (wm *WalletManager) GetUnspentLockKeys(address string) (reserved, spent map[string]bool, err error) {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	locks, err := storage.GetUnspentLocks(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reserved = make(map[string]bool)
+	spent = make(map[string]bool)
+	for _, l := range locks {
+		if l.IsExpired(wm.Config.UnspentLockExpireTime) {
+			continue
+		}
+		if len(l.SpentTxID) > 0 {
+			spent[l.Key] = true
+		} else {
+			reserved[l.Key] = true
+		}
+	}
+
+	return reserved, spent, nil
+}
+
+//GetPendingChangeValue 获取地址已广播未确认的找零总额，exist为节点已返回的utxo，已确认的找零不再计入
+func (wm *WalletManager) GetPendingChangeValue(address string, exist map[string]bool) (int64, error) {
+
+	storage, err := wm.GetStorage()
+	if err != nil {
+		return 0, err
+	}
+
+	changes, err := storage.GetPendingChanges(address)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, c := range changes {
+		if exist[c.Key] || len(c.LockID) > 0 || c.IsExpired(wm.Config.UnspentLockExpireTime) {
+			continue
+		}
+		total += c.Value
+	}
+
+	return total, nil
+}
@@ -0,0 +1,54 @@
+package nulsio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestWalletManager_AddressBalanceDetailPending(t *testing.T) {
+
+	wm := testStateWalletManager()
+	wm.Config.UnspentLockExpireTime = time.Hour
+
+	//节点返回的utxo
+	var unspent []*UtxoDto
+	check := func(step string, spendable, reserved, pending, total string) {
+		t.Helper()
+		b, err := wm.addressBalanceDetail("addrA", unspent, 100, time.Now())
+		if err != nil {
+			t.Fatalf("%s: addressBalanceDetail failed, err: %v", step, err)
+		}
+		if b.Spendable.String() != spendable || b.Reserved.String() != reserved || b.Pending.String() != pending || b.Total().String() != total {
+			t.Errorf("%s: spendable = %s, reserved = %s, pending = %s, total = %s, want %s, %s, %s, %s",
+				step, b.Spendable, b.Reserved, b.Pending, b.Total(), spendable, reserved, pending, total)
+		}
+	}
+
+	u1 := &UtxoDto{TxHash: "tx0", TxIndex: 0, Value: 1000000000}
+	unspent = []*UtxoDto{u1}
+	check("unspent", "10", "0", "0", "10")
+
+	//创建交易单，使用u1，找零7，未广播前仍计入总余额
+	rawTx := &openwallet.RawTransaction{RawHex: "raw"}
+	change := &PendingChange{TxIndex: 1, Value: 700000000, Address: "addrA"}
+	if err := wm.LockUnspent(rawTx, []*UtxoDto{{TxHash: "tx0", TxIndex: 0, Value: 1000000000, Address: "addrA"}}, []*PendingChange{change}); err != nil {
+		t.Fatalf("LockUnspent failed, err: %v", err)
+	}
+	check("built", "0", "10", "0", "10")
+
+	//广播后，找零未确认
+	if err := wm.ConfirmUnspentLock(rawTx, "tx1"); err != nil {
+		t.Fatalf("ConfirmUnspentLock failed, err: %v", err)
+	}
+	check("broadcast", "0", "0", "7", "7")
+
+	//节点已返回找零，但还未移除已花费的u1
+	unspent = []*UtxoDto{u1, {TxHash: "tx1", TxIndex: 1, Value: 700000000}}
+	check("change confirmed, input not removed", "7", "0", "0", "7")
+
+	//交易确认
+	unspent = []*UtxoDto{{TxHash: "tx1", TxIndex: 1, Value: 700000000}}
+	check("confirmed", "7", "0", "0", "7")
+}
@@ -1,15 +1,20 @@
 package nulsio_addrdec
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"github.com/blocktree/go-owcdrivers/addressEncoder"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ripemd160"
+	"math/big"
 )
 
 const (
 	btcAlphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
 	addType = 1
+
+	//MainnetChainID NULS主网的链ID
+	MainnetChainID = 8964
 )
 
 var (
@@ -108,3 +113,60 @@ func ShortToBytes(val int) []byte {
 	bytes[0] = (byte)(0xFF & (val >> 0))
 	return bytes
 }
+
+//VerifyAddress 校验主网地址格式
+func VerifyAddress(address string) bool {
+	return VerifyAddressWithChainID(address, MainnetChainID)
+}
+
+//VerifyAddressWithChainID 校验地址格式，包括长度、链ID和异或校验位
+func VerifyAddressWithChainID(address string, chainID int) bool {
+	addressBytes, err := base58DecodeCheck([]byte(address))
+	if err != nil || len(addressBytes) != 24 {
+		return false
+	}
+	chainPart := ShortToBytes(chainID)
+	if addressBytes[0] != chainPart[0] || addressBytes[1] != chainPart[1] {
+		return false
+	}
+	return GetXor(addressBytes[:23]) == addressBytes[23]
+}
+
+//IsValidAlias 别名只能由小写字母、数字和下划线组成，长度1-20，不能以下划线开头或结尾
+func IsValidAlias(alias string) bool {
+	if len(alias) == 0 || len(alias) > 20 {
+		return false
+	}
+	if alias[0] == '_' || alias[len(alias)-1] == '_' {
+		return false
+	}
+	for _, c := range alias {
+		if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+//base58DecodeCheck base58解码，不截断结果，包含非法字符时返回错误
+func base58DecodeCheck(input []byte) ([]byte, error) {
+	result := big.NewInt(0)
+	zeroBytes := 0
+	for _, b := range input {
+		if b != '1' {
+			break
+		}
+		zeroBytes++
+	}
+
+	for _, b := range input[zeroBytes:] {
+		charIndex := bytes.IndexByte(b58Alphabet, b)
+		if charIndex < 0 {
+			return nil, errors.New("invalid base58 character")
+		}
+		result.Mul(result, big.NewInt(58))
+		result.Add(result, big.NewInt(int64(charIndex)))
+	}
+
+	return append(bytes.Repeat([]byte{0x00}, zeroBytes), result.Bytes()...), nil
+}
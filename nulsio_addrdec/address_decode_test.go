@@ -31,3 +31,40 @@ func TestHex(t *testing.T) {
 	fmt.Println(hex.EncodeToString(data))
 }
 
+
+func TestVerifyAddress(t *testing.T) {
+	pub, _ := hex.DecodeString("03ee8e9ed5440849f0704f067e4f0f7ba29da3f53051973b5babb81c78313e1139")
+	address, _ := GetAddressByPub(pub)
+	if !VerifyAddress(address) {
+		t.Errorf("VerifyAddress failed, address: %s", address)
+	}
+
+	if VerifyAddress(address[:len(address)-1] + "1") {
+		t.Errorf("VerifyAddress should fail with wrong checksum")
+	}
+
+	if VerifyAddress("nuls_alias") {
+		t.Errorf("VerifyAddress should fail with alias")
+	}
+
+	if VerifyAddressWithChainID(address, 261) {
+		t.Errorf("VerifyAddressWithChainID should fail with other chain id")
+	}
+}
+
+func TestIsValidAlias(t *testing.T) {
+	tests := map[string]bool{
+		"nuls_alias": true,
+		"abc123":     true,
+		"_abc":       false,
+		"abc_":       false,
+		"Abc":        false,
+		"":           false,
+		"abcdefghijklmnopqrstu": false,
+	}
+	for alias, expected := range tests {
+		if IsValidAlias(alias) != expected {
+			t.Errorf("IsValidAlias(%s) expected %v", alias, expected)
+		}
+	}
+}
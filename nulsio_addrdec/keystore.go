@@ -0,0 +1,180 @@
+package nulsio_addrdec
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/blocktree/go-owcdrivers/addressEncoder"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/pkg/errors"
+)
+
+//KeyStore NULS钱包导出的keystore格式，私钥使用密码AES加密
+type KeyStore struct {
+	Address             string  `json:"address"`
+	EncryptedPrivateKey string  `json:"encryptedPrivateKey"`
+	Alias               *string `json:"alias"`
+	PubKey              string  `json:"pubKey"`
+	Prikey              *string `json:"prikey"` //未设置密码的账户才有明文私钥
+}
+
+//EncryptPrivateKey 私钥加密，与NULS钱包一致：AES-256-CBC，密钥为sha256(密码)，IV为16字节0
+func EncryptPrivateKey(prikey []byte, password string) ([]byte, error) {
+	block, err := aes.NewCipher(passwordKey(password))
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(prikey)%aes.BlockSize
+	plain := append(append([]byte{}, prikey...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(encrypted, plain)
+	return encrypted, nil
+}
+
+//DecryptPrivateKey 使用密码解密私钥
+func DecryptPrivateKey(encrypted []byte, password string) ([]byte, error) {
+	if len(encrypted) == 0 || len(encrypted)%aes.BlockSize != 0 {
+		return nil, errors.New("encrypted private key length is invalid")
+	}
+	block, err := aes.NewCipher(passwordKey(password))
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(plain, encrypted)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("password is incorrect")
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+//ExportKeyStore 导出加密的keystore，不包含明文私钥
+func ExportKeyStore(prikey []byte, password string) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, errors.New("password is required to export keystore")
+	}
+
+	pub, address, err := privateKeyToAddress(prikey)
+	if err != nil {
+		return nil, err
+	}
+
+	//与NULS钱包一致，加密Java BigInteger格式的私钥字节
+	encrypted, err := EncryptPrivateKey(privateKeyBytes(prikey), password)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&KeyStore{
+		Address:             address,
+		EncryptedPrivateKey: hex.EncodeToString(encrypted),
+		PubKey:              hex.EncodeToString(pub),
+	})
+}
+
+//ImportKeyStore 导入keystore，返回私钥和地址，并校验私钥与地址对应
+func ImportKeyStore(data []byte, password string) ([]byte, string, error) {
+	var keyStore KeyStore
+	if err := json.Unmarshal(data, &keyStore); err != nil {
+		return nil, "", err
+	}
+
+	var (
+		prikey []byte
+		err    error
+	)
+	if len(keyStore.EncryptedPrivateKey) > 0 {
+		encrypted, err := hex.DecodeString(keyStore.EncryptedPrivateKey)
+		if err != nil {
+			return nil, "", errors.New("encrypted private key is invalid")
+		}
+		prikey, err = DecryptPrivateKey(encrypted, password)
+		if err != nil {
+			return nil, "", err
+		}
+	} else if keyStore.Prikey != nil {
+		prikey, err = hex.DecodeString(*keyStore.Prikey)
+		if err != nil {
+			return nil, "", errors.New("private key is invalid")
+		}
+	} else {
+		return nil, "", errors.New("keystore has no private key")
+	}
+
+	//NULS钱包的私钥为Java BigInteger格式，可能带有符号位前缀0x00或缺少前导0
+	prikey, err = normalizePrivateKey(prikey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, address, err := privateKeyToAddress(prikey)
+	if err != nil {
+		return nil, "", err
+	}
+	if address != keyStore.Address {
+		return nil, "", errors.New("private key is not match keystore address")
+	}
+
+	return prikey, address, nil
+}
+
+//PrivateKeyToWIF 私钥转为压缩格式的WIF
+func PrivateKeyToWIF(prikey []byte) (string, error) {
+	if len(prikey) != 32 {
+		return "", errors.New("private key length is invalid")
+	}
+	return addressEncoder.AddressEncode(prikey, NULSIO_mainnetPrivateWIFCompressed), nil
+}
+
+//WIFToPrivateKey 解析压缩格式的WIF私钥
+func WIFToPrivateKey(wif string) ([]byte, error) {
+	return addressEncoder.AddressDecode(wif, NULSIO_mainnetPrivateWIFCompressed)
+}
+
+//privateKeyBytes 私钥转为NULS钱包的字节格式，与Java BigInteger.toByteArray一致：
+//去掉前导0，最高位为1时加符号位前缀0x00
+func privateKeyBytes(prikey []byte) []byte {
+	b := bytes.TrimLeft(prikey, "\x00")
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+//normalizePrivateKey NULS钱包格式的私钥字节转为32字节私钥
+func normalizePrivateKey(prikey []byte) ([]byte, error) {
+	b := bytes.TrimLeft(prikey, "\x00")
+	if len(b) == 0 || len(b) > 32 {
+		return nil, errors.New("private key length is invalid")
+	}
+	return append(make([]byte, 32-len(b)), b...), nil
+}
+
+//passwordKey 密码的sha256作为AES密钥
+func passwordKey(password string) []byte {
+	key := sha256.Sum256([]byte(password))
+	return key[:]
+}
+
+//privateKeyToAddress 私钥计算压缩公钥和地址
+func privateKeyToAddress(prikey []byte) ([]byte, string, error) {
+	if len(prikey) != 32 {
+		return nil, "", errors.New("private key length is invalid")
+	}
+	pub, ret := owcrypt.GenPubkey(prikey, owcrypt.ECC_CURVE_SECP256K1)
+	if ret != owcrypt.SUCCESS {
+		return nil, "", errors.New("Get Pubkey failed!")
+	}
+	pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
+	address, err := GetAddressByPub(pub)
+	if err != nil {
+		return nil, "", err
+	}
+	return pub, address, nil
+}
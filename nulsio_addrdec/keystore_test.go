@@ -0,0 +1,184 @@
+package nulsio_addrdec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestEncryptPrivateKey(t *testing.T) {
+	//openssl enc -aes-256-cbc -K sha256("nuls123456") -iv 0
+	prikey, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000001")
+	want := "32de81223c9400db28e7508598af32beee8c08c54a02f6b1bd0ece79d8993508b72a1908a65e822263e7000bf19ca9c4"
+
+	encrypted, err := EncryptPrivateKey(prikey, "nuls123456")
+	if err != nil {
+		t.Errorf("EncryptPrivateKey failed, err: %v", err)
+		return
+	}
+	if hex.EncodeToString(encrypted) != want {
+		t.Errorf("EncryptPrivateKey = %x, want %s", encrypted, want)
+	}
+
+	decrypted, err := DecryptPrivateKey(encrypted, "nuls123456")
+	if err != nil || !bytes.Equal(decrypted, prikey) {
+		t.Errorf("DecryptPrivateKey failed, err: %v", err)
+	}
+}
+
+func TestKeyStoreRoundTrip(t *testing.T) {
+	prikey, _ := hex.DecodeString("0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+
+	data, err := ExportKeyStore(prikey, "nuls123456")
+	if err != nil {
+		t.Errorf("ExportKeyStore failed, err: %v", err)
+		return
+	}
+	if bytes.Contains(data, []byte(hex.EncodeToString(prikey))) {
+		t.Errorf("keystore should not contain plaintext private key")
+	}
+
+	imported, address, err := ImportKeyStore(data, "nuls123456")
+	if err != nil {
+		t.Errorf("ImportKeyStore failed, err: %v", err)
+		return
+	}
+	if !bytes.Equal(imported, prikey) || !VerifyAddress(address) {
+		t.Errorf("ImportKeyStore result is not match")
+	}
+
+	if _, _, err = ImportKeyStore(data, "wrong"); err == nil {
+		t.Errorf("ImportKeyStore should fail with wrong password")
+	}
+}
+
+func TestWIF(t *testing.T) {
+	prikey, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000001")
+	want := "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn"
+
+	wif, err := PrivateKeyToWIF(prikey)
+	if err != nil || wif != want {
+		t.Errorf("PrivateKeyToWIF = %s, want %s", wif, want)
+	}
+
+	decoded, err := WIFToPrivateKey(want)
+	if err != nil || !bytes.Equal(decoded, prikey) {
+		t.Errorf("WIFToPrivateKey failed, err: %v", err)
+	}
+}
+
+//NULS钱包导出的keystore格式，私钥为Java BigInteger字节，最高位为1时带符号位前缀0x00
+//没有可用的钱包导出文件，fixture按该格式由openssl与独立的secp256k1、base58实现生成
+var testKeyStoreFixtures = []struct {
+	name     string
+	prikey   string
+	address  string
+	keystore string
+	password string
+}{
+	{
+		name:     "encrypted",
+		prikey:   "0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab",
+		address:  "NsdvjsZ8z9WHD2SXGnChhxPKm8eYfJfU",
+		keystore: `{"address":"NsdvjsZ8z9WHD2SXGnChhxPKm8eYfJfU","encryptedPrivateKey":"8aea05db00c198f4e8f9f140a786992e5e23a9e149b83ab9e7c3deb70381cbfce009a922cf62134c35a40e26a5c33c03","alias":null,"pubKey":"039fda45f3fe5af624157878197a9c10c9970228f03d548f6ae1bbdd39a0d99807","prikey":null}`,
+		password: "nuls123456",
+	},
+	{
+		name:     "encrypted with sign byte",
+		prikey:   "8f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab",
+		address:  "Nse97Wqp4ygicx1putyriwoNRskqcmVX",
+		keystore: `{"address":"Nse97Wqp4ygicx1putyriwoNRskqcmVX","encryptedPrivateKey":"e7fca86420acaf8379396246b3727002b7e09fbea1210c44217133d92339dca939cebcc026820da082a5dc8ff3041fe3","alias":null,"pubKey":"0392406f497d0170ba816684f384f1925e406e71ca33109ba579b2e77c0e3c4127","prikey":null}`,
+		password: "nuls123456",
+	},
+	{
+		name:     "unencrypted",
+		prikey:   "8f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab",
+		address:  "Nse97Wqp4ygicx1putyriwoNRskqcmVX",
+		keystore: `{"address":"Nse97Wqp4ygicx1putyriwoNRskqcmVX","encryptedPrivateKey":null,"alias":null,"pubKey":"0392406f497d0170ba816684f384f1925e406e71ca33109ba579b2e77c0e3c4127","prikey":"008f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab"}`,
+	},
+}
+
+func TestImportKeyStoreFixture(t *testing.T) {
+
+	for _, test := range testKeyStoreFixtures {
+		prikey, _ := hex.DecodeString(test.prikey)
+		imported, importedAddress, err := ImportKeyStore([]byte(test.keystore), test.password)
+		if err != nil {
+			t.Errorf("%s: ImportKeyStore failed, err: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(imported, prikey) || importedAddress != test.address {
+			t.Errorf("%s: ImportKeyStore = %x, %s", test.name, imported, importedAddress)
+		}
+	}
+
+	//地址与私钥不对应
+	mismatch := `{"address":"NsdvAokV31ZxHBJnwbxQeug91BJdScMs","encryptedPrivateKey":null,"alias":null,"pubKey":"","prikey":"0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab"}`
+	if _, _, err := ImportKeyStore([]byte(mismatch), ""); err == nil {
+		t.Errorf("ImportKeyStore should fail when address is not match private key")
+	}
+}
+
+func TestExportKeyStoreFixture(t *testing.T) {
+
+	//导出的keystore与钱包格式一致，私钥按Java BigInteger字节加密
+	for _, test := range testKeyStoreFixtures {
+		if len(test.password) == 0 {
+			continue
+		}
+		prikey, _ := hex.DecodeString(test.prikey)
+		data, err := ExportKeyStore(prikey, test.password)
+		if err != nil {
+			t.Errorf("%s: ExportKeyStore failed, err: %v", test.name, err)
+			continue
+		}
+		if string(data) != test.keystore {
+			t.Errorf("%s: ExportKeyStore = %s, want %s", test.name, data, test.keystore)
+		}
+	}
+}
+
+func TestPrivateKeyBytes(t *testing.T) {
+
+	tests := []struct {
+		prikey string
+		want   string
+	}{
+		{"0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab", "0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab"},
+		{"8f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab", "008f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab"},
+		{"00fd8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab", "00fd8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab"},
+		{"002d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab", "2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab"},
+	}
+
+	for _, test := range tests {
+		prikey, _ := hex.DecodeString(test.prikey)
+		b := privateKeyBytes(prikey)
+		if hex.EncodeToString(b) != test.want {
+			t.Errorf("privateKeyBytes(%s) = %x, want %s", test.prikey, b, test.want)
+		}
+		normalized, err := normalizePrivateKey(b)
+		if err != nil || !bytes.Equal(normalized, prikey) {
+			t.Errorf("normalizePrivateKey(%x) = %x, err: %v", b, normalized, err)
+		}
+	}
+}
+
+func TestWIFFixture(t *testing.T) {
+	prikey, _ := hex.DecodeString("0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+	want := "KwjDQZbbLHuAeyPth4EaFoGiifGz61DYyPnGKADgS1UUWHnUqxdU"
+
+	wif, err := PrivateKeyToWIF(prikey)
+	if err != nil || wif != want {
+		t.Errorf("PrivateKeyToWIF = %s, want %s", wif, want)
+	}
+
+	decoded, err := WIFToPrivateKey(want)
+	if err != nil || !bytes.Equal(decoded, prikey) {
+		t.Errorf("WIFToPrivateKey failed, err: %v", err)
+	}
+
+	_, address, err := privateKeyToAddress(decoded)
+	if err != nil || address != "NsdvjsZ8z9WHD2SXGnChhxPKm8eYfJfU" {
+		t.Errorf("address of WIF = %s, err: %v", address, err)
+	}
+}
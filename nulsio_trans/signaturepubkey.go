@@ -22,15 +22,64 @@ func serilizeS(sig []byte) []byte {
 
 		s = numS.Bytes()
 		if len(s) < 32 {
-			for i := 0; i < 32-len(s); i++ {
-				s = append([]byte{0x00}, s...)
-			}
+			s = append(make([]byte, 32-len(s)), s...)
 		}
-		return append(sig[:32], s...)
+		return append(append([]byte{}, sig[:32]...), s...)
 	}
 	return sig
 }
 
+//NormalizeSignature 将64字节签名的s转为低位值，避免签名延展性
+func NormalizeSignature(sig []byte) []byte {
+	if len(sig) != 64 {
+		return sig
+	}
+	return serilizeS(sig)
+}
+
+//IsLowS 签名的s是否不大于曲线阶的一半
+func IsLowS(sig []byte) bool {
+	if len(sig) != 64 {
+		return false
+	}
+	numS := new(big.Int).SetBytes(sig[32:])
+	return numS.Sign() > 0 && numS.Cmp(new(big.Int).SetBytes(HalfCurveOrder)) <= 0
+}
+
+//VerifyTransactionSignature 验证签名，拒绝高位s的签名，pub为压缩公钥
+func VerifyTransactionSignature(pub, hash, sig []byte) error {
+	if len(pub) != 33 {
+		return errors.New("Only compressed pubkey is supported!")
+	}
+	if len(hash) != 32 {
+		return errors.New("Invalid transaction hash data!")
+	}
+	if len(sig) != 64 {
+		return errors.New("Invalid signature length!")
+	}
+	if !IsLowS(sig) {
+		return errors.New("Signature is not canonical with high s!")
+	}
+	pubkey := owcrypt.PointDecompress(pub, owcrypt.ECC_CURVE_SECP256K1)[1:]
+	if owcrypt.Verify(pubkey, nil, 0, hash, 32, sig, owcrypt.ECC_CURVE_SECP256K1) != owcrypt.SUCCESS {
+		return errors.New("Signature verify failed!")
+	}
+	return nil
+}
+
+//derInteger 32字节大端整数转为DER整数内容：去掉多余的前导0，最高位为1时补0
+func derInteger(b []byte) []byte {
+	i := 0
+	for i < len(b)-1 && b[i] == 0 {
+		i++
+	}
+	b = b[i:]
+	if b[0]&0x80 == 0x80 {
+		return append([]byte{0x00}, b...)
+	}
+	return append([]byte{}, b...)
+}
+
 func calcSignaturePubkey(txHash [][]byte, unlockData []TxUnlock) ([]SignaturePubkey, error) {
 	if len(txHash) != len(unlockData) {
 		return nil, errors.New("The number of private keys and hashes is not match!")
@@ -59,31 +108,8 @@ func calcSignaturePubkey(txHash [][]byte, unlockData []TxUnlock) ([]SignaturePub
 }
 
 func (sp SignaturePubkey) encodeToScript(sigType byte) []byte {
-	r := sp.Signature[:32]
-	s := sp.Signature[32:]
-
-	if r[0]&0x80 == 0x80 {
-		r = append([]byte{0x00}, r...)
-	} else {
-		for i := 0; i < 32; i++ {
-			if r[i] == 0 {
-				r = r[1:]
-			} else {
-				break
-			}
-		}
-	}
-	if s[0]&0x80 == 0x80 {
-		s = append([]byte{0}, s...)
-	} else {
-		for i := 0; i < 32; i++ {
-			if s[i] == 0 {
-				s = s[1:]
-			} else {
-				break
-			}
-		}
-	}
+	r := derInteger(sp.Signature[:32])
+	s := derInteger(sp.Signature[32:])
 
 	r = append([]byte{byte(len(r))}, r...)
 	r = append([]byte{0x02}, r...)
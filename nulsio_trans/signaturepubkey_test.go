@@ -0,0 +1,102 @@
+package nulsio_trans
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	owcrypt "github.com/blocktree/go-owcrypt"
+)
+
+func TestSigPubToBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		sig  string
+		want string
+	}{
+		{
+			name: "high bit r and s",
+			sig:  "8000000000000000000000000000000000000000000000000000000000000001" + "ff00000000000000000000000000000000000000000000000000000000000002",
+			want: "48304602210080000000000000000000000000000000000000000000000000000000000000010221" + "00ff00000000000000000000000000000000000000000000000000000000000002",
+		},
+		{
+			name: "r with two leading zero bytes",
+			sig:  "0000010000000000000000000000000000000000000000000000000000000001" + "0100000000000000000000000000000000000000000000000000000000000002",
+			want: "443042021e" + "010000000000000000000000000000000000000000000000000000000001" + "0220" + "0100000000000000000000000000000000000000000000000000000000000002",
+		},
+		{
+			name: "s with leading zero followed by high bit",
+			sig:  "0100000000000000000000000000000000000000000000000000000000000001" + "0080000000000000000000000000000000000000000000000000000000000002",
+			want: "46304402200100000000000000000000000000000000000000000000000000000000000001" + "0220" + "0080000000000000000000000000000000000000000000000000000000000002",
+		},
+		{
+			name: "small r and s",
+			sig:  "0000000000000000000000000000000000000000000000000000000000000001" + "0000000000000000000000000000000000000000000000000000000000000080",
+			want: "09300702010102020080",
+		},
+	}
+
+	for _, test := range tests {
+		sig, _ := hex.DecodeString(test.sig)
+		got := hex.EncodeToString(SigPub{Signature: sig}.ToBytes())
+		if got != test.want {
+			t.Errorf("%s: ToBytes = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeSignature(t *testing.T) {
+	order := new(big.Int).SetBytes(CurveOrder)
+
+	//s = n - 1 为高位值，规范化后为1，需要补足前导0
+	highS := new(big.Int).Sub(order, big.NewInt(1)).Bytes()
+	r, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000007")
+	sig := append(append([]byte{}, r...), highS...)
+
+	if IsLowS(sig) {
+		t.Errorf("IsLowS should be false with s = n - 1")
+	}
+
+	normalized := NormalizeSignature(sig)
+	want := "0000000000000000000000000000000000000000000000000000000000000007" + "0000000000000000000000000000000000000000000000000000000000000001"
+	if hex.EncodeToString(normalized) != want {
+		t.Errorf("NormalizeSignature = %x, want %s", normalized, want)
+	}
+	if !IsLowS(normalized) {
+		t.Errorf("IsLowS should be true after normalize")
+	}
+	if hex.EncodeToString(sig[32:]) != hex.EncodeToString(highS) {
+		t.Errorf("NormalizeSignature should not modify the input")
+	}
+}
+
+func TestSignTransactionMessageLowS(t *testing.T) {
+	for i := 0; i < 32; i++ {
+		prikey := sha256.Sum256([]byte{byte(i), 'k'})
+		hash := sha256.Sum256([]byte{byte(i), 'm'})
+
+		sig, err := SignTransactionMessage(hash[:], prikey[:])
+		if err != nil {
+			t.Errorf("SignTransactionMessage failed, err: %v", err)
+			return
+		}
+		if !IsLowS(sig) {
+			t.Errorf("SignTransactionMessage should produce low s signature: %x", sig)
+		}
+
+		pub, _ := owcrypt.GenPubkey(prikey[:], owcrypt.ECC_CURVE_SECP256K1)
+		pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
+		if err = VerifyTransactionSignature(pub, hash[:], sig); err != nil {
+			t.Errorf("VerifyTransactionSignature failed, err: %v", err)
+		}
+
+		//同一签名的高位s形式需要被拒绝
+		order := new(big.Int).SetBytes(CurveOrder)
+		highS := new(big.Int).Sub(order, new(big.Int).SetBytes(sig[32:])).Bytes()
+		highSig := append(append([]byte{}, sig[:32]...), append(make([]byte, 32-len(highS)), highS...)...)
+		if err = VerifyTransactionSignature(pub, hash[:], highSig); err == nil {
+			t.Errorf("VerifyTransactionSignature should reject high s signature")
+		}
+	}
+}
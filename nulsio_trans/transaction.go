@@ -59,6 +59,27 @@ func CreateEmptyRawTransaction(vins []Vin, vouts []Vout, remark string, lockTime
 	return hex.EncodeToString(txBytes), result, nil
 }
 
+//CreateEmptyTypedRawTransaction 创建指定类型的空交易单，txData为已序列化的交易业务数据
+func CreateEmptyTypedRawTransaction(txType int64, vins []Vin, vouts []Vout, remark string, txData []byte) (string, error) {
+	emptyTrans, err := newTransaction(vins, vouts, nil, 0, nil, false)
+	if err != nil {
+		return "", err
+	}
+
+	emptyTrans.Type = txType
+	emptyTrans.TxData = txData
+	if len(remark) > 0 {
+		emptyTrans.Remark, _ = GetBytesWithLength([]byte(remark))
+	}
+
+	txBytes, err := emptyTrans.encodeToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(txBytes), nil
+}
+
 func SignTransactionMessage(message []byte, prikey []byte) ([]byte, error) {
 
 	signature, retCode := owcrypt.Signature(prikey, nil, 0, message, 32, owcrypt.ECC_CURVE_SECP256K1)
@@ -66,7 +87,7 @@ func SignTransactionMessage(message []byte, prikey []byte) ([]byte, error) {
 		return nil, errors.New("Failed to sign message!")
 	}
 
-	return signature,nil
+	return serilizeS(signature), nil
 
 }
 
@@ -77,31 +98,10 @@ type SigPub struct {
 
 
 
+//ToBytes 签名编码为DER格式
 func (sp SigPub) ToBytes() []byte {
-	r := sp.Signature[:32]
-	s := sp.Signature[32:]
-	if r[0]&0x80 == 0x80 {
-		r = append([]byte{0x00}, r...)
-	} else {
-		for i := 0; i < 32; i++ {
-			if r[i] == 0 && r[i+1]&0x80 != 0x80 {
-				r = r[1:]
-			} else {
-				break
-			}
-		}
-	}
-	if s[0]&0x80 == 0x80 {
-		s = append([]byte{0}, s...)
-	} else {
-		for i := 0; i < 32; i++ {
-			if s[i] == 0 && s[i+1]&0x80 != 0x80 {
-				s = s[1:]
-			} else {
-				break
-			}
-		}
-	}
+	r := derInteger(sp.Signature[:32])
+	s := derInteger(sp.Signature[32:])
 
 	r = append([]byte{byte(len(r))}, r...)
 	r = append([]byte{0x02}, r...)
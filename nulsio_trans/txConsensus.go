@@ -0,0 +1,66 @@
+package nulsio_trans
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+const (
+	TxTypeAlias         = 3 //设置别名
+	TxTypeJoinConsensus = 5 //加入共识（委托）
+	TxTypeCancelDeposit = 6 //退出共识（取消委托）
+
+	//ConsensusLockTime 共识锁定的输出lockTime
+	ConsensusLockTime = int64(-1)
+)
+
+//NewDepositTxData 序列化委托交易业务数据：委托金额、委托地址、节点hash
+func NewDepositTxData(deposit uint64, address, agentHash string) ([]byte, error) {
+	ret := make([]byte, 0)
+	ret = append(ret, uint64ToLittleEndianBytes(deposit)...)
+
+	addressBytes, err := addressToBytes(address)
+	if err != nil {
+		return nil, err
+	}
+	addressFinal, _ := GetBytesWithLength(addressBytes)
+	ret = append(ret, addressFinal...)
+
+	hashBytes, err := hex.DecodeString(agentHash)
+	if err != nil || len(hashBytes) == 0 {
+		return nil, errors.New("Invalid agent hash!")
+	}
+	ret = append(ret, hashBytes...)
+
+	return ret, nil
+}
+
+//NewCancelDepositTxData 序列化取消委托交易业务数据：委托交易hash
+func NewCancelDepositTxData(joinTxHash string) ([]byte, error) {
+	hashBytes, err := hex.DecodeString(joinTxHash)
+	if err != nil || len(hashBytes) == 0 {
+		return nil, errors.New("Invalid join consensus tx hash!")
+	}
+	return hashBytes, nil
+}
+
+//NewAliasTxData 序列化设置别名交易业务数据：地址、别名
+func NewAliasTxData(address, alias string) ([]byte, error) {
+	addressBytes, err := addressToBytes(address)
+	if err != nil {
+		return nil, err
+	}
+	ret, _ := GetBytesWithLength(addressBytes)
+	aliasBytes, _ := GetBytesWithLength([]byte(alias))
+	ret = append(ret, aliasBytes...)
+	return ret, nil
+}
+
+//addressToBytes 地址转为23字节的地址数据
+func addressToBytes(address string) ([]byte, error) {
+	addressBytes := Base58Decode(address)
+	if len(addressBytes) < 23 {
+		return nil, errors.New("Invalid address!")
+	}
+	return addressBytes[:23], nil
+}
@@ -67,7 +67,9 @@ func (t Transaction) encodeToBytes() ([]byte, error) {
 
 	ret := []byte{}
 	var txType []byte
-	if t.TxData == nil {
+	if t.Type != 0 {
+		txType = uint16ToLittleEndianBytes(uint16(t.Type))
+	} else if t.TxData == nil {
 		txType = uint16ToLittleEndianBytes(2)
 	}else{
 		txType = uint16ToLittleEndianBytes(101)
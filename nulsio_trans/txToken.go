@@ -11,6 +11,22 @@ type TxToken struct {
 	MethodName      string
 	ArgsCount       int64
 	Args            []string
+	ArrayArgs       [][]string //数组类型的参数，设置后替代Args
+}
+
+//ContractArgs 合约调用的参数，用于节点接口
+func (tx *TxToken) ContractArgs() []interface{} {
+	args := make([]interface{}, 0)
+	if tx.ArrayArgs != nil {
+		for _, v := range tx.ArrayArgs {
+			args = append(args, v)
+		}
+		return args
+	}
+	for _, v := range tx.Args {
+		args = append(args, v)
+	}
+	return args
 }
 
 func newTxTokenToBytes(tx *TxToken) ([]byte, error) {
@@ -29,6 +45,16 @@ func newTxTokenToBytes(tx *TxToken) ([]byte, error) {
 	ret = append(ret, methodName...)
 	ret = append(ret, 0)
 	ret = append(ret, byte(tx.ArgsCount))
+	if tx.ArrayArgs != nil {
+		for _, values := range tx.ArrayArgs {
+			ret = append(ret, VarIntEncode(int64(len(values)))...)
+			for _, v := range values {
+				arg, _ := GetBytesWithLength([]byte(v))
+				ret = append(ret, arg...)
+			}
+		}
+		return ret, nil
+	}
 	for _, v := range tx.Args {
 		arg, _ := GetBytesWithLength([]byte(v))
 		ret = append(ret, 1)
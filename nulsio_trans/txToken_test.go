@@ -0,0 +1,54 @@
+package nulsio_trans
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"testing"
+)
+
+func TestNewTxTokenToBytes_ArrayLength(t *testing.T) {
+	tests := []struct {
+		count  int
+		prefix string
+	}{
+		{count: 1, prefix: "01"},
+		{count: 252, prefix: "fc"},
+		{count: 253, prefix: "fdfd00"},
+		{count: 255, prefix: "fdff00"},
+		{count: 256, prefix: "fd0001"},
+		{count: 300, prefix: "fd2c01"},
+	}
+
+	for _, test := range tests {
+		tos := make([]string, 0, test.count)
+		for i := 0; i < test.count; i++ {
+			tos = append(tos, strconv.Itoa(i%10))
+		}
+		tx := &TxToken{
+			Sender:          "NsdvAokV31ZxHBJnwbxQeug91BJdScMs",
+			ContractAddress: "NsdvafMC4mvpYk6Srq9J2Z5AsGEJ7iF6",
+			MethodName:      "batchTransfer",
+			ArgsCount:       1,
+			ArrayArgs:       [][]string{tos},
+		}
+
+		data, err := newTxTokenToBytes(tx)
+		if err != nil {
+			t.Fatalf("count %d: newTxTokenToBytes failed, err: %v", test.count, err)
+		}
+
+		//地址各23字节，value、gasLimit、price各8字节，方法名，方法描述0，参数个数
+		methodName, _ := GetBytesWithLength([]byte(tx.MethodName))
+		offset := 23*2 + 24 + len(methodName) + 2
+		prefix, _ := hex.DecodeString(test.prefix)
+		if !bytes.Equal(data[offset:offset+len(prefix)], prefix) {
+			t.Errorf("count %d: array length = %x, want %s", test.count, data[offset:offset+len(prefix)], test.prefix)
+		}
+
+		//每个元素为1字节长度+1字节内容
+		if want := offset + len(prefix) + 2*test.count; len(data) != want {
+			t.Errorf("count %d: data length = %d, want %d", test.count, len(data), want)
+		}
+	}
+}
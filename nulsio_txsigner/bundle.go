@@ -0,0 +1,206 @@
+package nulsio_txsigner
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/nulsio-adapter/nulsio_addrdec"
+	"github.com/blocktree/nulsio-adapter/nulsio_trans"
+	"github.com/blocktree/openwallet/hdkeystore"
+)
+
+const (
+	//SignBundleVersion 离线签名包格式版本
+	SignBundleVersion = 1
+)
+
+//SignBundle 离线签名包，包含待签名交易单和签名所需的地址信息
+type SignBundle struct {
+	Version   int            `json:"version"`
+	Symbol    string         `json:"symbol"`
+	AccountID string         `json:"accountID"`
+	RawHex    string         `json:"rawHex"`
+	Hash      string         `json:"hash"` //待签名的交易哈希
+	Inputs    []*BundleInput `json:"inputs"`
+}
+
+//BundleInput 交易输入及其所有者
+type BundleInput struct {
+	TxHash    string `json:"txHash"`
+	TxIndex   int32  `json:"txIndex"`
+	Amount    int64  `json:"amount"`
+	Address   string `json:"address"`
+	HDPath    string `json:"hdPath"`
+	PublicKey string `json:"publicKey"`
+}
+
+//BundleSignature 地址对交易哈希的签名
+type BundleSignature struct {
+	Address   string `json:"address"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+//NewSignBundle 创建离线签名包，待签名的哈希为原始交易单的两次sha256
+func NewSignBundle(symbol, accountID, rawHex string, inputs []*BundleInput) (*SignBundle, error) {
+	rawBytes, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, fmt.Errorf("raw hex is invalid, err: %v", err)
+	}
+
+	return &SignBundle{
+		Version:   SignBundleVersion,
+		Symbol:    symbol,
+		AccountID: accountID,
+		RawHex:    rawHex,
+		Hash:      hex.EncodeToString(nulsio_trans.Sha256Twice(rawBytes)),
+		Inputs:    inputs,
+	}, nil
+}
+
+//DecodeSignBundle 解析离线签名包
+func DecodeSignBundle(data []byte) (*SignBundle, error) {
+	var bundle SignBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, err
+	}
+	if err := bundle.Check(); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+//Encode 序列化离线签名包
+func (bundle *SignBundle) Encode() ([]byte, error) {
+	return json.Marshal(bundle)
+}
+
+//Check 检查签名包版本，以及哈希是否与原始交易单一致
+func (bundle *SignBundle) Check() error {
+	if bundle.Version != SignBundleVersion {
+		return fmt.Errorf("unsupported sign bundle version: %d", bundle.Version)
+	}
+	if len(bundle.Inputs) == 0 {
+		return errors.New("sign bundle inputs is empty")
+	}
+	rawBytes, err := hex.DecodeString(bundle.RawHex)
+	if err != nil {
+		return fmt.Errorf("raw hex is invalid, err: %v", err)
+	}
+	if hex.EncodeToString(nulsio_trans.Sha256Twice(rawBytes)) != bundle.Hash {
+		return errors.New("sign bundle hash is not match raw hex")
+	}
+	return nil
+}
+
+//Owners 按输入顺序返回不重复的输入所有者
+func (bundle *SignBundle) Owners() []*BundleInput {
+	owners := make([]*BundleInput, 0)
+	exist := make(map[string]bool)
+	for _, in := range bundle.Inputs {
+		if exist[in.Address] {
+			continue
+		}
+		exist[in.Address] = true
+		owners = append(owners, in)
+	}
+	return owners
+}
+
+//SignBundle 使用HD根密钥按输入的HD路径签名，返回每个输入所有者的签名
+func (singer *TransactionSigner) SignBundle(bundle *SignBundle, key *hdkeystore.HDKey) ([]*BundleSignature, error) {
+
+	if err := bundle.Check(); err != nil {
+		return nil, err
+	}
+
+	signatures := make([]*BundleSignature, 0)
+	for _, owner := range bundle.Owners() {
+		childKey, err := key.DerivedKeyWithPath(owner.HDPath, owcrypt.ECC_CURVE_SECP256K1)
+		if err != nil {
+			return nil, err
+		}
+		prikey, err := childKey.GetPrivateKeyBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		sig, err := singer.SignBundleWithPrivateKey(bundle, owner.Address, prikey)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, sig)
+	}
+
+	return signatures, nil
+}
+
+//SignBundleWithPrivateKey 使用地址的私钥签名，私钥必须与地址对应
+func (singer *TransactionSigner) SignBundleWithPrivateKey(bundle *SignBundle, address string, prikey []byte) (*BundleSignature, error) {
+
+	hash, err := hex.DecodeString(bundle.Hash)
+	if err != nil || len(hash) != 32 {
+		return nil, errors.New("sign bundle hash is invalid")
+	}
+
+	pub, ret := owcrypt.GenPubkey(prikey, owcrypt.ECC_CURVE_SECP256K1)
+	if ret != owcrypt.SUCCESS {
+		return nil, errors.New("Get Pubkey failed!")
+	}
+	pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
+
+	keyAddress, err := nulsio_addrdec.GetAddressByPub(pub)
+	if err != nil {
+		return nil, err
+	}
+	if keyAddress != address {
+		return nil, fmt.Errorf("private key is not belong to address: %s", address)
+	}
+
+	signature, err := nulsio_trans.SignTransactionMessage(hash, prikey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BundleSignature{
+		Address:   address,
+		PublicKey: hex.EncodeToString(pub),
+		Signature: hex.EncodeToString(signature),
+	}, nil
+}
+
+//VerifyBundleSignature 验证签名是否由签名公钥对交易哈希签署，且公钥与地址对应
+func VerifyBundleSignature(bundle *SignBundle, sig *BundleSignature) error {
+
+	hash, err := hex.DecodeString(bundle.Hash)
+	if err != nil || len(hash) != 32 {
+		return errors.New("sign bundle hash is invalid")
+	}
+
+	pub, err := hex.DecodeString(sig.PublicKey)
+	if err != nil || len(pub) != 33 {
+		return fmt.Errorf("public key of address[%s] is invalid", sig.Address)
+	}
+
+	pubAddress, err := nulsio_addrdec.GetAddressByPub(pub)
+	if err != nil {
+		return err
+	}
+	if pubAddress != sig.Address {
+		return fmt.Errorf("public key is not belong to address: %s", sig.Address)
+	}
+
+	signature, err := hex.DecodeString(sig.Signature)
+	if err != nil || len(signature) != 64 {
+		return fmt.Errorf("signature of address[%s] is invalid", sig.Address)
+	}
+
+	if err = nulsio_trans.VerifyTransactionSignature(pub, hash, signature); err != nil {
+		return fmt.Errorf("signature of address[%s] verify failed, err: %v", sig.Address, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package nulsio_txsigner
+
+import (
+	"encoding/hex"
+	"testing"
+
+	owcrypt "github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/nulsio-adapter/nulsio_addrdec"
+)
+
+//testKeyAddress 根据私钥生成压缩公钥和地址
+func testKeyAddress(t *testing.T, prikeyHex string) ([]byte, string, string) {
+	t.Helper()
+	prikey, _ := hex.DecodeString(prikeyHex)
+	pub, ret := owcrypt.GenPubkey(prikey, owcrypt.ECC_CURVE_SECP256K1)
+	if ret != owcrypt.SUCCESS {
+		t.Fatalf("GenPubkey failed")
+	}
+	pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
+	address, err := nulsio_addrdec.GetAddressByPub(pub)
+	if err != nil {
+		t.Fatalf("GetAddressByPub failed, err: %v", err)
+	}
+	return prikey, hex.EncodeToString(pub), address
+}
+
+func TestSignBundleRoundTrip(t *testing.T) {
+
+	prikey, pub, address := testKeyAddress(t, "0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+	otherKey, _, otherAddress := testKeyAddress(t, "1f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+
+	bundle, err := NewSignBundle("NULS", "account", "0200a1b2c3d4e5f6", []*BundleInput{
+		{TxHash: "tx0", TxIndex: 0, Amount: 100000000, Address: address, PublicKey: pub},
+		{TxHash: "tx0", TxIndex: 1, Amount: 100000000, Address: address, PublicKey: pub},
+	})
+	if err != nil {
+		t.Fatalf("NewSignBundle failed, err: %v", err)
+	}
+
+	//导出到冷钱包后再解析
+	data, err := bundle.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed, err: %v", err)
+	}
+	decoded, err := DecodeSignBundle(data)
+	if err != nil {
+		t.Fatalf("DecodeSignBundle failed, err: %v", err)
+	}
+	if owners := decoded.Owners(); len(owners) != 1 || owners[0].Address != address {
+		t.Errorf("owners = %+v, want only %s", owners, address)
+	}
+
+	sig, err := Default.SignBundleWithPrivateKey(decoded, address, prikey)
+	if err != nil {
+		t.Fatalf("SignBundleWithPrivateKey failed, err: %v", err)
+	}
+	if err := VerifyBundleSignature(bundle, sig); err != nil {
+		t.Errorf("VerifyBundleSignature failed, err: %v", err)
+	}
+
+	//私钥与地址不对应
+	if _, err := Default.SignBundleWithPrivateKey(decoded, address, otherKey); err == nil {
+		t.Errorf("sign with private key of other address should fail")
+	}
+
+	//签名声明为其他地址
+	forged := *sig
+	forged.Address = otherAddress
+	if err := VerifyBundleSignature(bundle, &forged); err == nil {
+		t.Errorf("signature with public key of other address should not be verified")
+	}
+
+	//篡改原始交易单
+	tampered := *bundle
+	tampered.RawHex = "0200a1b2c3d4e5f7"
+	data, _ = tampered.Encode()
+	if _, err := DecodeSignBundle(data); err == nil {
+		t.Errorf("bundle with tampered raw hex should be rejected")
+	}
+}
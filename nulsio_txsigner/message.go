@@ -0,0 +1,99 @@
+package nulsio_txsigner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/nulsio-adapter/nulsio_addrdec"
+	"github.com/blocktree/nulsio-adapter/nulsio_trans"
+)
+
+const (
+	//SignedMessagePrefix NULS消息签名前缀
+	SignedMessagePrefix = "NULS Signed Message:\n"
+
+	//compactSigHeader 压缩公钥的紧凑签名头部起始值
+	compactSigHeader = 27 + 4
+)
+
+//MessageHash 计算消息签名的哈希：两次sha256(变长前缀 + 变长消息)
+func MessageHash(message []byte) []byte {
+	data, _ := nulsio_trans.GetBytesWithLength([]byte(SignedMessagePrefix))
+	msg, _ := nulsio_trans.GetBytesWithLength(message)
+	data = append(data, msg...)
+	return nulsio_trans.Sha256Twice(data)
+}
+
+//SignMessage 使用私钥签名消息，返回base64编码的65字节紧凑签名：头部 + r + s
+func (singer *TransactionSigner) SignMessage(message []byte, prikey []byte) (string, error) {
+
+	hash := MessageHash(message)
+
+	pub, ret := owcrypt.GenPubkey(prikey, owcrypt.ECC_CURVE_SECP256K1)
+	if ret != owcrypt.SUCCESS {
+		return "", errors.New("Get Pubkey failed!")
+	}
+
+	signature, ret := owcrypt.Signature(prikey, nil, 0, hash, 32, owcrypt.ECC_CURVE_SECP256K1)
+	if ret != owcrypt.SUCCESS {
+		return "", errors.New("Failed to sign message!")
+	}
+	signature = nulsio_trans.NormalizeSignature(signature)
+
+	//签名算法不返回恢复标识，逐个尝试直到恢复出签名公钥
+	for recID := byte(0); recID < 4; recID++ {
+		recovered, ret := owcrypt.RecoverPubkey(append(append([]byte{}, signature...), recID), hash, owcrypt.ECC_CURVE_SECP256K1)
+		if ret != owcrypt.SUCCESS || !bytes.Equal(recovered, pub) {
+			continue
+		}
+		compact := append([]byte{compactSigHeader + recID}, signature...)
+		return base64.StdEncoding.EncodeToString(compact), nil
+	}
+
+	return "", errors.New("Failed to calculate recovery id!")
+}
+
+//RecoverMessagePubkey 从消息签名中恢复压缩公钥
+func RecoverMessagePubkey(message []byte, signature string) ([]byte, error) {
+
+	compact, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(compact) != 65 {
+		return nil, errors.New("Invalid message signature!")
+	}
+
+	recID := compact[0] - compactSigHeader
+	if compact[0] < compactSigHeader || recID > 3 {
+		return nil, fmt.Errorf("Invalid message signature header: %d", compact[0])
+	}
+
+	sig := append(append([]byte{}, compact[1:]...), recID)
+	pub, ret := owcrypt.RecoverPubkey(sig, MessageHash(message), owcrypt.ECC_CURVE_SECP256K1)
+	if ret != owcrypt.SUCCESS {
+		return nil, errors.New("Failed to recover public key!")
+	}
+
+	return owcrypt.PointCompress(append([]byte{0x04}, pub...), owcrypt.ECC_CURVE_SECP256K1), nil
+}
+
+//VerifyMessage 验证消息签名是否由地址的私钥签署
+func VerifyMessage(address string, message []byte, signature string) error {
+
+	pub, err := RecoverMessagePubkey(message, signature)
+	if err != nil {
+		return err
+	}
+
+	signer, err := nulsio_addrdec.GetAddressByPub(pub)
+	if err != nil {
+		return err
+	}
+
+	if signer != address {
+		return fmt.Errorf("message is signed by %s, not %s", signer, address)
+	}
+
+	return nil
+}
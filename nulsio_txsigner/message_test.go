@@ -0,0 +1,75 @@
+package nulsio_txsigner
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestMessageHash(t *testing.T) {
+	//sha256(sha256(0x15 + "NULS Signed Message:\n" + 0x0a + "hello nuls"))
+	want := "155a821d30bc6a712127730b3e4739271a6eaf3c0325b96ce66243cc89c8c485"
+	if hash := hex.EncodeToString(MessageHash([]byte("hello nuls"))); hash != want {
+		t.Errorf("MessageHash = %s, want %s", hash, want)
+	}
+}
+
+func TestSignMessageRoundTrip(t *testing.T) {
+
+	prikey, pub, address := testKeyAddress(t, "0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+	_, _, otherAddress := testKeyAddress(t, "1f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+	message := []byte("hello nuls")
+
+	signature, err := Default.SignMessage(message, prikey)
+	if err != nil {
+		t.Fatalf("SignMessage failed, err: %v", err)
+	}
+
+	//头部 + r + s，压缩公钥的头部为31~34
+	compact, _ := base64.StdEncoding.DecodeString(signature)
+	if len(compact) != 65 || compact[0] < 31 || compact[0] > 34 {
+		t.Errorf("compact signature = %x", compact)
+	}
+
+	recovered, err := RecoverMessagePubkey(message, signature)
+	if err != nil || hex.EncodeToString(recovered) != pub {
+		t.Errorf("RecoverMessagePubkey = %x, want %s, err: %v", recovered, pub, err)
+	}
+
+	if err := VerifyMessage(address, message, signature); err != nil {
+		t.Errorf("VerifyMessage failed, err: %v", err)
+	}
+	if err := VerifyMessage(otherAddress, message, signature); err == nil {
+		t.Errorf("signature should not be verified with other address")
+	}
+	if err := VerifyMessage(address, []byte("hello nuls!"), signature); err == nil {
+		t.Errorf("signature should not be verified with other message")
+	}
+}
+
+//TestVerifyMessageCrossImplementation 校验由独立的secp256k1实现生成的签名
+//该签名使用与本实现相同的前缀和哈希规则，只能验证签名编码和公钥恢复，不能证明与官方钱包兼容，
+//取得NULS官方钱包签名的向量后应替换
+func TestVerifyMessageCrossImplementation(t *testing.T) {
+
+	//私钥0f2d8a3e...89ab，消息"hello nuls"，恢复标识0
+	signature := "H3CtffF8euqx8DxiU2wXgf2rr3/IwhfaXkQjxMHYT5R3Q0WJSJhje08qZLJxrDAHxrXFyDOxKY9uVdyp+N8zQx8="
+	pub := "039fda45f3fe5af624157878197a9c10c9970228f03d548f6ae1bbdd39a0d99807"
+
+	recovered, err := RecoverMessagePubkey([]byte("hello nuls"), signature)
+	if err != nil || hex.EncodeToString(recovered) != pub {
+		t.Errorf("RecoverMessagePubkey = %x, want %s, err: %v", recovered, pub, err)
+	}
+
+	_, _, address := testKeyAddress(t, "0f2d8a3e5b1c7a9d4e6f0123456789abcdef0123456789abcdef0123456789ab")
+	if err := VerifyMessage(address, []byte("hello nuls"), signature); err != nil {
+		t.Errorf("VerifyMessage failed, err: %v", err)
+	}
+
+	//头部不是压缩公钥的紧凑签名
+	compact, _ := base64.StdEncoding.DecodeString(signature)
+	compact[0] = 27
+	if _, err := RecoverMessagePubkey([]byte("hello nuls"), base64.StdEncoding.EncodeToString(compact)); err == nil {
+		t.Errorf("signature with uncompressed header should be rejected")
+	}
+}
@@ -2,7 +2,6 @@ package nulsio_txsigner
 
 import (
 	"errors"
-	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/nulsio-adapter/nulsio_trans"
 )
 
@@ -12,37 +11,12 @@ var Default = &TransactionSigner{}
 type TransactionSigner struct {
 }
 
-// SignTransactionHash 交易哈希签名算法
+// SignTransactionHash 交易哈希签名算法，msg为交易单的待签名消息（已两次sha256），返回64字节低S签名
 // required
 func (singer *TransactionSigner) SignTransactionHash(msg []byte, prikey []byte, eccType uint32) ([]byte, error) {
-	msg = nulsio_trans.Sha256Twice(msg) //sha256
-
-	signature, retCode := owcrypt.Signature(prikey, nil, 0, msg, 32, owcrypt.ECC_CURVE_SECP256K1)
-	if retCode != owcrypt.SUCCESS {
-		return nil, errors.New("Failed to sign message!")
-	}
-
-	pub, ret := owcrypt.GenPubkey(prikey, owcrypt.ECC_CURVE_SECP256K1)
-	if ret != owcrypt.SUCCESS {
-		return nil, errors.New("Get Pubkey failed!")
-	}
-	pub = owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256K1)
-
-	sigPub := &nulsio_trans.SigPub{
-		pub,
-		signature,
+	if len(msg) != 32 {
+		return nil, errors.New("Invalid transaction hash data!")
 	}
 
-
-	result := make([]byte, 0)
-	result = append(result, byte(len(pub)))
-	result = append(result, pub...)
-
-	result = append(result, 0)
-	resultSig := make([]byte, 0)
-	resultSig = append(resultSig, sigPub.ToBytes()...)
-
-	result = append(result, resultSig...)
-
-	return result, nil
+	return nulsio_trans.SignTransactionMessage(msg, prikey)
 }
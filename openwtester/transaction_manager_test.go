@@ -17,6 +17,7 @@ package openwtester
 
 import (
 	"github.com/astaxie/beego/config"
+	"github.com/blocktree/nulsio-adapter/nulsio"
 	"github.com/blocktree/openwallet/openw"
 	"path/filepath"
 	"testing"
@@ -182,4 +183,47 @@ func TestGetAddressBalance(t *testing.T) {
 		log.Infof("UnconfirmBalance[%s] = %s", b.Address, b.UnconfirmBalance)
 		log.Infof("ConfirmBalance[%s] = %s", b.Address, b.ConfirmBalance)
 	}
-}
\ No newline at end of file
+}
+func testNewNulsWalletManager() *nulsio.WalletManager {
+	wm := nulsio.NewWalletManager()
+	//读取配置
+	absFile := filepath.Join(configFilePath, wm.Symbol()+".ini")
+	c, err := config.NewConfig("ini", absFile)
+	if err != nil {
+		return wm
+	}
+	wm.LoadAssetsConfig(c)
+	return wm
+}
+
+func TestInvokeContractView(t *testing.T) {
+	wm := testNewNulsWalletManager()
+	decoder := wm.ContractDecoder.(*nulsio.NulsContractDecoder)
+
+	contractAddress := "NseCpCRzVU3U9RSYyTwSFhdL71wEnpDv"
+	balance, err := decoder.BalanceOf(contractAddress, "Nse6cbCoZenQo7wwEFjs3th9MgNXcs2A")
+	if err != nil {
+		log.Error("BalanceOf failed, unexpected error:", err)
+		return
+	}
+	log.Info("balanceOf:", balance.String())
+
+	totalSupply, err := decoder.TotalSupply(contractAddress)
+	if err != nil {
+		log.Error("TotalSupply failed, unexpected error:", err)
+		return
+	}
+	log.Info("totalSupply:", totalSupply.String())
+}
+
+func TestGetAccountDeposits(t *testing.T) {
+	wm := testNewNulsWalletManager()
+	deposits, err := wm.GetAccountDeposits("Nse6cbCoZenQo7wwEFjs3th9MgNXcs2A")
+	if err != nil {
+		log.Error("GetAccountDeposits failed, unexpected error:", err)
+		return
+	}
+	for i, d := range deposits {
+		log.Infof("deposit[%d]: %+v", i, d)
+	}
+}
@@ -163,6 +163,42 @@ func TestTransfer(t *testing.T) {
 }
 
 
+func TestTransferFromMultiAddresses(t *testing.T) {
+
+	tm := testInitWalletManager()
+	walletID := "VzLUoGiZioDZDyisPtKFMD7Sfy485Qih2N"
+	accountID := "HhMp9EJwZpNFhfUuSSXanocxgPGz9eLoSbPbqawcWtWU"
+	to := "Nse2PgVTn7K3CsLrDxjHTjxpxyvp3zyP"
+
+	//金额需大于任意两个地址的余额之和，交易单才会使用3个以上地址的utxo
+	rawTx, err := testCreateTransactionStep(tm, walletID, accountID, to, "3", "", nil)
+	if err != nil {
+		t.Fatalf("CreateTransaction failed, err: %v", err)
+	}
+
+	signers := rawTx.GetExtParam().Get("signers").Array()
+	if len(signers) < 3 {
+		t.Fatalf("transaction should spend from 3+ addresses, signers: %v", signers)
+	}
+	log.Info("signers:", signers)
+
+	_, err = testSignTransactionStep(tm, rawTx)
+	if err != nil {
+		t.Fatalf("SignTransaction failed, err: %v", err)
+	}
+
+	//验证签名顺序并由节点校验交易单
+	_, err = testVerifyTransactionStep(tm, rawTx)
+	if err != nil {
+		t.Fatalf("VerifyTransaction failed, err: %v", err)
+	}
+
+	_, err = testSubmitTransactionStep(tm, rawTx)
+	if err != nil {
+		t.Fatalf("SubmitTransaction failed, err: %v", err)
+	}
+}
+
 
 func TestTransferNrc20(t *testing.T) {
 